@@ -0,0 +1,64 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnnotationFreezeOverride is the Environment annotation with the name of a ChangeFreeze that doesn't apply to the
+// Environment. Use it for emergency changes during a freeze.
+const AnnotationFreezeOverride = "clusterops.mmlt.nl/freeze-override"
+
+// ChangeFreezeSpec defines a blackout period.
+type ChangeFreezeSpec struct {
+	// Start is the time the freeze begins, for example 2021-12-20T00:00:00Z
+	Start metav1.Time `json:"start"`
+
+	// End is the time the freeze ends.
+	End metav1.Time `json:"end"`
+
+	// Description tells why changes are frozen, for example "year-end".
+	// +optional
+	Description string `json:"description,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Start",type="string",JSONPath=".spec.start"
+// +kubebuilder:printcolumn:name="End",type="string",JSONPath=".spec.end"
+// +kubebuilder:printcolumn:name="Description",type="string",JSONPath=".spec.description"
+
+// ChangeFreeze is a blackout period in which envop doesn't start steps in any of the Environments it manages.
+type ChangeFreeze struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ChangeFreezeSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ChangeFreezeList contains a list of ChangeFreezes.
+type ChangeFreezeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ChangeFreeze `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ChangeFreeze{}, &ChangeFreezeList{})
+}
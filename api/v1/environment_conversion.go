@@ -0,0 +1,4 @@
+package v1
+
+// Hub marks v1 as the version that other Environment versions are converted to and from.
+func (*Environment) Hub() {}
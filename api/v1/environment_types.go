@@ -21,6 +21,10 @@ import (
 
 // EnvironmentSpec defines the desired state of an Environment.
 type EnvironmentSpec struct {
+	// Paused stops envop from starting steps, steps that are running are allowed to finish.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
 	// Destroy is true when an environment needs to be removed.
 	// Typically used in cluster delete/create test cases.
 	// (in addition to destroy: true a budget.deleteLimit: 99 is required)
@@ -34,6 +38,21 @@ type EnvironmentSpec struct {
 
 	// Clusters defines the values specific for each cluster instance.
 	Clusters []ClusterSpec `json:"clusters,omitempty"`
+
+	// Rollout defines the order in which changes are rolled out over the clusters.
+	// If the rollout spec is omitted all clusters are changed independently of each other.
+	// +optional
+	Rollout RolloutSpec `json:"rollout,omitempty"`
+
+	// Windows are the maintenance windows in which steps are allowed to start.
+	// A step that is not selected by any window can start at any time.
+	// Steps that are running when their window closes are allowed to finish.
+	// +optional
+	Windows []MaintenanceWindow `json:"windows,omitempty"`
+
+	// Notifications are the sinks that are notified when a step changes state.
+	// +optional
+	Notifications []NotificationSpec `json:"notifications,omitempty"`
 }
 
 // InfraSpec defines the infrastructure that is used by all clusters.
@@ -52,10 +71,36 @@ type InfraSpec struct {
 	Budget InfraBudget `json:"budget,omitempty"`
 
 	// Schedule is a CRON formatted string defining when changed can be applied.
+	// A step can start when the schedule fires within 10 minutes, the schedule is evaluated in the time zone of the
+	// operator.
 	// If the schedule is omitted then changes will be applied immediately.
+	// Deprecated: use spec.windows
 	// +optional
 	Schedule string `json:"schedule,omitempty"`
 
+	// Approval selects if a terraform plan needs to be approved before it's applied.
+	// Valid values are:
+	// - "" (default): plans are applied without approval.
+	// - "manual": plans are applied after the Environment is annotated with the plan hash.
+	// Changing the approval mode does not affect the Infra step hash.
+	// +optional
+	Approval ApprovalMode `json:"approval,omitempty" hash:"ignore"`
+
+	// Drift defines the periodic check for differences between the infrastructure and the terraform code.
+	// If the drift spec is omitted drift is not checked.
+	// Changing the drift spec does not affect the Infra step hash.
+	// +optional
+	Drift DriftSpec `json:"drift,omitempty" hash:"ignore"`
+
+	// Policy is the path relative to Main of a directory with policy files (*.yaml, *.yml, *.json).
+	// The directory must be in the infra source.
+	// The terraform plan is evaluated against the policy rules before it's applied, a violated rule results in an error.
+	// If the policy is omitted no rules are evaluated, a policy directory that is missing or has no policy files results in
+	// an error.
+	// Changing the policy path does not affect the Infra step hash.
+	// +optional
+	Policy string `json:"policy,omitempty" hash:"ignore"`
+
 	// Source is the repository that contains Terraform infrastructure code.
 	Source SourceSpec `json:"source,omitempty"`
 
@@ -79,6 +124,35 @@ type InfraSpec struct {
 	X map[string]string `json:"x,omitempty"`
 }
 
+// ApprovalMode selects if changes need approval before they are applied.
+// Valid values are:
+// - ApprovalManual
+// +kubebuilder:validation:Enum=manual
+type ApprovalMode string
+
+const (
+	// ApprovalManual requires a human to approve a plan by annotating the Environment with AnnotationApprovedPlan.
+	ApprovalManual ApprovalMode = "manual"
+)
+
+// AnnotationApprovedPlan is the Environment annotation that contains the hash of an approved plan.
+// For example: kubectl annotate environment myenv clusterops.mmlt.nl/approved-plan=<status.steps.Infra.approval.hash>
+const AnnotationApprovedPlan = "clusterops.mmlt.nl/approved-plan"
+
+// DriftSpec defines the periodic detection of infrastructure drift.
+// Drift are changes made to the infrastructure outside of terraform, for example in the Azure portal.
+type DriftSpec struct {
+	// Interval is the time between drift checks.
+	// A drift check runs terraform plan without applying it.
+	// If the interval is omitted drift is not checked.
+	// +optional
+	Interval metav1.Duration `json:"interval,omitempty"`
+
+	// Remediate makes the Infra step run again when drift is detected and the changes are within budget.
+	// +optional
+	Remediate bool `json:"remediate,omitempty"`
+}
+
 // InfraBudget defines how many changes the operator is allowed to make.
 type InfraBudget struct {
 	// AddLimit is the maximum number of resources that the operator is allowed to add.
@@ -95,6 +169,120 @@ type InfraBudget struct {
 	// Exceeded this number will result in an error.
 	// +optional
 	DeleteLimit *int32 `json:"deleteLimit,omitempty"`
+
+	// DenyDelete are the resource types that the operator is not allowed to delete or replace.
+	// For example; azurerm_kubernetes_cluster, azurerm_key_vault
+	// A plan that deletes a resource of one of these types will result in an error.
+	// Changing this value does not affect the Infra step hash.
+	// +optional
+	DenyDelete []string `json:"denyDelete,omitempty" hash:"ignore"`
+
+	// DenyReplace denies the operator to replace (delete and create) resources.
+	// A plan that replaces a resource will result in an error.
+	// Changing this value does not affect the Infra step hash.
+	// +optional
+	DenyReplace bool `json:"denyReplace,omitempty" hash:"ignore"`
+
+	// TypeLimits is the maximum number of resources per resource type that the operator is allowed to change.
+	// For example; azurerm_subnet: 1
+	// Exceeding a limit will result in an error.
+	// Changing this value does not affect the Infra step hash.
+	// +optional
+	TypeLimits map[string]int32 `json:"typeLimits,omitempty" hash:"ignore"`
+}
+
+// RolloutSpec defines how changes are rolled out over clusters.
+type RolloutSpec struct {
+	// Waves are ordered groups of clusters.
+	// The clusters of a wave are changed after all clusters of the previous waves are Ready for at least Soak.
+	// Clusters that are not in a wave are part of an implicit last wave.
+	// +optional
+	Waves []RolloutWave `json:"waves,omitempty"`
+
+	// Soak is the time the clusters of a wave must be Ready before the next wave is started.
+	// For example; 30m
+	// +optional
+	Soak metav1.Duration `json:"soak,omitempty"`
+
+	// MaxFailures is the number of clusters that are allowed to have a failed step before the rollout is halted.
+	// The default of 0 halts the rollout on the first failure.
+	// +optional
+	MaxFailures int32 `json:"maxFailures,omitempty"`
+}
+
+// MaintenanceWindow defines a period in which steps are allowed to start.
+type MaintenanceWindow struct {
+	// Steps selects the steps the window applies to by type (for example Infra, AKSPool or Addons) or by type and
+	// cluster name (for example Addonscpe).
+	// If steps is omitted the window applies to all steps.
+	// +optional
+	Steps []string `json:"steps,omitempty"`
+
+	// Start is a CRON formatted string defining when the window opens.
+	// For example; "0 22 * * MON-FRI" opens the window at 22:00 on working days.
+	Start string `json:"start"`
+
+	// Duration is how long the window stays open.
+	// For example; 4h
+	Duration metav1.Duration `json:"duration"`
+
+	// TimeZone is the IANA name of the time zone Start is evaluated in.
+	// For example; Europe/Amsterdam
+	// If the time zone is omitted UTC is used.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// NotificationSpec defines a sink that is notified of step state changes.
+type NotificationSpec struct {
+	// Type of sink.
+	Type NotificationType `json:"type"`
+
+	// URL of the webhook.
+	// Webhook URLs often contain a token so the URL can be a "vault name field" reference.
+	URL string `json:"url"`
+
+	// Secret (webhook only) is the key to sign the payload with.
+	// The HMAC-SHA256 of the payload is sent in the X-Envop-Signature header as "sha256=<hex>".
+	// The secret can be a "vault name field" reference.
+	// +optional
+	Secret string `json:"secret,omitempty"`
+
+	// Steps are the types of the steps to notify about, for example [Infra, Addons].
+	// If steps is omitted all steps are notified about.
+	// +optional
+	Steps []string `json:"steps,omitempty"`
+
+	// States are the states to notify about, for example [Error, AwaitingApproval].
+	// If states is omitted all state changes are notified about.
+	// +optional
+	States []StepState `json:"states,omitempty"`
+}
+
+// NotificationType is the type of a notification sink.
+// Valid values are:
+// - NotificationWebhook
+// - NotificationSlack
+// - NotificationTeams
+// +kubebuilder:validation:Enum=webhook;slack;teams
+type NotificationType string
+
+const (
+	// NotificationWebhook posts a JSON payload to a generic webhook.
+	NotificationWebhook NotificationType = "webhook"
+	// NotificationSlack posts a message to a Slack compatible incoming webhook.
+	NotificationSlack NotificationType = "slack"
+	// NotificationTeams posts a message card to a Microsoft Teams incoming webhook.
+	NotificationTeams NotificationType = "teams"
+)
+
+// RolloutWave is a group of clusters that are changed together.
+type RolloutWave struct {
+	// Name of the wave, for example; canary
+	Name string `json:"name,omitempty"`
+
+	// Clusters are the names of the clusters in this wave.
+	Clusters []string `json:"clusters,omitempty"`
 }
 
 // ClusterSpec defines cluster specific infra and k8s resources.
@@ -359,7 +547,10 @@ type ClusterAZSpec struct {
 // ClusterAddonSpec defines what K8s resources needs to be deployed in a cluster after creation.
 type ClusterAddonSpec struct {
 	// Schedule is a CRON formatted string defining when changed can be applied.
+	// A step can start when the schedule fires within 10 minutes, the schedule is evaluated in the time zone of the
+	// operator.
 	// If the schedule is omitted then changes will be applied immediately.
+	// Deprecated: use spec.windows
 	// +optional
 	Schedule string `json:"schedule,omitempty"`
 
@@ -385,6 +576,102 @@ type EnvironmentStatus struct {
 
 	// Step contains the latest available observations of the Environment's state.
 	Steps map[string]StepStatus `json:"steps,omitempty"`
+
+	// Drift is the result of the most recent infrastructure drift check.
+	// +optional
+	Drift *DriftStatus `json:"drift,omitempty"`
+
+	// Clusters contains the hashes of the effective (defaults merged) cluster specs by cluster name.
+	// +optional
+	Clusters map[string]ClusterStatus `json:"clusters,omitempty"`
+
+	// History contains the most recent executions by step name, oldest first.
+	// Unlike Steps the history is kept when a step is reset.
+	// +optional
+	History map[string]StepRuns `json:"history,omitempty"`
+
+	// NextWindowStart is the time the first maintenance window of the PendingSteps opens.
+	// +optional
+	NextWindowStart *metav1.Time `json:"nextWindowStart,omitempty"`
+
+	// PendingSteps are the steps that have changes but are waiting for their maintenance window to open or for a
+	// pending step they depend on.
+	// +optional
+	PendingSteps []PendingStep `json:"pendingSteps,omitempty"`
+}
+
+// PendingStep is a step that is waiting for a maintenance window.
+type PendingStep struct {
+	// Name of the step.
+	Name string `json:"name"`
+	// Hash is the step hash (sources and values) that will be executed.
+	Hash string `json:"hash"`
+	// WindowStart is the time the first maintenance window of the step opens.
+	WindowStart metav1.Time `json:"windowStart"`
+}
+
+// StepRuns are the records of step executions.
+type StepRuns []StepRun
+
+// StepRun is the record of a single step execution.
+type StepRun struct {
+	// StartTime is the time the step started running.
+	StartTime metav1.Time `json:"startTime"`
+	// EndTime is the time the step reached State, empty while the step is running.
+	// +optional
+	EndTime *metav1.Time `json:"endTime,omitempty"`
+	// Duration is the time between StartTime and EndTime.
+	// +optional
+	Duration metav1.Duration `json:"duration,omitempty"`
+	// State is the state the step ended in.
+	// +optional
+	State StepState `json:"state,omitempty"`
+	// Hash is the step hash (sources and values) that is executed.
+	// +optional
+	Hash string `json:"hash,omitempty"`
+	// Added, Changed, Deleted are the number of objects affected by the step.
+	// +optional
+	Added int32 `json:"added,omitempty"`
+	// +optional
+	Changed int32 `json:"changed,omitempty"`
+	// +optional
+	Deleted int32 `json:"deleted,omitempty"`
+	// Message is the final step message.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Artefacts are links to the archived files of the run.
+	// +optional
+	Artefacts []string `json:"artefacts,omitempty"`
+}
+
+// ClusterStatus identifies the effective configuration of a cluster.
+// Use 'envop render' to show the effective cluster specs.
+type ClusterStatus struct {
+	// SpecHash is the hash of the cluster spec after spec.defaults are merged into it.
+	SpecHash string `json:"specHash,omitempty"`
+	// DefaultsHash is the hash of the spec.defaults that are merged into the cluster spec.
+	DefaultsHash string `json:"defaultsHash,omitempty"`
+}
+
+// DriftStatus is the result of an infrastructure drift check.
+type DriftStatus struct {
+	// LastCheckTime is the time of the drift check.
+	LastCheckTime metav1.Time `json:"lastCheckTime"`
+	// Detected is true when the infrastructure differs from the terraform code and state.
+	Detected bool `json:"detected"`
+	// Added, Changed, Deleted are the number of resources terraform would change to undo the drift.
+	Added   int32 `json:"added"`
+	Changed int32 `json:"changed"`
+	Deleted int32 `json:"deleted"`
+	// Resources are the resources that have drifted.
+	// +optional
+	Resources []PlanResource `json:"resources,omitempty"`
+	// Remediated is true when the Infra step is triggered to undo the drift.
+	// +optional
+	Remediated bool `json:"remediated,omitempty"`
+	// Error tells why the drift check failed, the check is tried again at the next interval.
+	// +optional
+	Error string `json:"error,omitempty"`
 }
 
 // StepStatus is the last observed status of a Step.
@@ -402,15 +689,68 @@ type StepStatus struct {
 	// An opaque value representing the config/parameters applied by a step.
 	// Only valid when state=Ready.
 	Hash string `json:"hash,omitempty"`
+	// HashInputs are the hashes of the inputs (source, spec, values) that Hash is derived from.
+	// They tell which input has changed when a step runs again.
+	// Only valid when state=Ready.
+	// +optional
+	HashInputs map[string]string `json:"hashInputs,omitempty"`
+	// Approval is the plan that is waiting to be approved.
+	// Only valid when state=AwaitingApproval.
+	// +optional
+	Approval *PlanApproval `json:"approval,omitempty"`
+	// Artefacts are links to the archived files (like the terraform plan) of the last run of the step.
+	// +optional
+	Artefacts []string `json:"artefacts,omitempty"`
+	// Secrets are the versions of the referenced secrets that are used by the step when it was last Ready.
+	// A step is run again when one of these secrets is rotated.
+	// +optional
+	Secrets []SecretVersion `json:"secrets,omitempty"`
+}
+
+// SecretVersion identifies the version of a referenced secret value.
+type SecretVersion struct {
+	// Path is the spec field that refers to the secret, for example infra.state.access
+	Path string `json:"path"`
+	// Ref is the vault reference, for example "vault tfstate access-key"
+	Ref string `json:"ref"`
+	// Version is an opaque value that changes when the secret value changes.
+	// It's keyed with a secret of the operator so it can't be used to check guesses of the secret value.
+	Version string `json:"version"`
+}
+
+// PlanApproval is a summary of a plan that needs approval before it can be applied.
+type PlanApproval struct {
+	// Hash identifies the plan.
+	// To approve the plan annotate the Environment with AnnotationApprovedPlan and this value.
+	Hash string `json:"hash"`
+	// StepHash is the step hash (sources and values) at the time the plan was made.
+	// When the step hash changes the plan is invalidated.
+	StepHash string `json:"stepHash"`
+	// Added, Changed, Deleted are the number of resources affected by the plan.
+	Added   int32 `json:"added"`
+	Changed int32 `json:"changed"`
+	Deleted int32 `json:"deleted"`
+	// Resources are the resources affected by the plan.
+	// +optional
+	Resources []PlanResource `json:"resources,omitempty"`
+}
+
+// PlanResource is a resource change in a plan.
+type PlanResource struct {
+	// Address is the absolute resource address, for example module.aks1.azurerm_kubernetes_cluster.this
+	Address string `json:"address"`
+	// Action is one of create, update, delete or replace.
+	Action string `json:"action"`
 }
 
 // StepState is the current state of the step.
 type StepState string
 
 const (
-	StateRunning StepState = "Running"
-	StateReady   StepState = "Ready"
-	StateError   StepState = "Error"
+	StateRunning          StepState = "Running"
+	StateAwaitingApproval StepState = "AwaitingApproval"
+	StateReady            StepState = "Ready"
+	StateError            StepState = "Error"
 )
 
 // EnvironmentCondition provides a synopsis of the current environment state.
@@ -437,17 +777,35 @@ type EnvironmentCondition struct {
 // EnvironmentConditionReason is the reason for the condition change.
 type EnvironmentConditionReason string
 
+// ConditionPaused is the type of the condition that is True when the Environment is paused.
+// The condition is added when the Environment is paused for the first time.
+const ConditionPaused = "Paused"
+
+// ConditionFrozen is the type of the condition that is True when a ChangeFreeze is in effect.
+// The condition is added when a ChangeFreeze is in effect for the first time.
+const ConditionFrozen = "Frozen"
+
 const (
-	ReasonRunning EnvironmentConditionReason = "Running"
-	ReasonReady   EnvironmentConditionReason = "Ready"
-	ReasonFailed  EnvironmentConditionReason = "Failed"
+	ReasonPaused           EnvironmentConditionReason = "Paused"
+	ReasonResumed          EnvironmentConditionReason = "Resumed"
+	ReasonFrozen           EnvironmentConditionReason = "Frozen"
+	ReasonFreezeOverridden EnvironmentConditionReason = "FreezeOverridden"
+	ReasonThawed           EnvironmentConditionReason = "Thawed"
+	ReasonRunning          EnvironmentConditionReason = "Running"
+	ReasonAwaitingApproval EnvironmentConditionReason = "AwaitingApproval"
+	ReasonScheduled        EnvironmentConditionReason = "Scheduled"
+	ReasonReady            EnvironmentConditionReason = "Ready"
+	ReasonFailed           EnvironmentConditionReason = "Failed"
 )
 
 // +genclient
 // +kubebuilder:object:root=true
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
 // +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message"
+// +kubebuilder:printcolumn:name="Paused",type="boolean",JSONPath=".spec.paused",priority=1
+// +kubebuilder:printcolumn:name="Next Window",type="string",JSONPath=".status.nextWindowStart",priority=1
 
 // Environment is an environment at a cloud-provider with one or more Kubernetes clusters, addons, conformance tested.
 type Environment struct {
@@ -0,0 +1,120 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LabelEnvironment is the label with the name of the Environment an EnvironmentRun belongs to.
+const LabelEnvironment = "clusterops.mmlt.nl/environment"
+
+// EnvironmentRunSpec defines what is executed by a run.
+type EnvironmentRunSpec struct {
+	// EnvironmentName is the name of the Environment (in the same namespace) that is run.
+	EnvironmentName string `json:"environmentName"`
+
+	// Generation is the Environment metadata.generation at the start of the run.
+	Generation int64 `json:"generation"`
+
+	// Sources are the hashes of the source workspaces at the start of the run.
+	// The infra source has key 'infra', cluster sources have the cluster name as key.
+	// +optional
+	Sources map[string]string `json:"sources,omitempty"`
+
+	// Steps are the names of the steps in the plan at the start of the run, in plan order.
+	// Steps that are at desired state or can't start (for example outside their maintenance window) are not started,
+	// see status.startedSteps.
+	// +optional
+	Steps []string `json:"steps,omitempty"`
+}
+
+// EnvironmentRunStatus defines the outcome of a run.
+type EnvironmentRunStatus struct {
+	// StartTime is the time the run started.
+	StartTime metav1.Time `json:"startTime"`
+
+	// CompletionTime is the time the run completed, empty while the run is in progress.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Phase is Running while steps are executed, Succeeded when all started steps are Ready, AwaitingApproval when
+	// the other started steps are Ready but a step waits for its plan to be approved and Failed otherwise.
+	// +optional
+	Phase RunPhase `json:"phase,omitempty"`
+
+	// StartedSteps are the names of the steps that are started by the run, in start order.
+	// +optional
+	StartedSteps []string `json:"startedSteps,omitempty"`
+
+	// Steps are the outcomes of the started steps by step name.
+	// +optional
+	Steps map[string]RunStepStatus `json:"steps,omitempty"`
+}
+
+// RunPhase is the phase of an EnvironmentRun.
+// +kubebuilder:validation:Enum=Running;Succeeded;Failed;AwaitingApproval
+type RunPhase string
+
+const (
+	RunPhaseRunning          RunPhase = "Running"
+	RunPhaseSucceeded        RunPhase = "Succeeded"
+	RunPhaseFailed           RunPhase = "Failed"
+	RunPhaseAwaitingApproval RunPhase = "AwaitingApproval"
+)
+
+// RunStepStatus is the outcome of a step in a run.
+type RunStepStatus struct {
+	// State is the state of the step at the end of the run.
+	// +optional
+	State StepState `json:"state,omitempty"`
+	// Message is the step message at the end of the run.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Hash is the step hash (sources and values) that is executed.
+	// +optional
+	Hash string `json:"hash,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Environment",type="string",JSONPath=".spec.environmentName"
+// +kubebuilder:printcolumn:name="Generation",type="integer",JSONPath=".spec.generation"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// EnvironmentRun records a single execution of the steps of an Environment.
+// Runs are created by envop and owned by the Environment.
+type EnvironmentRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EnvironmentRunSpec   `json:"spec,omitempty"`
+	Status EnvironmentRunStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EnvironmentRunList contains a list of EnvironmentRuns.
+type EnvironmentRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EnvironmentRun `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EnvironmentRun{}, &EnvironmentRunList{})
+}
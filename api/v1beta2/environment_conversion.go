@@ -0,0 +1,243 @@
+package v1beta2
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+	"strings"
+)
+
+// ConvertTo converts this Environment to the Hub version (v1).
+func (src *Environment) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.Environment)
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = v1.EnvironmentSpec{
+		Paused:   src.Spec.Paused,
+		Destroy:  src.Spec.Destroy,
+		Infra:    infraTo(src.Spec.Infra),
+		Defaults: clusterTo(src.Spec.Defaults),
+		Rollout:  src.Spec.Rollout,
+		Windows:  src.Spec.Windows,
+
+		Notifications: src.Spec.Notifications,
+	}
+	for _, c := range src.Spec.Clusters {
+		dst.Spec.Clusters = append(dst.Spec.Clusters, clusterTo(c))
+	}
+	dst.Status = src.Status
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1) to this version.
+func (dst *Environment) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1.Environment)
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = EnvironmentSpec{
+		Paused:   src.Spec.Paused,
+		Destroy:  src.Spec.Destroy,
+		Infra:    infraFrom(src.Spec.Infra),
+		Defaults: clusterFrom(src.Spec.Defaults),
+		Rollout:  src.Spec.Rollout,
+		Windows:  src.Spec.Windows,
+
+		Notifications: src.Spec.Notifications,
+	}
+	for _, c := range src.Spec.Clusters {
+		dst.Spec.Clusters = append(dst.Spec.Clusters, clusterFrom(c))
+	}
+	dst.Status = src.Status
+
+	return nil
+}
+
+func infraTo(in InfraSpec) v1.InfraSpec {
+	r := v1.InfraSpec{
+		EnvName:   in.EnvName,
+		EnvDomain: in.EnvDomain,
+		Budget:    in.Budget,
+		Schedule:  in.Schedule,
+		Approval:  in.Approval,
+		Drift:     in.Drift,
+		Policy:    in.Policy,
+		Source:    sourceTo(in.Source),
+		Main:      in.Main,
+		State: v1.StateSpec{
+			StorageAccount: in.State.StorageAccount,
+			Access:         in.State.Access.String(),
+		},
+		X: in.X,
+	}
+	if az := in.Provider.Azure; az != nil {
+		r.AZ = v1.AZSpec{
+			Subscription:  az.Subscription,
+			ResourceGroup: az.ResourceGroup,
+			VNetCIDR:      az.VNetCIDR,
+			DNS:           az.DNS,
+			SubnetNewbits: az.SubnetNewbits,
+			Outbound:      az.Outbound,
+			Routes:        az.Routes,
+		}
+		r.AAD = v1.AADSpec{
+			TenantID:        az.AAD.TenantID.String(),
+			ServerAppID:     az.AAD.ServerAppID.String(),
+			ServerAppSecret: az.AAD.ServerAppSecret.String(),
+			ClientAppID:     az.AAD.ClientAppID.String(),
+		}
+	}
+	return r
+}
+
+func infraFrom(in v1.InfraSpec) InfraSpec {
+	r := InfraSpec{
+		EnvName:   in.EnvName,
+		EnvDomain: in.EnvDomain,
+		Budget:    in.Budget,
+		Schedule:  in.Schedule,
+		Approval:  in.Approval,
+		Drift:     in.Drift,
+		Policy:    in.Policy,
+		Source:    sourceFrom(in.Source),
+		Main:      in.Main,
+		State: StateSpec{
+			StorageAccount: in.State.StorageAccount,
+			Access:         secretValueFrom(in.State.Access),
+		},
+		X: in.X,
+	}
+	// v1 is Azure only, the provider block is omitted when there are no Azure values.
+	if !isZeroAZ(in.AZ) || in.AAD != (v1.AADSpec{}) {
+		r.Provider.Azure = &AzureInfraSpec{
+			Subscription:  in.AZ.Subscription,
+			ResourceGroup: in.AZ.ResourceGroup,
+			VNetCIDR:      in.AZ.VNetCIDR,
+			DNS:           in.AZ.DNS,
+			SubnetNewbits: in.AZ.SubnetNewbits,
+			Outbound:      in.AZ.Outbound,
+			Routes:        in.AZ.Routes,
+			AAD: AADSpec{
+				TenantID:        secretValueFrom(in.AAD.TenantID),
+				ServerAppID:     secretValueFrom(in.AAD.ServerAppID),
+				ServerAppSecret: secretValueFrom(in.AAD.ServerAppSecret),
+				ClientAppID:     secretValueFrom(in.AAD.ClientAppID),
+			},
+		}
+	}
+	return r
+}
+
+func isZeroAZ(az v1.AZSpec) bool {
+	return az.Subscription == nil && az.ResourceGroup == "" && az.VNetCIDR == "" && az.DNS == nil &&
+		az.SubnetNewbits == 0 && az.Outbound == "" && az.Routes == nil
+}
+
+func clusterTo(in ClusterSpec) v1.ClusterSpec {
+	r := v1.ClusterSpec{
+		Name: in.Name,
+		Infra: v1.ClusterInfraSpec{
+			SubnetNum: in.Infra.SubnetNum,
+			Version:   in.Infra.Version,
+			Pools:     in.Infra.Pools,
+			X:         in.Infra.X,
+		},
+		Addons: v1.ClusterAddonSpec{
+			Schedule: in.Addons.Schedule,
+			Source:   sourceTo(in.Addons.Source),
+			Jobs:     in.Addons.Jobs,
+			MKV:      in.Addons.MKV,
+			X:        in.Addons.X,
+		},
+	}
+	if az := in.Infra.Provider.Azure; az != nil {
+		r.Infra.AZ = v1.ClusterAZSpec{
+			AvailabilityZones:     az.AvailabilityZones,
+			SKU:                   az.SKU,
+			ServiceEndpoints:      az.ServiceEndpoints,
+			LogAnalyticsWorkspace: az.LogAnalyticsWorkspace,
+		}
+	}
+	return r
+}
+
+func clusterFrom(in v1.ClusterSpec) ClusterSpec {
+	r := ClusterSpec{
+		Name: in.Name,
+		Infra: ClusterInfraSpec{
+			SubnetNum: in.Infra.SubnetNum,
+			Version:   in.Infra.Version,
+			Pools:     in.Infra.Pools,
+			X:         in.Infra.X,
+		},
+		Addons: ClusterAddonSpec{
+			Schedule: in.Addons.Schedule,
+			Source:   sourceFrom(in.Addons.Source),
+			Jobs:     in.Addons.Jobs,
+			MKV:      in.Addons.MKV,
+			X:        in.Addons.X,
+		},
+	}
+	az := in.Infra.AZ
+	if az.AvailabilityZones != nil || az.SKU != "" || az.ServiceEndpoints != nil || az.LogAnalyticsWorkspace != nil {
+		r.Infra.Provider.Azure = &AzureClusterSpec{
+			AvailabilityZones:     az.AvailabilityZones,
+			SKU:                   az.SKU,
+			ServiceEndpoints:      az.ServiceEndpoints,
+			LogAnalyticsWorkspace: az.LogAnalyticsWorkspace,
+		}
+	}
+	return r
+}
+
+func sourceTo(in SourceSpec) v1.SourceSpec {
+	return v1.SourceSpec{
+		Type:  in.Type,
+		URL:   in.URL,
+		Ref:   in.Ref,
+		Token: in.Token.String(),
+		Area:  in.Area,
+	}
+}
+
+func sourceFrom(in v1.SourceSpec) SourceSpec {
+	return SourceSpec{
+		Type:  in.Type,
+		URL:   in.URL,
+		Ref:   in.Ref,
+		Token: secretValueFrom(in.Token),
+		Area:  in.Area,
+	}
+}
+
+// String returns the v1 representation of a secret value; the literal value or a "vault name field" reference.
+func (s SecretValue) String() string {
+	if s.VaultRef == nil {
+		return s.Value
+	}
+	if s.VaultRef.Field == "" {
+		return "vault " + s.VaultRef.Name
+	}
+	return "vault " + s.VaultRef.Name + " " + s.VaultRef.Field
+}
+
+// SecretValueFrom returns the secret value for a v1 string.
+// A string in the form "vault name" or "vault name field" is a vault reference, all other strings are literal values.
+// Strings that don't convert back to the exact same v1 string (for example references with extra whitespace) are kept
+// as literal values so the conversion is lossless, v1 validation reports malformed references.
+func secretValueFrom(s string) SecretValue {
+	if !strings.HasPrefix(s, "vault ") {
+		return SecretValue{Value: s}
+	}
+	var r SecretValue
+	ss := strings.Fields(s)
+	switch len(ss) {
+	case 2:
+		r = SecretValue{VaultRef: &VaultRef{Name: ss[1]}}
+	case 3:
+		r = SecretValue{VaultRef: &VaultRef{Name: ss[1], Field: ss[2]}}
+	}
+	if r.VaultRef == nil || r.String() != s {
+		return SecretValue{Value: s}
+	}
+	return r
+}
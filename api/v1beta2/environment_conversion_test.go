@@ -0,0 +1,196 @@
+package v1beta2
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func testV1() *v1.Environment {
+	limit := int32(2)
+	return &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "env1",
+			Namespace:   "default",
+			Annotations: map[string]string{v1.AnnotationApprovedPlan: "abc"},
+		},
+		Spec: v1.EnvironmentSpec{
+			Infra: v1.InfraSpec{
+				EnvName:   "local",
+				EnvDomain: "example.com",
+				Budget:    v1.InfraBudget{DeleteLimit: &limit, DenyReplace: true},
+				Schedule:  "* 1-5 * * *",
+				Approval:  v1.ApprovalManual,
+				Drift:     v1.DriftSpec{Interval: metav1.Duration{Duration: time.Hour}},
+				Policy:    "policy",
+				Source: v1.SourceSpec{
+					Type:  v1.SourceTypeGIT,
+					URL:   "https://example.com/infra.git",
+					Ref:   "master",
+					Token: "vault github-token",
+				},
+				Main: "terraform",
+				State: v1.StateSpec{
+					StorageAccount: "tfstate",
+					Access:         "vault tfstate access-key",
+				},
+				AAD: v1.AADSpec{
+					TenantID:        "tenant",
+					ServerAppID:     "vault aad server-id",
+					ServerAppSecret: "vault aad server-secret",
+					ClientAppID:     "vault aad client-id",
+				},
+				AZ: v1.AZSpec{
+					Subscription:  []v1.AZSubscription{{Name: "dev", ID: "1234"}},
+					ResourceGroup: "rg",
+					VNetCIDR:      "10.20.0.0/16",
+					DNS:           []string{"10.20.0.4"},
+					SubnetNewbits: 4,
+					Outbound:      v1.OutboundUserDefinedRoute,
+					Routes:        []v1.AZRoute{{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"}},
+				},
+				X: map[string]string{"a": "b"},
+			},
+			Defaults: v1.ClusterSpec{
+				Infra: v1.ClusterInfraSpec{
+					Version: "1.20.7",
+					Pools:   map[string]v1.NodepoolSpec{"default": {Scale: 2, VMSize: "Standard_DS2_v2"}},
+					AZ: v1.ClusterAZSpec{
+						SKU:                   v1.SKUPaid,
+						LogAnalyticsWorkspace: &v1.LogAnalyticsWorkspace{SubscriptionName: "dev", Name: "law"},
+					},
+				},
+				Addons: v1.ClusterAddonSpec{
+					Source: v1.SourceSpec{Type: v1.SourceTypeLocal, URL: "/addons"},
+					Jobs:   []string{"all.yaml"},
+					MKV:    "mkv",
+				},
+			},
+			Clusters: []v1.ClusterSpec{
+				{
+					Name: "one",
+					Infra: v1.ClusterInfraSpec{
+						SubnetNum: 1,
+						AZ:        v1.ClusterAZSpec{AvailabilityZones: []int32{1, 2, 3}},
+					},
+					Addons: v1.ClusterAddonSpec{Schedule: "* * * * *", X: map[string]string{"k8sCluster": "one"}},
+				},
+				{
+					Name:  "two",
+					Infra: v1.ClusterInfraSpec{SubnetNum: 2},
+				},
+			},
+			Paused:  true,
+			Rollout: v1.RolloutSpec{Waves: []v1.RolloutWave{{Name: "canary", Clusters: []string{"one"}}}},
+			Windows: []v1.MaintenanceWindow{
+				{Steps: []string{"Infra"}, Start: "0 22 * * MON-FRI", Duration: metav1.Duration{Duration: 4 * time.Hour}, TimeZone: "Europe/Amsterdam"},
+			},
+			Notifications: []v1.NotificationSpec{
+				{Type: v1.NotificationSlack, URL: "vault slack url", States: []v1.StepState{v1.StateError}},
+			},
+		},
+		Status: v1.EnvironmentStatus{
+			Steps: map[string]v1.StepStatus{"Infra": {State: v1.StateReady, Hash: "123"}},
+		},
+	}
+}
+
+func TestEnvironment_roundTripFromHub(t *testing.T) {
+	tests := []struct {
+		it string
+		in *v1.Environment
+	}{
+		{
+			it: "should round trip a fully populated environment",
+			in: testV1(),
+		},
+		{
+			it: "should round trip an empty environment",
+			in: &v1.Environment{},
+		},
+		{
+			it: "should round trip AAD values without AZ values",
+			in: &v1.Environment{Spec: v1.EnvironmentSpec{Infra: v1.InfraSpec{AAD: v1.AADSpec{TenantID: "tenant"}}}},
+		},
+		{
+			it: "should round trip malformed vault references",
+			in: &v1.Environment{Spec: v1.EnvironmentSpec{Infra: v1.InfraSpec{State: v1.StateSpec{Access: "vault a b c d"}}}},
+		},
+		{
+			it: "should round trip vault references with extra whitespace",
+			in: &v1.Environment{Spec: v1.EnvironmentSpec{Infra: v1.InfraSpec{State: v1.StateSpec{Access: "vault  a\tb"}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			spoke := &Environment{}
+			err := spoke.ConvertFrom(tt.in.DeepCopy())
+			assert.NoError(t, err)
+
+			got := &v1.Environment{}
+			err = spoke.ConvertTo(got)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.in, got)
+		})
+	}
+}
+
+func TestEnvironment_roundTripFromSpoke(t *testing.T) {
+	in := &Environment{}
+	err := in.ConvertFrom(testV1())
+	assert.NoError(t, err)
+
+	hub := &v1.Environment{}
+	err = in.DeepCopy().ConvertTo(hub)
+	assert.NoError(t, err)
+
+	got := &Environment{}
+	err = got.ConvertFrom(hub)
+	assert.NoError(t, err)
+
+	assert.Equal(t, in, got)
+}
+
+func TestEnvironment_ConvertFrom(t *testing.T) {
+	got := &Environment{}
+	err := got.ConvertFrom(testV1())
+	assert.NoError(t, err)
+
+	assert.Equal(t, SecretValue{VaultRef: &VaultRef{Name: "github-token"}}, got.Spec.Infra.Source.Token)
+	assert.Equal(t, SecretValue{VaultRef: &VaultRef{Name: "tfstate", Field: "access-key"}}, got.Spec.Infra.State.Access)
+	if assert.NotNil(t, got.Spec.Infra.Provider.Azure) {
+		assert.Equal(t, "rg", got.Spec.Infra.Provider.Azure.ResourceGroup)
+		assert.Equal(t, SecretValue{Value: "tenant"}, got.Spec.Infra.Provider.Azure.AAD.TenantID)
+	}
+	if assert.NotNil(t, got.Spec.Defaults.Infra.Provider.Azure) {
+		assert.Equal(t, v1.SKUPaid, got.Spec.Defaults.Infra.Provider.Azure.SKU)
+	}
+	assert.Nil(t, got.Spec.Clusters[1].Infra.Provider.Azure, "clusters without Azure values should have no Azure block")
+}
+
+func Test_secretValueFrom(t *testing.T) {
+	tests := []struct {
+		in   string
+		want SecretValue
+	}{
+		{in: "", want: SecretValue{}},
+		{in: "literal", want: SecretValue{Value: "literal"}},
+		{in: "vault name", want: SecretValue{VaultRef: &VaultRef{Name: "name"}}},
+		{in: "vault name field", want: SecretValue{VaultRef: &VaultRef{Name: "name", Field: "field"}}},
+		{in: "vault", want: SecretValue{Value: "vault"}},
+		{in: "vault a b c", want: SecretValue{Value: "vault a b c"}},
+		{in: "vault  name", want: SecretValue{Value: "vault  name"}},
+		{in: "vault name field ", want: SecretValue{Value: "vault name field "}},
+		{in: "vaulted", want: SecretValue{Value: "vaulted"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := secretValueFrom(tt.in)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.in, got.String())
+		})
+	}
+}
@@ -0,0 +1,349 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EnvironmentSpec defines the desired state of an Environment.
+type EnvironmentSpec struct {
+	// Paused stops envop from starting steps, steps that are running are allowed to finish.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// Destroy is true when an environment needs to be removed.
+	// Typically used in cluster delete/create test cases.
+	// (in addition to destroy: true a budget.deleteLimit: 99 is required)
+	Destroy bool `json:"destroy,omitempty"`
+
+	// Infra defines infrastructure that much exist before clusters can be created.
+	Infra InfraSpec `json:"infra,omitempty"`
+
+	// Defaults defines the values common to all Clusters.
+	Defaults ClusterSpec `json:"defaults,omitempty"`
+
+	// Clusters defines the values specific for each cluster instance.
+	Clusters []ClusterSpec `json:"clusters,omitempty"`
+
+	// Rollout defines the order in which changes are rolled out over the clusters.
+	// If the rollout spec is omitted all clusters are changed independently of each other.
+	// +optional
+	Rollout v1.RolloutSpec `json:"rollout,omitempty"`
+
+	// Windows are the maintenance windows in which steps are allowed to start.
+	// +optional
+	Windows []v1.MaintenanceWindow `json:"windows,omitempty"`
+
+	// Notifications are the sinks that are notified when a step changes state.
+	// +optional
+	Notifications []v1.NotificationSpec `json:"notifications,omitempty"`
+}
+
+// InfraSpec defines the infrastructure that is used by all clusters.
+type InfraSpec struct {
+	// EnvName is the name of this environment.
+	// Typically a concatenation of region, cloud provider and environment type (test, production).
+	EnvName string `json:"envName,omitempty"`
+
+	// EnvDomain is the most significant part of the domain name for this environment.
+	// For example; example.com
+	EnvDomain string `json:"envDomain,omitempty"`
+
+	// Budget defines how many changes the operator is allowed to apply to the infra.
+	// If the budget spec is omitted any number of changes is allowed.
+	// +optional
+	Budget v1.InfraBudget `json:"budget,omitempty"`
+
+	// Schedule is a CRON formatted string defining when changed can be applied.
+	// If the schedule is omitted then changes will be applied immediately.
+	// Deprecated: use spec.windows
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Approval selects if a terraform plan needs to be approved before it's applied.
+	// +optional
+	Approval v1.ApprovalMode `json:"approval,omitempty"`
+
+	// Drift defines the periodic check for differences between the infrastructure and the terraform code.
+	// If the drift spec is omitted drift is not checked.
+	// +optional
+	Drift v1.DriftSpec `json:"drift,omitempty"`
+
+	// Policy is the path relative to Main of a directory with policy files, the directory must be in the infra source.
+	// If the policy is omitted no rules are evaluated, a policy directory that is missing or empty results in an error.
+	// +optional
+	Policy string `json:"policy,omitempty"`
+
+	// Source is the repository that contains Terraform infrastructure code.
+	Source SourceSpec `json:"source,omitempty"`
+
+	// Main is the path in the source tree to the directory containing main.tf.
+	Main string `json:"main,omitempty"`
+
+	// State is where Terraform state is stored.
+	// If the state spec is omitted the state is stored locally.
+	// +optional
+	State StateSpec `json:"state,omitempty"`
+
+	// Provider contains cloud provider specific values.
+	Provider InfraProviderSpec `json:"provider,omitempty"`
+
+	// X are extension values (when regular values don't fit the need)
+	// +optional
+	X map[string]string `json:"x,omitempty"`
+}
+
+// InfraProviderSpec contains the cloud provider specific infrastructure settings.
+// Exactly one provider is expected to be set.
+type InfraProviderSpec struct {
+	// Azure contains Azure specific values.
+	// +optional
+	Azure *AzureInfraSpec `json:"azure,omitempty"`
+}
+
+// AzureInfraSpec defines Azure specific infra structure settings.
+type AzureInfraSpec struct {
+	// Subscription is a list of one or more subscriptions used during provisioning.
+	// The first subscription is the default subscription.
+	Subscription []v1.AZSubscription `json:"subscription,omitempty"`
+
+	// ResourceGroup
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+
+	// VNet CIDR is the network range used by one or more clusters.
+	VNetCIDR string `json:"vnetCIDR,omitempty"`
+
+	// DNS is an optional list of custom DNS servers.
+	// (VM's in VNet need to be restarted to propagate changes to this value)
+	// +optional
+	DNS []string `json:"dns,omitempty"`
+
+	// Subnet newbits is the number of bits to add to the VNet address mask to produce the subnet mask.
+	// IOW 2^subnetNewbits-1 is the max number of clusters in the VNet.
+	// For example given a /16 VNetCIDR and subnetNewbits=4 would result in /20 subnets.
+	SubnetNewbits int32 `json:"subnetNewbits,omitempty"`
+
+	// Outbound sets the network outbound type.
+	// Valid values are:
+	// - loadBalancer (default)
+	// - userDefinedRouting
+	// +kubebuilder:validation:Enum=loadBalancer;userDefinedRouting
+	Outbound v1.AZOutbound `json:"outbound,omitempty"`
+
+	// Routes is an optional list of routes
+	// +optional
+	Routes []v1.AZRoute `json:"routes,omitempty"`
+
+	// AAD is the Azure Active Directory that is queried when a k8s user authorization is checked.
+	AAD AADSpec `json:"aad,omitempty"`
+}
+
+// AADSpec defines the Azure Active Directory applications.
+type AADSpec struct {
+	// TenantID is the AD tenant.
+	TenantID SecretValue `json:"tenantID,omitempty"`
+	// ServerAppID is an app registration allowed to query AD for user data.
+	ServerAppID SecretValue `json:"serverAppID,omitempty"`
+	// ServerAppSecret is the secret of an app registration allowed to query AD for user data.
+	ServerAppSecret SecretValue `json:"serverAppSecret,omitempty"`
+	// ClientAppID is the app registration used by kubectl.
+	ClientAppID SecretValue `json:"clientAppID,omitempty"`
+}
+
+// SecretValue is a literal value or a reference to a value in a vault.
+// When VaultRef is set Value is ignored.
+type SecretValue struct {
+	// Value is the literal value.
+	// +optional
+	Value string `json:"value,omitempty"`
+
+	// VaultRef refers to the value in a vault.
+	// +optional
+	VaultRef *VaultRef `json:"vaultRef,omitempty"`
+}
+
+// VaultRef refers to a secret in the vault the operator is configured with.
+type VaultRef struct {
+	// Name is the name of the secret.
+	Name string `json:"name"`
+
+	// Field selects a field of a secret that contains a JSON object.
+	// If the field is omitted the whole secret is used.
+	// +optional
+	Field string `json:"field,omitempty"`
+}
+
+// SourceSpec defines the location to fetch content like configuration scripts and tests from.
+type SourceSpec struct {
+	// Type is the type of repository to use as a source.
+	// Valid values are:
+	// - "git" (default): GIT repository.
+	// - "local": local filesystem.
+	// +optional
+	Type v1.EnvironmentSourceType `json:"type,omitempty"`
+
+	// For type=git URL is the URL of the repo.
+	// When Token is specified the URL is expected to start with 'https://'.
+	//
+	// For type=local URL is path to a directory.
+	// +optional
+	URL string `json:"url"`
+
+	// Ref is the reference to the content to get.
+	// For type=git it can be 'master', 'refs/heads/my-branch' etc, see 'git reference' doc.
+	// For type=local the value can be omitted.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Token is used to authenticate with the remote server (only applicable when Type=git)
+	// An alternative authentication method is to have an SSH key present in ~/.ssh.
+	// +optional
+	Token SecretValue `json:"token,omitempty"`
+
+	// Area is a directory path to the part of the repo that contains the required contents.
+	// Typically area is empty indicating that the whole repo is used.
+	// +optional
+	Area string `json:"area,omitempty"`
+}
+
+// StateSpec specifies where to find the Terraform state storage.
+// +optional
+type StateSpec struct {
+	// StorageAccount is the name of the Storage Account.
+	StorageAccount string `json:"storageAccount,omitempty"`
+	// Access is the secret that allows access to the storage account.
+	Access SecretValue `json:"access,omitempty"`
+}
+
+// ClusterSpec defines cluster specific infra and k8s resources.
+type ClusterSpec struct {
+	// Name is the cluster name.
+	Name string `json:"name,omitempty"`
+
+	// Infra defines cluster specific infrastructure.
+	Infra ClusterInfraSpec `json:"infra,omitempty"`
+
+	// ClusterAddonSpec defines the Kubernetes resources to deploy to have a functioning cluster.
+	Addons ClusterAddonSpec `json:"addons,omitempty"`
+}
+
+// ClusterInfraSpec defines cluster specific infrastructure.
+type ClusterInfraSpec struct {
+	// Cluster ordinal number starting at 1.
+	// (max 2^subnetNewbits-1)
+	// +kubebuilder:validation:Minimum=1
+	SubnetNum int32 `json:"subnetNum,omitempty"`
+
+	// Kubernetes version.
+	Version string `json:"version,omitempty"`
+
+	// Cluster worker pools.
+	// NB. For AKS a pool named 'default' must be defined.
+	Pools map[string]v1.NodepoolSpec `json:"pools,omitempty"`
+
+	// Provider contains cloud provider specific values for clusters.
+	// +optional
+	Provider ClusterProviderSpec `json:"provider,omitempty"`
+
+	// X are extension values (when regular values don't fit the need)
+	// +optional
+	X map[string]string `json:"x,omitempty"`
+}
+
+// ClusterProviderSpec contains the cloud provider specific cluster settings.
+type ClusterProviderSpec struct {
+	// Azure contains Azure specific values for clusters.
+	// +optional
+	Azure *AzureClusterSpec `json:"azure,omitempty"`
+}
+
+// AzureClusterSpec contains Azure specific values for clusters.
+type AzureClusterSpec struct {
+	// AvailabilityZones are the zones in a region over which nodes and control plane are spread.
+	// For example [1,2,3]
+	// +optional
+	AvailabilityZones []int32 `json:"availabilityZones,omitempty"`
+
+	// SKU (stock keeping unit) sets the SLA on the AKS control plane.
+	// Valid values are:
+	// - Free (default)
+	// - Paid
+	// +optional
+	// +kubebuilder:validation:Enum=Free;Paid
+	SKU v1.AZSKU `json:"sku,omitempty"`
+
+	// ServiceEndpoints provide direct connectivity to Azure services over the Azure backbone network.
+	// +optional
+	ServiceEndpoints []v1.AZServiceEndpoint `json:"serviceEndpoints,omitempty"`
+
+	// LogAnalyticsWorkspace is a sink for Kubernetes control plane log data.
+	// +optional
+	LogAnalyticsWorkspace *v1.LogAnalyticsWorkspace `json:"logAnalyticsWorkspace,omitempty"`
+}
+
+// ClusterAddonSpec defines what K8s resources needs to be deployed in a cluster after creation.
+type ClusterAddonSpec struct {
+	// Schedule is a CRON formatted string defining when changed can be applied.
+	// If the schedule is omitted then changes will be applied immediately.
+	// Deprecated: use spec.windows
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Source is the repository that contains the k8s addons resources.
+	Source SourceSpec `json:"source,omitempty"`
+
+	// Jobs is an array of paths to job files in the source tree.
+	Jobs []string `json:"jobs,omitempty"`
+
+	// MKV is the path to a directory in the source tree that specifies the master key vault to use.
+	MKV string `json:"mkv,omitempty"`
+
+	// X are extension values (when regular values don't fit the need)
+	// +optional
+	X map[string]string `json:"x,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:unservedversion
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message"
+// +kubebuilder:printcolumn:name="Paused",type="boolean",JSONPath=".spec.paused",priority=1
+// +kubebuilder:printcolumn:name="Next Window",type="string",JSONPath=".status.nextWindowStart",priority=1
+
+// Environment is an environment at a cloud-provider with one or more Kubernetes clusters, addons, conformance tested.
+type Environment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EnvironmentSpec      `json:"spec,omitempty"`
+	Status v1.EnvironmentStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EnvironmentList contains a list of Environments.
+type EnvironmentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Environment `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Environment{}, &EnvironmentList{})
+}
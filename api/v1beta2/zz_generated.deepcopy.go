@@ -0,0 +1,412 @@
+// +build !ignore_autogenerated
+
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1beta2
+
+import (
+	"github.com/mmlt/environment-operator/api/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AADSpec) DeepCopyInto(out *AADSpec) {
+	*out = *in
+	in.TenantID.DeepCopyInto(&out.TenantID)
+	in.ServerAppID.DeepCopyInto(&out.ServerAppID)
+	in.ServerAppSecret.DeepCopyInto(&out.ServerAppSecret)
+	in.ClientAppID.DeepCopyInto(&out.ClientAppID)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AADSpec.
+func (in *AADSpec) DeepCopy() *AADSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AADSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureClusterSpec) DeepCopyInto(out *AzureClusterSpec) {
+	*out = *in
+	if in.AvailabilityZones != nil {
+		in, out := &in.AvailabilityZones, &out.AvailabilityZones
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceEndpoints != nil {
+		in, out := &in.ServiceEndpoints, &out.ServiceEndpoints
+		*out = make([]v1.AZServiceEndpoint, len(*in))
+		copy(*out, *in)
+	}
+	if in.LogAnalyticsWorkspace != nil {
+		in, out := &in.LogAnalyticsWorkspace, &out.LogAnalyticsWorkspace
+		*out = new(v1.LogAnalyticsWorkspace)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureClusterSpec.
+func (in *AzureClusterSpec) DeepCopy() *AzureClusterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureClusterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureInfraSpec) DeepCopyInto(out *AzureInfraSpec) {
+	*out = *in
+	if in.Subscription != nil {
+		in, out := &in.Subscription, &out.Subscription
+		*out = make([]v1.AZSubscription, len(*in))
+		copy(*out, *in)
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]v1.AZRoute, len(*in))
+		copy(*out, *in)
+	}
+	in.AAD.DeepCopyInto(&out.AAD)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureInfraSpec.
+func (in *AzureInfraSpec) DeepCopy() *AzureInfraSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureInfraSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAddonSpec) DeepCopyInto(out *ClusterAddonSpec) {
+	*out = *in
+	in.Source.DeepCopyInto(&out.Source)
+	if in.Jobs != nil {
+		in, out := &in.Jobs, &out.Jobs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.X != nil {
+		in, out := &in.X, &out.X
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAddonSpec.
+func (in *ClusterAddonSpec) DeepCopy() *ClusterAddonSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAddonSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterInfraSpec) DeepCopyInto(out *ClusterInfraSpec) {
+	*out = *in
+	if in.Pools != nil {
+		in, out := &in.Pools, &out.Pools
+		*out = make(map[string]v1.NodepoolSpec, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	in.Provider.DeepCopyInto(&out.Provider)
+	if in.X != nil {
+		in, out := &in.X, &out.X
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterInfraSpec.
+func (in *ClusterInfraSpec) DeepCopy() *ClusterInfraSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterInfraSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterProviderSpec) DeepCopyInto(out *ClusterProviderSpec) {
+	*out = *in
+	if in.Azure != nil {
+		in, out := &in.Azure, &out.Azure
+		*out = new(AzureClusterSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterProviderSpec.
+func (in *ClusterProviderSpec) DeepCopy() *ClusterProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
+	*out = *in
+	in.Infra.DeepCopyInto(&out.Infra)
+	in.Addons.DeepCopyInto(&out.Addons)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSpec.
+func (in *ClusterSpec) DeepCopy() *ClusterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Environment) DeepCopyInto(out *Environment) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Environment.
+func (in *Environment) DeepCopy() *Environment {
+	if in == nil {
+		return nil
+	}
+	out := new(Environment)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Environment) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvironmentList) DeepCopyInto(out *EnvironmentList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Environment, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvironmentList.
+func (in *EnvironmentList) DeepCopy() *EnvironmentList {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvironmentList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EnvironmentList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvironmentSpec) DeepCopyInto(out *EnvironmentSpec) {
+	*out = *in
+	in.Infra.DeepCopyInto(&out.Infra)
+	in.Defaults.DeepCopyInto(&out.Defaults)
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]ClusterSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Rollout.DeepCopyInto(&out.Rollout)
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]v1.MaintenanceWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Notifications != nil {
+		in, out := &in.Notifications, &out.Notifications
+		*out = make([]v1.NotificationSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvironmentSpec.
+func (in *EnvironmentSpec) DeepCopy() *EnvironmentSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvironmentSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfraProviderSpec) DeepCopyInto(out *InfraProviderSpec) {
+	*out = *in
+	if in.Azure != nil {
+		in, out := &in.Azure, &out.Azure
+		*out = new(AzureInfraSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfraProviderSpec.
+func (in *InfraProviderSpec) DeepCopy() *InfraProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InfraProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfraSpec) DeepCopyInto(out *InfraSpec) {
+	*out = *in
+	in.Budget.DeepCopyInto(&out.Budget)
+	out.Drift = in.Drift
+	in.Source.DeepCopyInto(&out.Source)
+	in.State.DeepCopyInto(&out.State)
+	in.Provider.DeepCopyInto(&out.Provider)
+	if in.X != nil {
+		in, out := &in.X, &out.X
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfraSpec.
+func (in *InfraSpec) DeepCopy() *InfraSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InfraSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretValue) DeepCopyInto(out *SecretValue) {
+	*out = *in
+	if in.VaultRef != nil {
+		in, out := &in.VaultRef, &out.VaultRef
+		*out = new(VaultRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretValue.
+func (in *SecretValue) DeepCopy() *SecretValue {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretValue)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceSpec) DeepCopyInto(out *SourceSpec) {
+	*out = *in
+	in.Token.DeepCopyInto(&out.Token)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceSpec.
+func (in *SourceSpec) DeepCopy() *SourceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StateSpec) DeepCopyInto(out *StateSpec) {
+	*out = *in
+	in.Access.DeepCopyInto(&out.Access)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StateSpec.
+func (in *StateSpec) DeepCopy() *StateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultRef) DeepCopyInto(out *VaultRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultRef.
+func (in *VaultRef) DeepCopy() *VaultRef {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultRef)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -161,6 +161,10 @@ func waitReady(ctx context.Context, client xclientset.Interface, namespace, name
 				return nil
 			case v1.ReasonFailed:
 				return fmt.Errorf("an envop step failed") //TODO we can give a better message; check Steps and print message
+			case v1.ReasonAwaitingApproval:
+				fmt.Println("waiting for plan approval:", c.Message)
+			case v1.ReasonScheduled:
+				fmt.Println("waiting for maintenance window:", c.Message)
 			case "", v1.ReasonRunning:
 				// NOP
 			default:
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	v1 "github.com/mmlt/environment-operator/api/clusterops/v1"
+	"io/ioutil"
 	"os"
 )
 
@@ -31,6 +32,22 @@ func exitOnError(err error) {
 	}
 }
 
+// SecretVersionKey returns the contents of keyFile or when keyFile is empty the contents of credentialsFile.
+// The key is used to derive the secret versions in the Environment status from the secret values.
+func secretVersionKey(keyFile, credentialsFile string) ([]byte, error) {
+	if keyFile == "" {
+		keyFile = credentialsFile
+	}
+	b, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%s: empty key", keyFile)
+	}
+	return b, nil
+}
+
 // StatusCondition returns the named condition from environment.status.conditions.
 func statusCondition(environment *v1.Environment, condition string) (*v1.EnvironmentCondition, bool) {
 	if environment == nil {
@@ -1,21 +1,29 @@
 package cmd
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	clusteropsv1 "github.com/mmlt/environment-operator/api/v1"
+	clusteropsv1beta2 "github.com/mmlt/environment-operator/api/v1beta2"
 	"github.com/mmlt/environment-operator/controllers"
+	"github.com/mmlt/environment-operator/pkg/artefact"
 	"github.com/mmlt/environment-operator/pkg/client/addon"
 	"github.com/mmlt/environment-operator/pkg/client/azure"
 	"github.com/mmlt/environment-operator/pkg/client/kubectl"
 	"github.com/mmlt/environment-operator/pkg/client/terraform"
 	"github.com/mmlt/environment-operator/pkg/cloud"
 	"github.com/mmlt/environment-operator/pkg/cluster"
+	"github.com/mmlt/environment-operator/pkg/notify"
 	"github.com/mmlt/environment-operator/pkg/plan"
+	"github.com/mmlt/environment-operator/pkg/redact"
+	"github.com/mmlt/environment-operator/pkg/secret"
 	"github.com/mmlt/environment-operator/pkg/source"
 	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/mmlt/environment-operator/pkg/tracing"
 	"github.com/mmlt/environment-operator/pkg/util"
 	"github.com/spf13/cobra"
+	"io/ioutil"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -23,6 +31,7 @@ import (
 	"k8s.io/klog/klogr"
 	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
 	"time"
 )
 
@@ -36,8 +45,23 @@ func NewCmdController() *cobra.Command {
 		selector             string
 		syncPeriodInMin      int
 		allowedSteps         string
+		maxParallelSteps     int
+		maxRuns              int
+		artefactDir          string
+		artefactURL          string
+		artefactAPI          string
+		artefactRetention    int
+		enableWebhooks       bool
+		secretDir            string
+		secretEnvPrefix      string
+		hcvaultAddr          string
 		enableLeaderElection bool
 		metricsAddr          string
+		otlpEndpoint         string
+		otlpInsecure         bool
+		notificationsFile    string
+		notifyRetries        int
+		secretVersionKeyFile string
 	)
 
 	command := cobra.Command{
@@ -46,9 +70,22 @@ func NewCmdController() *cobra.Command {
 		Example: `
 `,
 		RunE: func(c *cobra.Command, args []string) error {
-			log := klogr.New()
+			log := redact.Logger(klogr.New())
 			ctrl.SetLogger(log)
 
+			if otlpEndpoint != "" {
+				shutdown, err := tracing.Setup(context.Background(), otlpEndpoint, otlpInsecure)
+				if err != nil {
+					return fmt.Errorf("flag --otlp-endpoint: %w", err)
+				}
+				defer func() {
+					err := shutdown(context.Background())
+					if err != nil {
+						log.Error(err, "shutdown tracing")
+					}
+				}()
+			}
+
 			labelSet := labels.Set{}
 			if selector != "" {
 				labelSet[LabelKey] = selector
@@ -59,10 +96,16 @@ func NewCmdController() *cobra.Command {
 				return fmt.Errorf("flag --allowed-steps: %w", err)
 			}
 
+			versionKey, err := secretVersionKey(secretVersionKeyFile, credentialsFile)
+			if err != nil {
+				return fmt.Errorf("flag --secret-version-key-file: %w", err)
+			}
+
 			// Setup manager.
 			scheme := runtime.NewScheme()
 			_ = clientgoscheme.AddToScheme(scheme)
 			_ = clusteropsv1.AddToScheme(scheme)
+			_ = clusteropsv1beta2.AddToScheme(scheme)
 
 			p := time.Duration(syncPeriodInMin) * time.Minute
 			mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
@@ -91,10 +134,57 @@ func NewCmdController() *cobra.Command {
 			r := &controllers.EnvironmentReconciler{
 				Client:   mgr.GetClient(),
 				Scheme:   mgr.GetScheme(),
-				Recorder: mgr.GetEventRecorderFor("envop"),
+				Recorder: redact.EventRecorder(mgr.GetEventRecorderFor("envop")),
 				LabelSet: labelSet,
 				Environ:  util.KVSliceToMap(os.Environ()),
 				Cloud:    cl,
+
+				SecretVersionKey: versionKey,
+
+				MaxParallelSteps:  maxParallelSteps,
+				MaxRuns:           maxRuns,
+				ArtefactRetention: artefactRetention,
+			}
+			switch {
+			case artefactDir != "" && artefactURL != "":
+				return fmt.Errorf("flags --artefact-dir and --artefact-url are mutually exclusive")
+			case artefactDir != "":
+				r.Artefacts = artefact.Dir{Path: artefactDir}
+			case artefactURL != "":
+				api := artefact.API(artefactAPI)
+				if api != artefact.APIS3 && api != artefact.APIAzure {
+					return fmt.Errorf("flag --artefact-api: expected %s or %s, got %q", artefact.APIS3, artefact.APIAzure, artefactAPI)
+				}
+				creds, err := s3Credentials(r.Environ)
+				if err != nil {
+					return fmt.Errorf("flag --artefact-url: %w", err)
+				}
+				r.Artefacts = artefact.HTTP{URL: artefactURL, API: api, S3Credentials: creds}
+			}
+			r.Notifier = &notify.Notifier{
+				Retries: notifyRetries,
+				Log:     l.WithName("notify"),
+			}
+			if notificationsFile != "" {
+				r.Notifier.Targets, err = notifyTargetsFromFile(notificationsFile)
+				if err != nil {
+					return fmt.Errorf("flag --notifications-file: %w", err)
+				}
+			}
+			r.Secrets = &secret.Mux{
+				Default: secret.Cloud{Cloud: cl},
+				Backends: map[string]secret.Resolver{
+					"k8s": secret.Kubernetes{Reader: mgr.GetAPIReader()},
+				},
+			}
+			if secretDir != "" {
+				r.Secrets.Backends["file"] = secret.File{RootPath: secretDir}
+			}
+			if secretEnvPrefix != "" {
+				r.Secrets.Backends["env"] = secret.Env{Environ: r.Environ, Prefix: secretEnvPrefix}
+			}
+			if hcvaultAddr != "" {
+				r.Secrets.Backends["hcvault"] = secret.HCVault{Address: hcvaultAddr, Token: os.Getenv("VAULT_TOKEN")}
 			}
 			r.Sources = &source.Sources{
 				RootPath: workDir,
@@ -123,6 +213,18 @@ func NewCmdController() *cobra.Command {
 				return fmt.Errorf("unable to create controller: %w", err)
 			}
 
+			if enableWebhooks {
+				err = (&controllers.EnvironmentValidator{}).SetupWithManager(mgr)
+				if err != nil {
+					return fmt.Errorf("unable to create webhook: %w", err)
+				}
+				// Serve conversion between Environment versions.
+				err = ctrl.NewWebhookManagedBy(mgr).For(&clusteropsv1.Environment{}).Complete()
+				if err != nil {
+					return fmt.Errorf("unable to create conversion webhook: %w", err)
+				}
+			}
+
 			err = mgr.Start(ctrl.SetupSignalHandler())
 			if err != nil {
 				return fmt.Errorf("problem running manager: %w", err)
@@ -156,11 +258,106 @@ func NewCmdController() *cobra.Command {
 	command.Flags().StringVar(&allowedSteps, "allowed-steps", "",
 		"a comma separated list of steps that are allowed to executed, empty allows all steps\n"+
 			fmt.Sprintf("valid values: %v", step.Types))
+	command.Flags().IntVar(&maxParallelSteps, "max-parallel-steps", 1,
+		"the max. number of steps of an environment that are executed at the same time.\n"+
+			"steps of different clusters are independent and can be executed in parallel.")
+	command.Flags().IntVar(&maxRuns, "max-runs", 20,
+		"the max. number of EnvironmentRuns that are kept per environment, 0 disables EnvironmentRuns.")
+	command.Flags().StringVar(&artefactDir, "artefact-dir", "",
+		"directory (typically a persistent volume) to archive step artefacts like terraform plans to.")
+	command.Flags().StringVar(&artefactURL, "artefact-url", "",
+		"URL of the S3 bucket or Azure Blob container to archive step artefacts like terraform plans to.\n"+
+			"S3 requests are signed when environment variable AWS_ACCESS_KEY_ID is set (with AWS_SECRET_ACCESS_KEY, AWS_REGION\n"+
+			"and optionally AWS_SESSION_TOKEN).\n"+
+			"the query of the URL is used for authorization, for example an Azure SAS token.")
+	command.Flags().StringVar(&artefactAPI, "artefact-api", string(artefact.APIS3),
+		fmt.Sprintf("the API of --artefact-url, valid values: %s, %s", artefact.APIS3, artefact.APIAzure))
+	command.Flags().IntVar(&artefactRetention, "artefact-retention", 10,
+		"the max. number of runs per step that artefacts are kept for, 0 keeps all.")
+
+	command.Flags().StringVar(&notificationsFile, "notifications-file", "",
+		"YAML file with a list of notifications that receive the step state changes of all environments.\n"+
+			"the format is the same as Environment spec.notifications but url and secret must be literal values, vault references are rejected.\n"+
+			"mount the file from a Kubernetes Secret to keep the webhook tokens secret.")
+	command.Flags().IntVar(&notifyRetries, "notify-retries", 5,
+		"the number of times a failed notification is retried.")
+
+	command.Flags().BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"serve the validating admission and conversion webhooks for Environment resources on port 9443.\n"+
+			"the webhook server expects a TLS certificate and key in /tmp/k8s-webhook-server/serving-certs")
+
+	command.Flags().StringVar(&secretDir, "secret-dir", "",
+		"directory with secrets that can be referenced as 'vault file:name [field]'.\n"+
+			"when empty file references are disabled.")
+	command.Flags().StringVar(&secretEnvPrefix, "secret-env-prefix", "",
+		"prefix of the environment variables that can be referenced as 'vault env:name [field]' (the prefix is omitted from name).\n"+
+			"when empty environment variable references are disabled.")
+	command.Flags().StringVar(&secretVersionKeyFile, "secret-version-key-file", "",
+		"file with the key that is used to derive the secret versions in the Environment status from the secret values.\n"+
+			"when empty the --credentials-file is used as key. changing the key makes the steps that use secrets run again.")
+	command.Flags().StringVar(&hcvaultAddr, "hcvault-addr", "",
+		"address of the HashiCorp Vault server with secrets that can be referenced as 'vault hcvault:mount/path [field]'.\n"+
+			"the token to access Vault is read from environment variable VAULT_TOKEN.\n"+
+			"when empty HashiCorp Vault references are disabled.")
 
 	command.Flags().BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	command.Flags().StringVar(&metricsAddr, "metrics-addr", ":8080",
 		"address the metric endpoint binds to.")
+	command.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"host:port of the OpenTelemetry collector to export traces to using OTLP/HTTP, empty disables tracing.")
+	command.Flags().BoolVar(&otlpInsecure, "otlp-insecure", false,
+		"use HTTP instead of HTTPS to export traces.")
 
 	return &command
 }
+
+// S3Credentials returns the AWS credentials in environ or nil when AWS_ACCESS_KEY_ID isn't set.
+func s3Credentials(environ map[string]string) (*artefact.S3Credentials, error) {
+	id := environ["AWS_ACCESS_KEY_ID"]
+	if id == "" {
+		return nil, nil
+	}
+	r := &artefact.S3Credentials{
+		AccessKeyID:     id,
+		SecretAccessKey: environ["AWS_SECRET_ACCESS_KEY"],
+		SessionToken:    environ["AWS_SESSION_TOKEN"],
+		Region:          environ["AWS_REGION"],
+	}
+	if r.Region == "" {
+		r.Region = environ["AWS_DEFAULT_REGION"]
+	}
+	if r.SecretAccessKey == "" || r.Region == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID requires AWS_SECRET_ACCESS_KEY and AWS_REGION")
+	}
+	return r, nil
+}
+
+// NotifyTargetsFromFile returns the notification targets specified in a YAML file.
+// The file must contain literal values, vault references are rejected.
+func notifyTargetsFromFile(filename string) ([]notify.Target, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var specs []clusteropsv1.NotificationSpec
+	err = yaml.UnmarshalStrict(b, &specs)
+	if err != nil {
+		return nil, err
+	}
+	var r []notify.Target
+	for i, spec := range specs {
+		for _, v := range []string{spec.URL, spec.Secret} {
+			if _, ok, _ := secret.ParseRef(v); ok {
+				return nil, fmt.Errorf("notifications[%d]: vault references are not supported, use a literal value", i)
+			}
+		}
+		redact.Add(spec.URL, spec.Secret)
+		t, err := notify.TargetFromSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, t)
+	}
+	return r, nil
+}
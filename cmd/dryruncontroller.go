@@ -12,6 +12,7 @@ import (
 	"github.com/mmlt/environment-operator/pkg/cloud"
 	"github.com/mmlt/environment-operator/pkg/cluster"
 	"github.com/mmlt/environment-operator/pkg/plan"
+	"github.com/mmlt/environment-operator/pkg/redact"
 	"github.com/mmlt/environment-operator/pkg/source"
 	"github.com/mmlt/environment-operator/pkg/step"
 	"github.com/spf13/cobra"
@@ -48,7 +49,7 @@ Because the dryruncontroller works with fake data the processed environment(yaml
 		Example: `
 `,
 		RunE: func(c *cobra.Command, args []string) error {
-			log := klogr.New()
+			log := redact.Logger(klogr.New())
 			ctrl.SetLogger(log)
 
 			labelSet := labels.Set{}
@@ -84,7 +85,7 @@ Because the dryruncontroller works with fake data the processed environment(yaml
 			r := &controllers.EnvironmentReconciler{
 				Client:   mgr.GetClient(),
 				Scheme:   mgr.GetScheme(),
-				Recorder: mgr.GetEventRecorderFor("envop"),
+				Recorder: redact.EventRecorder(mgr.GetEventRecorderFor("envop")),
 				LabelSet: labelSet,
 				Environ: map[string]string{
 					"PATH": "/usr/local/bin", //kubectl-tmplt uses kubectl
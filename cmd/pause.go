@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "github.com/mmlt/environment-operator/api/clusterops/v1"
+	xclientset "github.com/mmlt/environment-operator/pkg/generated/clientset/versioned"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/klog/v2"
+)
+
+// NewCmdPause returns a command to pause an environment.
+func NewCmdPause() *cobra.Command {
+	return newCmdSetPaused(true, cobra.Command{
+		Use:   "pause [--namespace name] environment-name",
+		Short: "Pause an environment so no new steps are started",
+		Long: `Pause an environment so no new steps are started.
+Steps that are running are allowed to finish.
+The Environment Paused condition shows if the environment is paused.`,
+	})
+}
+
+// NewCmdResume returns a command to resume a paused environment.
+func NewCmdResume() *cobra.Command {
+	return newCmdSetPaused(false, cobra.Command{
+		Use:   "resume [--namespace name] environment-name",
+		Short: "Resume a paused environment",
+		Long: `Resume a paused environment.
+Steps that are not at their desired state are started again.`,
+	})
+}
+
+// NewCmdSetPaused returns cmd with a Run function that sets the environment spec.paused field to paused.
+func newCmdSetPaused(paused bool, cmd cobra.Command) *cobra.Command {
+	kubeConfigFlags := genericclioptions.NewConfigFlags(true)
+
+	cmd.Args = cobra.ExactArgs(1)
+	cmd.Run = func(c *cobra.Command, args []string) {
+		cfg, err := kubeConfigFlags.ToRESTConfig()
+		exitOnError(err)
+
+		xClient, err := xclientset.NewForConfig(cfg)
+		exitOnError(err)
+
+		name := args[0]
+		namespace := "default"
+		if *kubeConfigFlags.Namespace != "" {
+			namespace = *kubeConfigFlags.Namespace
+		}
+
+		_, err = setPaused(context.Background(), xClient, namespace, name, paused)
+		exitOnError(err)
+
+		if paused {
+			fmt.Println("paused:", name)
+		} else {
+			fmt.Println("resumed:", name)
+		}
+	}
+
+	// Add klog flags to cobra command.
+	fs := flag.NewFlagSet("", flag.PanicOnError)
+	klog.InitFlags(fs)
+	cmd.Flags().AddGoFlagSet(fs)
+
+	kubeConfigFlags.AddFlags(cmd.Flags())
+
+	return &cmd
+}
+
+// SetPaused patches the spec.paused field of an environment.
+func setPaused(ctx context.Context, client xclientset.Interface, namespace, name string, paused bool) (*v1.Environment, error) {
+	patch := fmt.Sprintf(`{"spec":{"paused":%t}}`, paused)
+	return client.
+		ClusteropsV1().
+		Environments(namespace).
+		Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	clusteropsv1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/controllers"
+	"github.com/mmlt/environment-operator/pkg/client/addon"
+	"github.com/mmlt/environment-operator/pkg/client/azure"
+	"github.com/mmlt/environment-operator/pkg/client/kubectl"
+	"github.com/mmlt/environment-operator/pkg/client/terraform"
+	"github.com/mmlt/environment-operator/pkg/cloud"
+	"github.com/mmlt/environment-operator/pkg/cluster"
+	"github.com/mmlt/environment-operator/pkg/plan"
+	"github.com/mmlt/environment-operator/pkg/redact"
+	"github.com/mmlt/environment-operator/pkg/secret"
+	"github.com/mmlt/environment-operator/pkg/source"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/mmlt/environment-operator/pkg/util"
+	"github.com/spf13/cobra"
+	"io"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	"k8s.io/klog/klogr"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+	"strings"
+	"text/tabwriter"
+)
+
+// NewCmdPlan returns a command to show what the controller would do with an environment.
+func NewCmdPlan() *cobra.Command {
+	// flags
+	var (
+		filename        string
+		offline         bool
+		allowedSteps    string
+		credentialsFile string
+		vault           string
+		secretDir       string
+		secretEnvPrefix string
+		tfPlan          bool
+		versionKeyFile  string
+	)
+	kubeConfigFlags := genericclioptions.NewConfigFlags(true)
+
+	cmd := cobra.Command{
+		Use:   "plan -f file [--offline] [--terraform]",
+		Short: "Show the steps envop would run for an environment",
+		Long: `Plan an environment like the envop controller does and show which steps would run and why.
+Sources are fetched to a scratch directory, nothing is executed or written to the cluster.
+The status of the applied environment is read from the cluster unless --offline is set.
+
+Without --credentials-file and --vault the references to the default vault are resolved to fake values,
+this changes the hash of steps that use these values so they are reported as changed.
+Without --secret-version-key-file and --credentials-file rotated secrets are not reported because the secret versions
+can't be compared with the versions the controller recorded.
+With --terraform a terraform plan of the Infra step is made in the scratch directory and summarized.`,
+		Run: func(c *cobra.Command, args []string) {
+			log := redact.Logger(klogr.New())
+
+			var b []byte
+			var err error
+			if filename == "-" {
+				b, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				b, err = ioutil.ReadFile(filename)
+			}
+			exitOnError(err)
+
+			environment := &clusteropsv1.Environment{}
+			err = yaml.Unmarshal(b, environment)
+			exitOnError(err)
+			if *kubeConfigFlags.Namespace != "" {
+				environment.Namespace = *kubeConfigFlags.Namespace
+			}
+			if environment.Namespace == "" {
+				environment.Namespace = "default"
+			}
+
+			steps, err := step.TypesFromString(allowedSteps)
+			exitOnError(err)
+
+			if tfPlan && (credentialsFile == "" || vault == "") {
+				exitOnError(fmt.Errorf("flag --terraform requires --credentials-file and --vault"))
+			}
+
+			workDir, err := ioutil.TempDir("", "envop-plan")
+			exitOnError(err)
+			defer os.RemoveAll(workDir)
+
+			var cl cloud.Cloud = &cloud.Fake{}
+			if credentialsFile != "" && vault != "" {
+				cl = &cloud.Azure{
+					CredentialsFile: credentialsFile,
+					Vault:           vault,
+					Client:          &azure.AZ{Log: log},
+					Log:             log,
+				}
+			}
+
+			r := &controllers.EnvironmentReconciler{
+				Recorder: &record.FakeRecorder{},
+				Environ:  util.KVSliceToMap(os.Environ()),
+				Cloud:    cl,
+				Secrets: &secret.Mux{
+					Default:  secret.Cloud{Cloud: cl},
+					Backends: map[string]secret.Resolver{},
+				},
+				Sources: &source.Sources{
+					RootPath: workDir,
+					Log:      log,
+				},
+			}
+			if versionKeyFile != "" || credentialsFile != "" {
+				// use the same key as the controller so rotated secrets are reported correctly.
+				r.SecretVersionKey, err = secretVersionKey(versionKeyFile, credentialsFile)
+				exitOnError(err)
+			}
+			if !offline {
+				cfg, err := kubeConfigFlags.ToRESTConfig()
+				exitOnError(err)
+				scheme := runtime.NewScheme()
+				_ = clusteropsv1.AddToScheme(scheme)
+				r.Client, err = client.New(cfg, client.Options{Scheme: scheme})
+				exitOnError(err)
+				r.Secrets.Backends["k8s"] = secret.Kubernetes{Reader: r.Client}
+			}
+			if secretDir != "" {
+				r.Secrets.Backends["file"] = secret.File{RootPath: secretDir}
+			}
+			if secretEnvPrefix != "" {
+				r.Secrets.Backends["env"] = secret.Env{Environ: r.Environ, Prefix: secretEnvPrefix}
+			}
+			r.Planner = &plan.Planner{
+				AllowedStepTypes: steps,
+				Log:              log,
+				Cloud:            cl,
+				Terraform:        &terraform.Terraform{},
+				Kubectl:          &kubectl.Kubectl{Log: log},
+				Azure:            &azure.AZ{Log: log},
+				Addon:            &addon.Addon{},
+				Client:           cluster.Client{Client: r.Client},
+			}
+
+			ctx := context.Background()
+			planned, err := r.DryRun(ctx, environment)
+			exitOnError(err)
+
+			printPlan(os.Stdout, environment, planned)
+
+			if !tfPlan {
+				return
+			}
+			for _, p := range planned {
+				st, ok := p.Step.(*step.InfraStep)
+				if !ok {
+					continue
+				}
+				exitOnError(terraformPlan(ctx, os.Stdout, st, cl, r.Environ))
+				return
+			}
+			fmt.Println("\nInfra is at desired state, no terraform plan is made.")
+		},
+	}
+
+	// Add klog flags to cobra command.
+	fs := flag.NewFlagSet("", flag.PanicOnError)
+	klog.InitFlags(fs)
+	cmd.Flags().AddGoFlagSet(fs)
+
+	cmd.Flags().StringVarP(&filename, "filename", "f", "", "The environment to plan (- reads from stdin).")
+	must(cmd.MarkFlagRequired("filename"))
+	cmd.Flags().BoolVar(&offline, "offline", false,
+		"don't read the environment status from the cluster, all steps are planned as new steps.")
+	cmd.Flags().StringVar(&allowedSteps, "allowed-steps", "",
+		"a comma separated list of steps that are allowed to executed, empty allows all steps\n"+
+			fmt.Sprintf("valid values: %v", step.Types))
+	cmd.Flags().StringVar(&credentialsFile, "credentials-file", "",
+		"file with JSON fields client_id, client_secret and tenant of a ServicePrincipal that is allowed to access the MasterKeyVault and AzureRM.")
+	cmd.Flags().StringVar(&vault, "vault", "",
+		"name of the KeyVault that contains secrets referenced from environment yaml.")
+	cmd.Flags().StringVar(&secretDir, "secret-dir", "",
+		"directory with secrets that can be referenced as 'vault file:name [field]'.")
+	cmd.Flags().StringVar(&secretEnvPrefix, "secret-env-prefix", "",
+		"prefix of the environment variables that can be referenced as 'vault env:name [field]'.")
+	cmd.Flags().StringVar(&versionKeyFile, "secret-version-key-file", "",
+		"file with the key the controller uses to derive secret versions (see envop controller --help).")
+	cmd.Flags().BoolVar(&tfPlan, "terraform", false,
+		"make a terraform plan of the Infra step and show a summary.")
+
+	kubeConfigFlags.AddFlags(cmd.Flags())
+
+	return &cmd
+}
+
+// PrintPlan writes the planned steps of environment as a table to w.
+func printPlan(w io.Writer, environment *clusteropsv1.Environment, planned []controllers.PlannedStep) {
+	if len(planned) == 0 {
+		fmt.Fprintf(w, "Environment %s/%s is at desired state.\n", environment.Namespace, environment.Name)
+		return
+	}
+
+	fmt.Fprintf(w, "Environment %s/%s has %d step(s) to run:\n", environment.Namespace, environment.Name, len(planned))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tWHEN\tREASON")
+	for _, p := range planned {
+		when := "now"
+		if len(p.After) > 0 {
+			when = "after " + strings.Join(p.After, ",")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", p.GetID().ShortName(), when, redact.String(strings.Join(p.Reasons, "; ")))
+	}
+	tw.Flush()
+}
+
+// TerraformPlan makes a terraform plan for the values and source of st and writes a summary to w.
+// The plan is made like a drift check so it's never applied.
+func terraformPlan(ctx context.Context, w io.Writer, st *step.InfraStep, cl cloud.Cloud, environ map[string]string) error {
+	d := &step.DriftStep{
+		Metaa:      step.Metaa{ID: st.GetID()},
+		Values:     st.Values,
+		SourcePath: st.SourcePath,
+		Cloud:      cl,
+		Terraform:  &terraform.Terraform{},
+	}
+	d.Execute(ctx, util.KVSliceFromMap(environ))
+	if d.GetState() != clusteropsv1.StateReady {
+		return fmt.Errorf("terraform plan: %s", d.GetMsg())
+	}
+
+	fmt.Fprintf(w, "\nterraform plan: adds=%d changes=%d deletes=%d\n", d.Added, d.Changed, d.Deleted)
+	if dr := d.GetDrift(); dr != nil {
+		for _, rc := range dr.Resources {
+			fmt.Fprintf(w, "  %s %s\n", rc.Action, rc.Address)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/controllers"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"sigs.k8s.io/yaml"
+)
+
+// NewCmdRender returns a command to show the effective cluster specs of an environment.
+func NewCmdRender() *cobra.Command {
+	// flags
+	var (
+		filename string
+	)
+
+	cmd := cobra.Command{
+		Use:   "render -f file",
+		Short: "Render an environment with defaults merged into the clusters",
+		Long: `Render an environment with spec.defaults merged into spec.clusters and write it to stdout.
+Spec.defaults is kept so the rendered environment has the same effect as the original when applied.
+Status.clusters contains the spec and defaults hashes that envop records in the status of the applied environment.`,
+		Run: func(c *cobra.Command, args []string) {
+			var b []byte
+			var err error
+			if filename == "-" {
+				b, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				b, err = ioutil.ReadFile(filename)
+			}
+			exitOnError(err)
+
+			environment := &v1.Environment{}
+			err = yaml.Unmarshal(b, environment)
+			exitOnError(err)
+
+			rendered, err := controllers.Render(environment)
+			exitOnError(err)
+
+			b, err = yaml.Marshal(rendered)
+			exitOnError(err)
+
+			fmt.Print(string(b))
+		},
+	}
+
+	cmd.Flags().StringVarP(&filename, "filename", "f", "", "The environment to render (- reads from stdin).")
+	must(cmd.MarkFlagRequired("filename"))
+
+	return &cmd
+}
@@ -26,7 +26,8 @@ func NewCmdReset() *cobra.Command {
 		Short: "Reset an environment step so it will be re-executed",
 		Long: `Reset an environment step so it will be re-executed. 
 If no step name is provided the all steps in in error state will be reset.
-NB only steps in Ready state can be reset.`,
+NB only steps in Ready state can be reset.
+The step history (status.history) is kept.`,
 		Args: cobra.ExactArgs(1),
 		Run: func(c *cobra.Command, args []string) {
 			cfg, err := kubeConfigFlags.ToRESTConfig()
@@ -15,6 +15,16 @@ For normal operations run envop as Kubernetes controller with:
 and then apply environment resources to the controller:
     envop apply
 
+To show the effective cluster configuration of an environment:
+    envop render
+
+To show which steps the controller would run for an environment and why:
+    envop plan
+
+To stop an environment from starting steps and to continue again:
+    envop pause
+    envop resume
+
 For testing purposes the controller can be run without making modifications:
     envop dryruncontroller
 `,
@@ -28,6 +38,10 @@ For testing purposes the controller can be run without making modifications:
 	command.AddCommand(NewDryrunControllerCmd())
 	command.AddCommand(NewCmdApply())
 	command.AddCommand(NewCmdReset())
+	command.AddCommand(NewCmdPause())
+	command.AddCommand(NewCmdResume())
+	command.AddCommand(NewCmdRender())
+	command.AddCommand(NewCmdPlan())
 
 	return command
 }
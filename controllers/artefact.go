@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/artefact"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"path"
+)
+
+// Archive puts the artefacts of a step that has ended its run in the artefact store and returns links to them.
+// Nil is returned when there is no store, the step has no artefacts or is still running.
+// Errors are logged.
+func (r *EnvironmentReconciler) archive(ctx context.Context, cr *v1.Environment, meta step.Meta) []string {
+	if r.Artefacts == nil {
+		return nil
+	}
+	a, ok := meta.(step.Artefacter)
+	if !ok {
+		return nil
+	}
+	switch meta.GetState() {
+	case v1.StateReady, v1.StateError, v1.StateAwaitingApproval:
+	default:
+		return nil
+	}
+	start := meta.GetStartTime()
+	if start.IsZero() {
+		return nil
+	}
+
+	prefix := path.Join(cr.Namespace, cr.Name, meta.GetID().ShortName())
+	links, err := artefact.Archive(ctx, r.Artefacts, prefix, a.Artefacts(), start, r.ArtefactRetention)
+	if err != nil {
+		logr.FromContext(ctx).Error(err, "archive artefacts", "step", meta.GetID().ShortName())
+	}
+	return links
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/stdr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/artefact"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvironmentReconciler_archive(t *testing.T) {
+	src := t.TempDir()
+	store := artefact.Dir{Path: t.TempDir()}
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "log"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "log", "plan.txt"), []byte("plan"), 0644))
+
+	start := time.Now().Add(-time.Minute)
+	cr := &v1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default"}}
+	newStep := func(state v1.StepState, start time.Time) step.Meta {
+		return &step.InfraStep{
+			Metaa:      step.Metaa{ID: step.ID{Type: step.TypeInfra}, State: state, StartTime: start},
+			SourcePath: src,
+		}
+	}
+	ctx := logr.NewContext(context.Background(), stdr.New(log.New(os.Stdout, "", 0)))
+
+	tests := []struct {
+		it   string
+		r    *EnvironmentReconciler
+		meta step.Meta
+		want []string
+	}{
+		{
+			it:   "should archive the artefacts of a step that ended its run",
+			r:    &EnvironmentReconciler{Artefacts: store},
+			meta: newStep(v1.StateAwaitingApproval, start),
+			want: []string{"file://" + filepath.ToSlash(filepath.Join(store.Path, "default/env1/Infra", artefact.RunID(start), "plan.txt"))},
+		},
+		{
+			it:   "should not archive while the step is running",
+			r:    &EnvironmentReconciler{Artefacts: store},
+			meta: newStep(v1.StateRunning, start),
+		},
+		{
+			it:   "should not archive without a store",
+			r:    &EnvironmentReconciler{},
+			meta: newStep(v1.StateReady, start),
+		},
+		{
+			it:   "should not archive steps that didn't run",
+			r:    &EnvironmentReconciler{Artefacts: store},
+			meta: newStep(v1.StateReady, time.Time{}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got := tt.r.archive(ctx, cr, tt.meta)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -23,6 +23,9 @@ func testSpec1() *v1.EnvironmentSpec {
 		},
 		Defaults: v1.ClusterSpec{
 			Infra: v1.ClusterInfraSpec{
+				Pools: map[string]v1.NodepoolSpec{
+					"default": {Scale: 1, VMSize: "Standard_DS2_v2"},
+				},
 				X: map[string]string{
 					"overridden":    "default",
 					"notOverridden": "default",
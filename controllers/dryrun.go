@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"strings"
+)
+
+// PlannedStep is a step that is not at desired state.
+type PlannedStep struct {
+	step.Step
+	// After are the steps that have to reach desired state first, empty when the step can run now.
+	After []string
+	// Reasons tell why the step needs to run.
+	Reasons []string
+}
+
+// DryRun plans environment like Reconcile does and returns the steps that are not at desired state.
+// Steps that failed or are awaiting approval are returned with the reason they are not at desired state.
+// Rotated secrets are only detected when SecretVersionKey is the key of the controller.
+// The status of the Environment with the same name in the cluster is used as current state, when there is no such
+// Environment or Client is nil an empty status is used.
+// Steps are not executed and nothing is written to the cluster.
+func (r *EnvironmentReconciler) DryRun(ctx context.Context, environment *v1.Environment) ([]PlannedStep, error) {
+	log := logr.FromContext(ctx)
+
+	cr := environment.DeepCopy()
+	cr.Status = v1.EnvironmentStatus{}
+	var lastSources map[string]string
+	if r.Client != nil {
+		current := &v1.Environment{}
+		err := r.Get(ctx, client.ObjectKeyFromObject(cr), current)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, fmt.Errorf("get environment: %w", err)
+		}
+		cr.Status = current.Status
+
+		lastSources, err = r.lastRunSources(ctx, cr)
+		if err != nil {
+			return nil, fmt.Errorf("list runs: %w", err)
+		}
+	}
+	scheduleDriftCheck(&cr.Status, cr.Spec.Infra.Drift.Interval.Duration, timeNow())
+	prev := cr.Status.DeepCopy()
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name}}
+	grph, _, err := r.nextSteps(ctx, cr, req, log)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceHash := func(cluster string) string {
+		w, _ := r.Sources.Workspace(req.NamespacedName, cluster)
+		return w.Hash
+	}
+
+	// rotated returns the rotated secrets of stp.
+	// Without SecretVersionKey the versions can't be compared with the versions the controller recorded.
+	rotated := func(stp step.Step) []string {
+		if len(r.SecretVersionKey) == 0 {
+			return nil
+		}
+		return rotatedSecrets(prev.Steps[stp.GetID().ShortName()].Secrets, stp.GetSecretVersions())
+	}
+
+	var result []PlannedStep
+	// planned are the names of the steps in result, graph steps are in execution order so dependencies come first.
+	planned := make(map[string]bool)
+	for _, stp := range grph.Steps {
+		n := stp.GetID().ShortName()
+		if atDesiredState(*prev, stp, rotated(stp)) {
+			continue
+		}
+		planned[n] = true
+		var after []string
+		for _, d := range grph.DependsOn[n] {
+			if planned[d] {
+				after = append(after, d)
+			}
+		}
+		result = append(result, PlannedStep{
+			Step:    stp,
+			After:   after,
+			Reasons: stepReasons(*prev, cr.Status, stp, rotated(stp), lastSources, sourceHash),
+		})
+	}
+
+	return result, nil
+}
+
+// AtDesiredState returns true when stp is Ready in status, its hash is unchanged and none of its secrets are rotated.
+func atDesiredState(status v1.EnvironmentStatus, stp step.Step, rotated []string) bool {
+	st, ok := status.Steps[stp.GetID().ShortName()]
+	return ok && st.State == v1.StateReady && st.Hash == stp.GetHash() && len(rotated) == 0
+}
+
+// LastRunSources returns the source hashes of the most recent EnvironmentRun of cr or nil if there are no runs.
+func (r *EnvironmentReconciler) lastRunSources(ctx context.Context, cr *v1.Environment) (map[string]string, error) {
+	var runs v1.EnvironmentRunList
+	err := r.List(ctx, &runs, client.InNamespace(cr.Namespace), client.MatchingLabels{v1.LabelEnvironment: cr.Name})
+	if err != nil {
+		return nil, err
+	}
+	if len(runs.Items) == 0 {
+		return nil, nil
+	}
+	items := runs.Items
+	sort.Slice(items, func(i, j int) bool {
+		ti, tj := items[i].Status.StartTime, items[j].Status.StartTime
+		return ti.Before(&tj)
+	})
+	return items[len(items)-1].Spec.Sources, nil
+}
+
+// StepReasons returns why stp is not at desired state.
+// Changes are explained by the hash inputs that are recorded when the step was last Ready.
+// Prev is the status before planning and cur the status after planning, rotated are the names of the rotated secrets
+// of stp.
+// LastSources are the source hashes of the last run (nil when unknown), sourceHash returns the current source hash of
+// a cluster (empty name for the infra source).
+func stepReasons(prev, cur v1.EnvironmentStatus, stp step.Step, rotated []string, lastSources map[string]string, sourceHash func(string) string) []string {
+	id := stp.GetID()
+	st, ok := prev.Steps[id.ShortName()]
+	if !ok {
+		return []string{"new step"}
+	}
+
+	var r []string
+	switch st.State {
+	case v1.StateError:
+		r = append(r, "previous run failed: "+st.Message)
+	case v1.StateAwaitingApproval:
+		if st.Approval != nil {
+			r = append(r, "awaiting approval of plan "+st.Approval.Hash)
+		} else {
+			r = append(r, "awaiting approval")
+		}
+	case v1.StateRunning:
+		r = append(r, "running")
+	}
+	if len(rotated) > 0 {
+		r = append(r, "secret rotated: "+strings.Join(rotated, ", "))
+	}
+	if st.Hash == stp.GetHash() {
+		if st.State == v1.StateError && len(rotated) == 0 {
+			// a failed step is skipped until its hash changes.
+			r = append(r, "not retried until the step changes")
+		}
+		return r
+	}
+
+	switch id.Type {
+	case step.TypeDrift:
+		return append(r, "drift check is due")
+	case step.TypeDestroy:
+		return append(r, "environment is to be destroyed")
+	}
+
+	if changed := changedHashInputs(st.HashInputs, stp.GetHashInputs()); len(changed) > 0 {
+		return append(r, strings.Join(changed, ", ")+" changed")
+	}
+
+	// The hash inputs are unknown when the step completed before they were tracked, make an educated guess.
+	var changed []string
+	if id.Type == step.TypeAKSPool || id.Type == step.TypeInfra || id.Type == step.TypeAKSAddonPreflight {
+		// these steps depend on the infra source.
+		if h, ok := lastSources["infra"]; ok && h != sourceHash("") {
+			changed = append(changed, "infra source")
+		}
+	}
+	if id.Type == step.TypeAddons {
+		if h, ok := lastSources[id.ClusterName]; ok && h != sourceHash(id.ClusterName) {
+			changed = append(changed, "addons source")
+		}
+	}
+	var clusters []string
+	for n, cs := range cur.Clusters {
+		if (id.ClusterName == "" || id.ClusterName == n) && prev.Clusters[n].SpecHash != cs.SpecHash {
+			clusters = append(clusters, n)
+		}
+	}
+	sort.Strings(clusters)
+	for _, n := range clusters {
+		changed = append(changed, "cluster "+n+" spec")
+	}
+
+	if len(changed) == 0 {
+		return append(r, "source, spec or secret values changed")
+	}
+	return append(r, strings.Join(changed, ", ")+" changed")
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_stepReasons(t *testing.T) {
+	infra := &step.InfraStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeInfra}, Hash: "new"}}
+	addons := &step.AddonStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeAddons, ClusterName: "one"}, Hash: "new"}}
+	sourceHash := func(cluster string) string {
+		return "src-" + cluster
+	}
+	clusters := func(one, two string) map[string]v1.ClusterStatus {
+		return map[string]v1.ClusterStatus{"one": {SpecHash: one}, "two": {SpecHash: two}}
+	}
+
+	tests := []struct {
+		it          string
+		prev        v1.EnvironmentStatus
+		cur         v1.EnvironmentStatus
+		stp         step.Step
+		rotated     []string
+		lastSources map[string]string
+		want        []string
+	}{
+		{
+			it:   "should report steps that never ran",
+			stp:  infra,
+			want: []string{"new step"},
+		},
+		{
+			it: "should report a failed step",
+			prev: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"Infra": {State: v1.StateError, Message: "boom", Hash: "old"},
+			}},
+			stp:  infra,
+			want: []string{"previous run failed: boom", "source, spec or secret values changed"},
+		},
+		{
+			it: "should report a failed step that is not retried",
+			prev: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"Infra": {State: v1.StateError, Message: "boom", Hash: "new"},
+			}},
+			stp:  infra,
+			want: []string{"previous run failed: boom", "not retried until the step changes"},
+		},
+		{
+			it: "should report rotated secrets",
+			prev: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"Infra": {State: v1.StateReady, Hash: "new"},
+			}},
+			stp:     infra,
+			rotated: []string{"infra.x.password"},
+			want:    []string{"secret rotated: infra.x.password"},
+		},
+		{
+			it: "should report the plan that awaits approval",
+			prev: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"Infra": {State: v1.StateAwaitingApproval, Hash: "new", Approval: &v1.PlanApproval{Hash: "abc"}},
+			}},
+			stp:  infra,
+			want: []string{"awaiting approval of plan abc"},
+		},
+		{
+			it: "should report a changed infra source",
+			prev: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"Infra": {State: v1.StateReady, Hash: "old"},
+			}},
+			stp:         infra,
+			lastSources: map[string]string{"infra": "src-old"},
+			want:        []string{"infra source changed"},
+		},
+		{
+			it: "should report the cluster specs that changed",
+			prev: v1.EnvironmentStatus{
+				Steps:    map[string]v1.StepStatus{"Infra": {State: v1.StateReady, Hash: "old"}},
+				Clusters: clusters("a", "b"),
+			},
+			cur:         v1.EnvironmentStatus{Clusters: clusters("c", "d")},
+			stp:         infra,
+			lastSources: map[string]string{"infra": "src-"},
+			want:        []string{"cluster one spec, cluster two spec changed"},
+		},
+		{
+			it: "should only report the spec of the cluster of the step",
+			prev: v1.EnvironmentStatus{
+				Steps:    map[string]v1.StepStatus{"Addonsone": {State: v1.StateReady, Hash: "old"}},
+				Clusters: clusters("a", "b"),
+			},
+			cur:         v1.EnvironmentStatus{Clusters: clusters("a", "d")},
+			stp:         addons,
+			lastSources: map[string]string{"one": "src-old"},
+			want:        []string{"addons source changed"},
+		},
+		{
+			it: "should report the recorded hash inputs that changed",
+			prev: v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{"Addonsone": {State: v1.StateReady, Hash: "old",
+					HashInputs: map[string]string{"source": "1", "cluster.addons.x": "2"}}},
+				Clusters: clusters("a", "b"),
+			},
+			cur: v1.EnvironmentStatus{Clusters: clusters("c", "d")},
+			stp: &step.AddonStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeAddons, ClusterName: "one"}, Hash: "new",
+				HashInputs: map[string]string{"source": "1", "cluster.addons.x": "3"}}},
+			lastSources: map[string]string{"one": "src-old"},
+			want:        []string{"cluster.addons.x changed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got := stepReasons(tt.prev, tt.cur, tt.stp, tt.rotated, tt.lastSources, sourceHash)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_atDesiredState(t *testing.T) {
+	infra := &step.InfraStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeInfra}, Hash: "new"}}
+
+	tests := []struct {
+		it      string
+		state   v1.StepStatus
+		rotated []string
+		want    bool
+	}{
+		{
+			it:    "should be true when the step is Ready and unchanged",
+			state: v1.StepStatus{State: v1.StateReady, Hash: "new"},
+			want:  true,
+		},
+		{
+			it:    "should be false when the step has changed",
+			state: v1.StepStatus{State: v1.StateReady, Hash: "old"},
+		},
+		{
+			it:      "should be false when a secret is rotated",
+			state:   v1.StepStatus{State: v1.StateReady, Hash: "new"},
+			rotated: []string{"infra.x.password"},
+		},
+		{
+			it:    "should be false when the step failed",
+			state: v1.StepStatus{State: v1.StateError, Hash: "new"},
+		},
+		{
+			it:    "should be false when the step is awaiting approval",
+			state: v1.StepStatus{State: v1.StateAwaitingApproval, Hash: "new"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			status := v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{"Infra": tt.state}}
+			assert.Equal(t, tt.want, atDesiredState(status, infra, tt.rotated))
+		})
+	}
+	assert.False(t, atDesiredState(v1.EnvironmentStatus{}, infra, nil), "should be false when the step never ran")
+}
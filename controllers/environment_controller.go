@@ -20,20 +20,32 @@ import (
 	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/imdario/mergo"
+	"github.com/mmlt/environment-operator/pkg/artefact"
 	"github.com/mmlt/environment-operator/pkg/cloud"
+	"github.com/mmlt/environment-operator/pkg/metrics"
+	"github.com/mmlt/environment-operator/pkg/notify"
 	"github.com/mmlt/environment-operator/pkg/plan"
+	"github.com/mmlt/environment-operator/pkg/redact"
+	"github.com/mmlt/environment-operator/pkg/secret"
 	"github.com/mmlt/environment-operator/pkg/source"
 	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/mmlt/environment-operator/pkg/tracing"
 	"github.com/mmlt/environment-operator/pkg/util"
-	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	rtsource "sigs.k8s.io/controller-runtime/pkg/source"
+	"strings"
+	"sync"
 	"time"
 
 	v1 "github.com/mmlt/environment-operator/api/v1"
@@ -62,6 +74,33 @@ type EnvironmentReconciler struct {
 	// Environ are the environment variables presented to the steps.
 	Environ map[string]string
 
+	// Secrets resolves the secret references in the spec.
+	// When nil references are resolved from the Cloud vault.
+	Secrets *secret.Mux
+	// SecretVersionKey is the key of the HMAC that turns secret values into the versions that are kept in the status.
+	// It must be kept secret and should not change, a new key makes the steps that use secrets run again.
+	SecretVersionKey []byte
+
+	// MaxParallelSteps is the maximum number of steps of an environment that are executed at the same time.
+	// Values less than 1 are interpreted as 1.
+	MaxParallelSteps int
+
+	// Artefacts (optional) archives the files written by steps.
+	Artefacts artefact.Store
+	// ArtefactRetention is the number of runs per step that are kept in Artefacts.
+	// Values less than 1 keep all runs.
+	ArtefactRetention int
+
+	// MaxRuns is the number of EnvironmentRuns that are kept per Environment.
+	// Values less than 1 disable the creation of EnvironmentRuns.
+	MaxRuns int
+
+	// Notifier (optional) sends notifications of step state changes.
+	Notifier *notify.Notifier
+
+	// StatusMu serializes status updates of steps that are executed in parallel.
+	statusMu sync.Mutex
+
 	// Invocation counters
 	reconTally int
 }
@@ -71,6 +110,7 @@ var timeNow = time.Now
 
 // +kubebuilder:rbac:groups=clusterops.mmlt.nl,resources=environments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=clusterops.mmlt.nl,resources=environments/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
 
 // Reconcile takes an Environment custom resource and attempts to converge the target environment to the desired state.
 // The status of the k8s resource is updated to match the observed state of the Envirnoment.
@@ -84,6 +124,11 @@ func (r *EnvironmentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	log := logr.FromContext(ctx).WithName("Reconcile")
 	ctx = logr.NewContext(ctx, log)
 
+	ctx, span := tracing.Tracer().Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name)))
+	defer span.End()
+
 	r.reconTally++
 	log.V(1).Info("Start Reconcile", "tally", r.reconTally)
 	defer log.V(1).Info("End Reconcile", "tally", r.reconTally)
@@ -91,161 +136,418 @@ func (r *EnvironmentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// Get Environment Custom Resource (deep copy).
 	cr := &v1.Environment{}
 	if err := r.Get(ctx, req.NamespacedName, cr); err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.StepsInError.DeleteLabelValues(req.Namespace, req.Name)
+			redact.Remove(req.String())
+			if r.Notifier != nil {
+				r.Notifier.SetTargets(req.Namespace, req.Name, nil)
+			}
+		}
 		log.V(2).Info("unable to get kind Environment (retried)", "error", err)
 		return requeueSoon, ignoreNotFound(err)
 	}
 
-	// Ignore when not within time schedule.
-	ok, err := inSchedule(cr.Spec.Infra.Schedule, timeNow())
-	if err != nil {
-		// Schedule contains error (needs user to fix it first so do noy retry).
-		r.Recorder.Event(cr, "Warning", "Config", "infra.schedule:"+err.Error())
-		return noRequeue, fmt.Errorf("spec.infra.schedule: %w", err)
-	}
-	if !ok {
-		log.V(2).Info("outside schedule", "schedule", cr.Spec.Infra.Schedule)
+	if cr.Spec.Paused {
+		// Needs spec.paused to be false to continue.
+		log.V(2).Info("paused")
+		if setPausedCondition(&cr.Status, true, timeNow()) {
+			err := r.saveStatus2(ctx, cr)
+			if err != nil {
+				return requeueNow, fmt.Errorf("save status: %w", err)
+			}
+		}
 		return noRequeue, nil
 	}
+	setPausedCondition(&cr.Status, false, timeNow())
+
+	frozen, overridden, err := r.freezes(ctx, cr, timeNow())
+	if err != nil {
+		return requeueSoon, fmt.Errorf("list change freezes: %w", err)
+	}
+	changed := setFrozenCondition(&cr.Status, frozen, overridden, timeNow())
+	if changed && frozen == nil && len(overridden) > 0 {
+		r.Recorder.Eventf(cr, "Warning", "FreezeOverride", "change freeze %s overridden by annotation %s",
+			strings.Join(overridden, ","), v1.AnnotationFreezeOverride)
+	}
+	if frozen != nil {
+		// Needs the freeze to end, be removed or be overridden to continue.
+		log.V(2).Info("frozen", "changefreeze", frozen.Name, "end", frozen.Spec.End)
+		if changed {
+			err := r.saveStatus2(ctx, cr)
+			if err != nil {
+				return requeueNow, fmt.Errorf("save status: %w", err)
+			}
+		}
+		return ctrl.Result{RequeueAfter: frozen.Spec.End.Sub(timeNow())}, nil
+	}
 
-	if hasStepState(cr.Status.Steps, v1.StateError) {
+	if halted(cr.Spec.Rollout, stepsInState(cr.Status.Steps, v1.StateError)) {
 		// Needs step state reset to continue.
 		return noRequeue, nil
 	}
 
 	// Plan work.
-	stp, err := r.nextStep(cr, req, log)
+	scheduleDriftCheck(&cr.Status, cr.Spec.Infra.Drift.Interval.Duration, timeNow())
+	grph, stps, err := r.nextSteps(ctx, cr, req, log)
 
 	// save planned steps (some steps might need to be re-executed)
+	observeErrors(cr)
 	err = r.saveStatus2(ctx, cr)
 	if err != nil {
 		return requeueNow, fmt.Errorf("save status: %w", err)
 	}
 
 	// Execute work.
-	if stp != nil {
-		stp.SetOnUpdate(func(meta step.Meta) {
-			log1 := logr.FromContext(ctx).WithName("OnUpdate")
-			ctx1 := logr.NewContext(ctx, log)
-
-			e := meta.GetLastError()
-			m := meta.GetMsg()
-			if e != nil {
-				log.Error(e, m)
-			}
-			s := meta.GetState()
-			log1.Info("callback", "msg", m, "state", s, "id", meta.GetID().ShortName())
-			r.update(ctx1, cr, meta)
-		})
-		env := util.KVSliceFromMap(r.Environ)
-		stp.Execute(ctx, env)
+	wait := r.execute(ctx, cr, grph, stps)
+	if d := cr.Spec.Infra.Drift.Interval.Duration; d > 0 {
+		next := nextDriftCheck(&cr.Status, d, timeNow())
+		if next == 0 {
+			// the check is due but didn't run, for example because the Infra step isn't Ready.
+			next = d
+		}
+		if wait == 0 || next < wait {
+			wait = next
+		}
+	}
+	if wait > 0 {
+		// come back when the soak time of a rollout wave has passed, a maintenance window opens or a drift check is due.
+		return ctrl.Result{RequeueAfter: wait}, nil
 	}
 
 	return noRequeue, nil
 }
 
-// NextStep fetches sources, makes a plan, updates cr and returns the next step.
-// Return nil if there is nothing to do.
-func (r *EnvironmentReconciler) nextStep(cr *v1.Environment, req ctrl.Request, log logr.Logger) (step.Step, error) {
+// Execute runs stps and the steps that depend on them.
+// At most MaxParallelSteps steps are run at the same time.
+// A step is started as soon as the steps it depends on are Ready and its rollout wave is allowed to start.
+// Steps that are waiting for an approval or that have failed before are skipped.
+// Steps are only started within their maintenance windows.
+// No new steps are started after failed steps halt the environment or the environment is paused or frozen.
+// An EnvironmentRun is created when the first step (other than Drift) is started and completed when all started steps
+// have returned.
+// Execute returns when all started steps have returned, the result is the time to wait for a rollout wave or
+// maintenance window to start.
+func (r *EnvironmentReconciler) execute(ctx context.Context, cr *v1.Environment, grph plan.Graph, stps []step.Step) time.Duration {
+	log := logr.FromContext(ctx)
+
+	max := r.MaxParallelSteps
+	if max < 1 {
+		max = 1
+	}
+
+	// completed are the steps that are at desired state.
+	completed := make(map[string]bool, len(grph.Steps))
+	for _, stp := range grph.Steps {
+		n := stp.GetID().ShortName()
+		completed[n] = cr.Status.Steps[n].Hash == stp.GetHash()
+	}
+	started := make(map[string]bool, len(grph.Steps))
+	// a failed drift check is not skipped, it's tried again when the next check is due.
+	failed := without(stepsInState(cr.Status.Steps, v1.StateError), string(step.TypeDrift))
+
+	windows, err := maintenanceWindows(cr.Spec)
+	if err != nil {
+		// the spec has been validated when the steps were planned so this is not expected to happen.
+		log.Error(err, "maintenance windows")
+		return 0
+	}
+
+	var queue []step.Step
+	var wait time.Duration
+	// pending are the steps that are waiting for a maintenance window by name.
+	pending := make(map[string]v1.PendingStep)
+	enqueue := func(stp step.Step) {
+		n := stp.GetID().ShortName()
+		if started[n] || contains(failed, n) {
+			return
+		}
+
+		r.statusMu.Lock()
+		approved := isApproved(cr, stp)
+		open, w := waveGate(cr.Spec.Rollout, grph, cr.Status.Steps, stp, timeNow())
+		r.statusMu.Unlock()
+
+		if !approved {
+			// Don't execute a step that is waiting for an approval that has not been given yet.
+			log.V(2).Info("awaiting approval", "step", n)
+			return
+		}
+		if !open {
+			log.V(2).Info("waiting for previous rollout waves", "step", n, "soak", w)
+			if w > 0 && (wait == 0 || w < wait) {
+				wait = w
+			}
+			return
+		}
+		now := timeNow()
+		if ok, w := windowGate(windows, stp.GetID(), now); !ok {
+			log.V(2).Info("outside maintenance window", "step", n, "opensIn", w)
+			if wait == 0 || w < wait {
+				wait = w
+			}
+			pending[n] = v1.PendingStep{
+				Name:        n,
+				Hash:        stp.GetHash(),
+				WindowStart: metav1.NewTime(now.Add(w).Truncate(time.Second)),
+			}
+			return
+		}
+
+		started[n] = true
+		queue = append(queue, stp)
+	}
+	for _, stp := range stps {
+		enqueue(stp)
+	}
+	// show which steps are waiting for a maintenance window before running the others.
+	savePending := func() {
+		r.statusMu.Lock()
+		defer r.statusMu.Unlock()
+		if !setWindowStatus(&cr.Status, pendingSteps(grph, completed, started, pending, windows, timeNow())) {
+			return
+		}
+		err := r.saveStatus2(ctx, cr)
+		if err != nil {
+			log.Error(err, "saveStatus")
+		}
+	}
+	savePending()
+
+	done := make(chan step.Step)
+	var running int
+	var run *v1.EnvironmentRun
+	for {
+		for !halted(cr.Spec.Rollout, failed) && running < max && len(queue) > 0 {
+			if r.isPaused(ctx, cr) || r.isFrozen(ctx, cr) {
+				log.Info("paused or frozen, not starting steps", "steps", len(queue))
+				queue = nil
+				break
+			}
+			stp := queue[0]
+			queue = queue[1:]
+			// periodic drift checks don't change the environment, they are not recorded as a run.
+			if stp.GetID().Type != step.TypeDrift {
+				if run == nil && r.MaxRuns > 0 {
+					run = r.startRun(ctx, cr, grph)
+				}
+				addRunStep(run, stp)
+			}
+			running++
+			go func() {
+				r.executeStep(ctx, cr, stp)
+				done <- stp
+			}()
+		}
+
+		if running == 0 {
+			if run != nil {
+				r.completeRun(ctx, cr, grph, run)
+			}
+			savePending()
+			return wait
+		}
+
+		stp := <-done
+		running--
+
+		switch stp.GetState() {
+		case v1.StateReady:
+			completed[stp.GetID().ShortName()] = true
+			// start the steps that have all their dependencies completed.
+			for _, s := range grph.Steps {
+				n := s.GetID().ShortName()
+				if completed[n] || started[n] || !allCompleted(grph.DependsOn[n], completed) {
+					continue
+				}
+				enqueue(s)
+			}
+		case v1.StateError:
+			failed = append(failed, stp.GetID().ShortName())
+		}
+	}
+}
+
+// ExecuteStep executes stp and updates cr.Status when stp changes state.
+func (r *EnvironmentReconciler) executeStep(ctx context.Context, cr *v1.Environment, stp step.Step) {
+	log := logr.FromContext(ctx)
+
+	ctx, span := tracing.Tracer().Start(ctx, "Execute", trace.WithAttributes(
+		attribute.String("step", stp.GetID().ShortName())))
+	defer span.End()
+	phases := &phaseTracer{ctx: ctx}
+	defer phases.end()
+
+	stp.SetOnUpdate(func(meta step.Meta) {
+		phases.update(meta)
+
+		log1 := logr.FromContext(ctx).WithName("OnUpdate")
+		ctx1 := logr.NewContext(ctx, log)
+
+		e := meta.GetLastError()
+		m := meta.GetMsg()
+		if e != nil {
+			log.Error(e, m)
+		}
+		s := meta.GetState()
+		log1.Info("callback", "msg", m, "state", s, "id", meta.GetID().ShortName())
+		// pass the step instead of meta so step results (like counts) can be recorded.
+		r.update(ctx1, cr, stp)
+	})
+	env := util.KVSliceFromMap(r.Environ)
+	stp.Execute(ctx, env)
+}
+
+// Contains returns true when s is in list.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AllCompleted returns true when all names are completed.
+func allCompleted(names []string, completed map[string]bool) bool {
+	for _, n := range names {
+		if !completed[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// NextSteps fetches sources, makes a plan, updates cr and returns the plan and the steps that can be executed now.
+// Return no steps if there is nothing to do.
+func (r *EnvironmentReconciler) nextSteps(ctx context.Context, cr *v1.Environment, req ctrl.Request, log logr.Logger) (plan.Graph, []step.Step, error) {
 	// Get ClusterSpecs with defaults.
 	cspec, err := flattenedClusterSpec(cr.Spec)
 	if err != nil {
 		// Spec contains error (needs user to fix it first so do noy retry).
 		r.Recorder.Event(cr, "Warning", "Config", err.Error())
-		return nil, fmt.Errorf("spec: %w", err)
+		return plan.Graph{}, nil, fmt.Errorf("spec: %w", err)
 	}
+	cr.Status.Clusters = clusterStatus(cr.Spec.Defaults, cspec)
+
+	ctx, span := tracing.Tracer().Start(ctx, "nextSteps")
+	defer span.End()
 
 	// Replace references to secret values with the value from vault.
-	ispec, err := vaultInfraValues(cr.Spec.Infra, r.Cloud)
-	if err != nil {
-		return nil, fmt.Errorf("vault ref: %w", err)
-	}
-	cspec, err = vaultClusterValues(cspec, r.Cloud)
+	var ispec v1.InfraSpec
+	var resolved []resolvedSecret
+	err = traced(ctx, "vault", func(ctx context.Context) error {
+		var isecrets, csecrets []resolvedSecret
+		var err error
+		ispec, isecrets, err = vaultInfraValues(ctx, cr.Spec.Infra, r.secretMux(), cr.Namespace)
+		if err != nil {
+			return fmt.Errorf("vault ref: %w", err)
+		}
+		cspec, csecrets, err = vaultClusterValues(ctx, cspec, r.secretMux(), cr.Namespace)
+		if err != nil {
+			return fmt.Errorf("vault ref: %w", err)
+		}
+		resolved = append(isecrets, csecrets...)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("vault ref: %w", err)
+		return plan.Graph{}, nil, err
 	}
+	secrets := append(secretValues(resolved), sensitiveValues(ispec, cspec)...)
+	// the secrets of the previous reconcile are replaced so rotated values are forgotten.
+	redact.Set(req.String(), secrets...)
+	r.setNotifyTargets(ctx, cr)
 
 	// Register and fetch sources.
-	err = r.Sources.Register(req.NamespacedName, "", ispec.Source)
-	if err != nil {
-		return nil, fmt.Errorf("source: register infra: %w", err)
-	}
-	for _, sp := range cspec {
-		err = r.Sources.Register(req.NamespacedName, sp.Name, sp.Addons.Source)
+	err = traced(ctx, "source.register", func(ctx context.Context) error {
+		err := r.Sources.Register(req.NamespacedName, "", ispec.Source)
 		if err != nil {
-			return nil, fmt.Errorf("source: register cluster: %w", err)
+			return fmt.Errorf("source: register infra: %w", err)
+		}
+		for _, sp := range cspec {
+			err = r.Sources.Register(req.NamespacedName, sp.Name, sp.Addons.Source)
+			if err != nil {
+				return fmt.Errorf("source: register cluster: %w", err)
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return plan.Graph{}, nil, err
 	}
-	err = r.Sources.FetchAll()
+	err = traced(ctx, "source.fetch", r.Sources.FetchAll)
 	if err != nil {
 		log.Error(err, "source: fetch")
 	}
 	// update workspaces
-	_, err = r.Sources.Get(req.NamespacedName, "")
-	if err != nil {
-		return nil, fmt.Errorf("source: get infra: %w", err)
-	}
-	for _, sp := range cspec {
-		_, err = r.Sources.Get(req.NamespacedName, sp.Name)
+	err = traced(ctx, "source.get", func(ctx context.Context) error {
+		_, err := r.Sources.Get(req.NamespacedName, "")
 		if err != nil {
-			return nil, fmt.Errorf("source: get cluster: %w", err)
+			return fmt.Errorf("source: get infra: %w", err)
 		}
+		for _, sp := range cspec {
+			_, err = r.Sources.Get(req.NamespacedName, sp.Name)
+			if err != nil {
+				return fmt.Errorf("source: get cluster: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return plan.Graph{}, nil, err
 	}
 
 	// Make a plan
-	pln, err := r.Planner.Plan(req.NamespacedName, r.Sources, cr.Spec.Destroy, ispec, cspec)
+	var grph plan.Graph
+	err = traced(ctx, "plan", func(context.Context) error {
+		var err error
+		grph, err = r.Planner.Plan(req.NamespacedName, r.Sources, cr.Spec.Destroy, ispec, cspec, cr.Spec.Rollout)
+		if err != nil {
+			return fmt.Errorf("plan: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("plan: %w", err)
+		return plan.Graph{}, nil, err
+	}
+	for _, stp := range grph.Steps {
+		stp.SetSecretVersions(stepSecretVersions(stp.GetID(), resolved, r.SecretVersionKey))
 	}
-	stp, err := getStepAndSyncStatusWithPlan(&cr.Status, pln, log)
+	stps, err := getStepsAndSyncStatusWithPlan(&cr.Status, grph, log)
 	if err != nil {
-		return nil, fmt.Errorf("sync status with plan: %w", err)
+		return plan.Graph{}, nil, fmt.Errorf("sync status with plan: %w", err)
 	}
-	return stp, nil
-}
 
-// InSchedule returns true when time now is in CRON schedule or the schedule is empty.
-//
-//  Field name   | Mandatory? | Allowed values  | Allowed special characters
-//  ----------   | ---------- | --------------  | --------------------------
-//  Minutes      | Yes        | 0-59            | * / , -
-//  Hours        | Yes        | 0-23            | * / , -
-//  Day of month | Yes        | 1-31            | * / , - ?
-//  Month        | Yes        | 1-12 or JAN-DEC | * / , -
-//  Day of week  | Yes        | 0-6 or SUN-SAT  | * / , - ?
-//
-// Special characters:
-//   * always
-//   / interval, for example */5 is every 5m
-//   , list, for example MON,FRI in DayOfWeek field
-//   - range, for example 20-04 in hour field
-// See https://godoc.org/github.com/robfig/cron#Parser
-func inSchedule(schedule string, now time.Time) (bool, error) {
-	if schedule == "" {
-		return true, nil
-	}
-
-	p := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	sc, err := p.Parse(schedule)
-	if err != nil {
-		return false, err
+	for _, stp := range grph.Steps {
+		if st, ok := stp.(*step.InfraStep); ok {
+			st.ApprovedPlanHash = cr.Annotations[v1.AnnotationApprovedPlan]
+			st.Secrets = secrets
+		}
 	}
 
-	next := sc.Next(now)
+	return grph, stps, nil
+}
 
-	ok := next.Sub(now).Minutes() < 10.0
+// IsApproved returns false when stp is waiting for an approval that doesn't match the approved plan annotation.
+func isApproved(cr *v1.Environment, stp step.Step) bool {
+	stStp, ok := cr.Status.Steps[stp.GetID().ShortName()]
+	if !ok || stStp.State != v1.StateAwaitingApproval || stStp.Approval == nil {
+		return true
+	}
 
-	return ok, nil
+	return cr.Annotations[v1.AnnotationApprovedPlan] == stStp.Approval.Hash
 }
 
-// getStepAndSyncStatusWithPlan update status.steps with plan and returns the next step to execute.
+// getStepsAndSyncStatusWithPlan update status.steps with grph and returns the steps that can be executed now.
+// A step can be executed when it's not at desired state and the steps it depends on are.
 // Return nil if no step is to be executed.
-func getStepAndSyncStatusWithPlan(status *v1.EnvironmentStatus, plan []step.Step, log logr.Logger) (step.Step, error) {
+func getStepsAndSyncStatusWithPlan(status *v1.EnvironmentStatus, grph plan.Graph, log logr.Logger) ([]step.Step, error) {
 	if status.Steps == nil {
 		status.Steps = make(map[string]v1.StepStatus)
 	}
 
-	var r step.Step
-	for _, stp := range plan {
+	var r []step.Step
+	completed := make(map[string]bool, len(grph.Steps))
+	for _, stp := range grph.Steps {
 		shortName := stp.GetID().ShortName()
 
 		// Get status step state.
@@ -258,24 +560,52 @@ func getStepAndSyncStatusWithPlan(status *v1.EnvironmentStatus, plan []step.Step
 			}
 		}
 
-		if stStp.Hash == stp.GetHash() {
+		rotated := rotatedSecrets(stStp.Secrets, stp.GetSecretVersions())
+
+		if stStp.Hash == stp.GetHash() && len(rotated) == 0 {
 			// step is at desired state.
 			if stStp.State != v1.StateReady {
 				// state is inconsistent, fix it
 				log.Info("inconsistency in status: step state with matching hash should have State=Ready", "step", stStp)
 				stStp.State = v1.StateReady
 			}
+			if (stStp.Secrets == nil || legacySecretVersions(stStp.Secrets)) && stp.GetSecretVersions() != nil {
+				// secret versions are not known yet (step completed before they were tracked or keyed), start tracking them.
+				stStp.Secrets = stp.GetSecretVersions()
+				status.Steps[shortName] = stStp
+			}
+			if stStp.HashInputs == nil && stp.GetHashInputs() != nil {
+				// hash inputs are not known yet (step completed before they were tracked), start tracking them.
+				stStp.HashInputs = stp.GetHashInputs()
+				status.Steps[shortName] = stStp
+			}
+			completed[shortName] = true
 			continue
 		}
 
-		if r == nil {
-			// the first step in the plan with a non-matching hash.
-			r = stp
+		if allCompleted(grph.DependsOn[shortName], completed) {
+			// a step with a non-matching hash and all its dependencies at desired state.
+			r = append(r, stp)
+		}
+
+		if stStp.State == v1.StateAwaitingApproval && stStp.Approval != nil && stStp.Approval.StepHash != stp.GetHash() {
+			// sources or values have changed while waiting for approval.
+			stStp.State = ""
+			stStp.Message = "approval invalidated by source or value change"
+			stStp.Approval = nil
 		}
 
 		if stStp.State == v1.StateReady {
-			// clear state of a step that needs to be run again because its hash has changed.
+			// clear state of a step that needs to be run again because its hash has changed or a secret is rotated.
 			stStp.State = ""
+			if changed := changedHashInputs(stStp.HashInputs, stp.GetHashInputs()); len(changed) > 0 {
+				log.Info("step inputs changed", "step", shortName, "inputs", changed)
+				stStp.Message = strings.Join(changed, ", ") + " changed"
+			}
+			if len(rotated) > 0 {
+				log.Info("secret rotated", "step", shortName, "paths", rotated)
+				stStp.Message = "secret rotated: " + strings.Join(rotated, ", ")
+			}
 
 			// Consider also doing to reverse: set stStepSate = v1.StateReady when hashes match.
 			// For example in the following sequence of events a step will run again even it's not strictly necessary;
@@ -288,7 +618,7 @@ func getStepAndSyncStatusWithPlan(status *v1.EnvironmentStatus, plan []step.Step
 	}
 
 	// status consistency checks
-	if r == nil {
+	if len(r) == 0 {
 		// if no step is selected to be run all steps must be Ready
 		for _, stStp := range status.Steps {
 			if stStp.State != v1.StateReady {
@@ -302,7 +632,7 @@ func getStepAndSyncStatusWithPlan(status *v1.EnvironmentStatus, plan []step.Step
 
 // SaveStatus writes the status to the API server.
 func (r *EnvironmentReconciler) saveStatus2(ctx context.Context, cr *v1.Environment) error {
-	// clean-up steps (consider moving to getStepAndSyncStatusWithPlan)
+	// clean-up steps (consider moving to getStepsAndSyncStatusWithPlan)
 	p := r.Planner.PossibleSteps(cr.Spec.Clusters)
 	for n := range cr.Status.Steps {
 		if _, ok := p[n]; ok {
@@ -323,10 +653,11 @@ func (r *EnvironmentReconciler) saveStatus2(ctx context.Context, cr *v1.Environm
 
 // UpdateStatusConditions updates Status.Conditions to reflect steps state.
 // Ready = True when all steps are in their final state, Reason is Ready or Failed.
-// Ready = False when a step is running, Reason is Running.
+// Ready = False when a step is running or awaiting approval, Reason is Running or AwaitingApproval.
+// Ready = False when steps are waiting for a maintenance window, Reason is Scheduled.
 // Ready = Unknown when no steps are present.
 func updateStatusConditions(status *v1.EnvironmentStatus) {
-	var runningCnt, readyCnt, errorCnt, totalCnt int
+	var runningCnt, awaitingCnt, readyCnt, errorCnt, totalCnt int
 	var latestTime metav1.Time
 
 	for _, st := range status.Steps {
@@ -334,6 +665,8 @@ func updateStatusConditions(status *v1.EnvironmentStatus) {
 		switch st.State {
 		case v1.StateRunning:
 			runningCnt++
+		case v1.StateAwaitingApproval:
+			awaitingCnt++
 		case v1.StateReady:
 			readyCnt++
 		case v1.StateError:
@@ -355,6 +688,12 @@ func updateStatusConditions(status *v1.EnvironmentStatus) {
 	case runningCnt > 0:
 		c.Status = metav1.ConditionFalse
 		c.Reason = v1.ReasonRunning
+	case awaitingCnt > 0:
+		c.Status = metav1.ConditionFalse
+		c.Reason = v1.ReasonAwaitingApproval
+	case status.NextWindowStart != nil:
+		c.Status = metav1.ConditionFalse
+		c.Reason = v1.ReasonScheduled
 	case readyCnt == totalCnt && totalCnt > 0:
 		c.Status = metav1.ConditionTrue
 		c.Reason = v1.ReasonReady
@@ -363,7 +702,11 @@ func updateStatusConditions(status *v1.EnvironmentStatus) {
 		c.Reason = ""
 	}
 	c.Message = fmt.Sprintf("%d/%d ready, %d running, %d error(s)", readyCnt, totalCnt, runningCnt, errorCnt)
-	if latestTime.IsZero() {
+	if t := status.NextWindowStart; t != nil {
+		c.Message += fmt.Sprintf(", changes queued, will run at %s", t.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	if latestTime.IsZero() || c.Reason == v1.ReasonScheduled {
+		// scheduled isn't caused by a step transition, use the time the condition is set.
 		latestTime = metav1.Time{Time: timeNow()}
 	}
 	c.LastTransitionTime = latestTime
@@ -391,24 +734,49 @@ func updateStatusConditions(status *v1.EnvironmentStatus) {
 }
 
 // Update updates cr.Status with meta, writes the status to the API Server and records an Event.
+// Update is safe to call from multiple goroutines.
 func (r *EnvironmentReconciler) update(ctx context.Context, cr *v1.Environment, meta step.Meta) {
 	log := logr.FromContext(ctx)
 
+	// archive before locking, archiving can take a while.
+	artefacts := r.archive(ctx, cr, meta)
+
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
 	shortname := meta.GetID().ShortName()
 
 	r.Recorder.Event(cr, "Normal", shortname+string(meta.GetState()), meta.GetMsg())
 
 	// copy meta to step
 	ss := cr.Status.Steps[shortname]
+	r.notify(cr, meta, ss.State, timeNow())
 	ss.State = meta.GetState()
 	ss.Message = meta.GetMsg()
 	ss.LastTransitionTime = metav1.Time{Time: timeNow()}
 	if ss.State == v1.StateReady {
 		// step has completed.
 		ss.Hash = meta.GetHash()
+		ss.Secrets = meta.GetSecretVersions()
+		ss.HashInputs = meta.GetHashInputs()
+	}
+	ss.Approval = nil
+	if ss.State == v1.StateAwaitingApproval {
+		ss.Approval = meta.GetApproval()
+	}
+	if artefacts != nil {
+		ss.Artefacts = artefacts
 	}
 	cr.Status.Steps[shortname] = ss
 
+	recordRun(&cr.Status, meta, artefacts, timeNow())
+	observeStep(meta, timeNow())
+	observeErrors(cr)
+
+	if d := meta.GetDrift(); d != nil && ss.State == v1.StateReady {
+		r.updateDrift(cr, d)
+	}
+
 	err := r.saveStatus2(ctx, cr)
 	if err != nil {
 		// failing to save a final state will result in re-execution of the step
@@ -416,6 +784,75 @@ func (r *EnvironmentReconciler) update(ctx context.Context, cr *v1.Environment,
 	}
 }
 
+// UpdateDrift updates cr.Status with the result of a drift check and records an Event when drift is detected.
+// When the drift is to be remediated the Infra step hash is cleared to make the Infra step run again.
+func (r *EnvironmentReconciler) updateDrift(cr *v1.Environment, d *v1.DriftStatus) {
+	cr.Status.Drift = d
+
+	if d.Error != "" {
+		r.Recorder.Event(cr, "Warning", "DriftCheckFailed", d.Error)
+		return
+	}
+	if !d.Detected {
+		return
+	}
+
+	const max = 10
+	var rs []string
+	for i, rc := range d.Resources {
+		if i == max {
+			rs = append(rs, fmt.Sprintf("and %d more", len(d.Resources)-max))
+			break
+		}
+		rs = append(rs, rc.Action+" "+rc.Address)
+	}
+	r.Recorder.Event(cr, "Warning", "Drift", fmt.Sprintf("infra drift detected adds=%d changes=%d deletes=%d: %s",
+		d.Added, d.Changed, d.Deleted, strings.Join(rs, ", ")))
+
+	if !d.Remediated {
+		return
+	}
+	n := string(step.TypeInfra)
+	ss, ok := cr.Status.Steps[n]
+	if !ok {
+		return
+	}
+	ss.Hash = ""
+	ss.State = ""
+	ss.Message = "remediate drift"
+	cr.Status.Steps[n] = ss
+}
+
+// NextDriftCheck returns the time until the next drift check is due.
+// A drift check is due interval after the Drift step has last changed state (or right away when it never ran).
+func nextDriftCheck(status *v1.EnvironmentStatus, interval time.Duration, now time.Time) time.Duration {
+	ss, ok := status.Steps[string(step.TypeDrift)]
+	if !ok {
+		return 0
+	}
+	d := ss.LastTransitionTime.Add(interval).Sub(now)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// ScheduleDriftCheck clears the Drift step hash when a drift check is due to make the Drift step run again.
+// The Drift step hash only changes with the infra values so a check doesn't look like a change of the environment.
+func scheduleDriftCheck(status *v1.EnvironmentStatus, interval time.Duration, now time.Time) {
+	if interval <= 0 || nextDriftCheck(status, interval, now) > 0 {
+		return
+	}
+	n := string(step.TypeDrift)
+	ss, ok := status.Steps[n]
+	if !ok || ss.Hash == "" || ss.State == v1.StateRunning {
+		return
+	}
+	ss.Hash = ""
+	ss.Message = "drift check due"
+	status.Steps[n] = ss
+}
+
 // SetupWithManager initializes the receiver and adds it to mgr.
 func (r *EnvironmentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	selector := r.LabelSet.AsSelector()
@@ -426,8 +863,8 @@ func (r *EnvironmentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	)
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1.Environment{}).
-		WithEventFilter(lp).
+		For(&v1.Environment{}, builder.WithPredicates(lp)).
+		Watches(&rtsource.Kind{Type: &v1.ChangeFreeze{}}, handler.EnqueueRequestsFromMapFunc(r.freezeRequests)).
 		Complete(r)
 }
 
@@ -459,7 +896,7 @@ func flattenedClusterSpec(in v1.EnvironmentSpec) ([]v1.ClusterSpec, error) {
 			return nil, fmt.Errorf("merge spec.cluster %s: %w", c.Name, err)
 		}
 
-		err = validateClusterSpec(cs)
+		err = validateClusterSpec(cs, &in.Infra)
 		if err != nil {
 			return nil, fmt.Errorf("validate spec.cluster %s: %w", c.Name, err)
 		}
@@ -467,15 +904,10 @@ func flattenedClusterSpec(in v1.EnvironmentSpec) ([]v1.ClusterSpec, error) {
 		r = append(r, *cs)
 	}
 
-	return r, nil
-}
-
-// HasStepState returns true when one of the stps is in state.
-func hasStepState(stps map[string]v1.StepStatus, state v1.StepState) bool {
-	for _, stp := range stps {
-		if stp.State == state {
-			return true
-		}
+	err = validateClusters(r, &in.Infra)
+	if err != nil {
+		return nil, fmt.Errorf("validate spec: %w", err)
 	}
-	return false
+
+	return r, nil
 }
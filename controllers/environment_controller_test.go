@@ -1,14 +1,23 @@
 package controllers
 
 import (
-	"errors"
+	"context"
+	"github.com/go-logr/logr"
 	"github.com/go-logr/stdr"
 	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/plan"
 	"github.com/mmlt/environment-operator/pkg/step"
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	"log"
 	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -26,6 +35,9 @@ func TestController_flattenedClusterSpec(t *testing.T) {
 				{
 					Name: "cpe",
 					Infra: v1.ClusterInfraSpec{
+						Pools: map[string]v1.NodepoolSpec{
+							"default": {Scale: 1, VMSize: "Standard_DS2_v2"},
+						},
 						X: map[string]string{
 							"notOverridden": "default",
 							"overridden":    "cpe-cluster",
@@ -42,6 +54,9 @@ func TestController_flattenedClusterSpec(t *testing.T) {
 				{
 					Name: "second",
 					Infra: v1.ClusterInfraSpec{
+						Pools: map[string]v1.NodepoolSpec{
+							"default": {Scale: 1, VMSize: "Standard_DS2_v2"},
+						},
 						X: map[string]string{
 							"notOverridden": "default",
 							"overridden":    "second-cluster",
@@ -67,65 +82,6 @@ func TestController_flattenedClusterSpec(t *testing.T) {
 	}
 }
 
-func Test_inSchedule(t *testing.T) {
-	type args struct {
-		schedule string
-		now      string
-	}
-	tests := []struct {
-		it   string
-		args args
-		want bool
-		err  error
-	}{
-		{
-			it: "should return true when in schedule",
-			args: args{
-				schedule: "* 15 * * *",
-				now:      "2006-01-02T15:04:05Z",
-			},
-			want: true,
-			err:  nil,
-		},
-		{
-			it: "should return false when outside schedule",
-			args: args{
-				schedule: "* 22-23,0-4 * * *",
-				now:      "2006-01-02T15:04:05Z",
-			},
-			want: false,
-			err:  nil,
-		},
-		{
-			it: "should return true at start of nightly schedule",
-			args: args{
-				schedule: "* 0-4 * * *",
-				now:      "2006-01-02T00:04:05Z",
-			},
-			want: true,
-			err:  nil,
-		},
-		{
-			it: "should return and error on invalid schedule",
-			args: args{
-				schedule: "* 22-04 * * *",
-				now:      "2006-01-03T03:04:05Z",
-			},
-			want: false,
-			err:  errors.New("beginning of range (22) beyond end of range (4): 22-04"),
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.it, func(t *testing.T) {
-			now, err := time.Parse(time.RFC3339, tt.args.now)
-			assert.NoError(t, err)
-			got, err := inSchedule(tt.args.schedule, now)
-			assert.Equal(t, tt.want, got)
-			assert.Equal(t, tt.err, err)
-		})
-	}
-}
-
 func Test_syncStatusWithPlan(t *testing.T) {
 	// test helper
 	newStep := func(typ step.Type, clusterName, hash string) step.Step {
@@ -141,6 +97,18 @@ func Test_syncStatusWithPlan(t *testing.T) {
 			},
 		}
 	}
+	newStepWithSecrets := func(typ step.Type, clusterName, hash string, secrets ...v1.SecretVersion) step.Step {
+		stp := newStep(typ, clusterName, hash)
+		stp.SetSecretVersions(secrets)
+		return stp
+	}
+	newStepWithInputs := func(typ step.Type, clusterName, hash string, inputs map[string]string) step.Step {
+		stp := newStep(typ, clusterName, hash)
+		stp.(*step.AddonStep).HashInputs = inputs
+		return stp
+	}
+	access1 := v1.SecretVersion{Path: "infra.state.access", Ref: "vault tf", Version: "hmac:1"}
+	access2 := v1.SecretVersion{Path: "infra.state.access", Ref: "vault tf", Version: "hmac:2"}
 	newTime := func(t int64) metav1.Time {
 		return metav1.Time{Time: time.Unix(t, 0)}
 	}
@@ -159,7 +127,7 @@ func Test_syncStatusWithPlan(t *testing.T) {
 		it         string
 		args       args
 		wantStatus v1.EnvironmentStatus
-		wantStep   step.Step
+		wantSteps  []step.Step
 		wantErr    bool
 	}{
 		{
@@ -175,8 +143,8 @@ func Test_syncStatusWithPlan(t *testing.T) {
 					"Infra":     {LastTransitionTime: newTime(0), State: "", Message: "new", Hash: ""},
 					"Addonsfoo": {LastTransitionTime: newTime(0), State: "", Message: "new", Hash: ""},
 				}},
-			wantStep: newStep(step.TypeInfra, "", "123"),
-			wantErr:  false,
+			wantSteps: []step.Step{newStep(step.TypeInfra, "", "123")},
+			wantErr:   false,
 		},
 		{
 			it: "should return the same first step of the plan when the step is executing",
@@ -195,8 +163,8 @@ func Test_syncStatusWithPlan(t *testing.T) {
 					"Infra":     {LastTransitionTime: newTime(0), State: "Running", Message: "new", Hash: ""},
 					"Addonsfoo": {LastTransitionTime: newTime(0), State: "", Message: "new", Hash: ""},
 				}},
-			wantStep: newStep(step.TypeInfra, "", "123"),
-			wantErr:  false,
+			wantSteps: []step.Step{newStep(step.TypeInfra, "", "123")},
+			wantErr:   false,
 		},
 		{
 			it: "should return the second step of the plan when the first step has completed successfully (hashes match)",
@@ -215,8 +183,8 @@ func Test_syncStatusWithPlan(t *testing.T) {
 					"Infra":     {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123"},
 					"Addonsfoo": {LastTransitionTime: newTime(0), State: "", Message: "new", Hash: ""},
 				}},
-			wantStep: newStep(step.TypeAddons, "foo", "456"),
-			wantErr:  false,
+			wantSteps: []step.Step{newStep(step.TypeAddons, "foo", "456")},
+			wantErr:   false,
 		},
 		{
 			it: "should return nil when all step have completed (hashes match)",
@@ -235,8 +203,8 @@ func Test_syncStatusWithPlan(t *testing.T) {
 					"Infra":     {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123"},
 					"Addonsfoo": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "456"},
 				}},
-			wantStep: nil,
-			wantErr:  false,
+			wantSteps: nil,
+			wantErr:   false,
 		},
 		{
 			it: "should return the first step and clear states when hashes change",
@@ -255,8 +223,161 @@ func Test_syncStatusWithPlan(t *testing.T) {
 					"Infra":     {LastTransitionTime: newTime(0), State: "", Message: "new", Hash: "123"},
 					"Addonsfoo": {LastTransitionTime: newTime(0), State: "", Message: "new", Hash: "456"},
 				}},
-			wantStep: newStep(step.TypeInfra, "", "999123"),
-			wantErr:  false,
+			wantSteps: []step.Step{newStep(step.TypeInfra, "", "999123")},
+			wantErr:   false,
+		},
+		{
+			it: "should return the first step of each cluster when infra is at desired state",
+			args: args{
+				status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123"},
+					}},
+				plan: []step.Step{
+					newStep(step.TypeInfra, "", "123"),
+					newStep(step.TypeAKSPool, "foo", "456"),
+					newStep(step.TypeAddons, "foo", "456"),
+					newStep(step.TypeAKSPool, "bar", "789"),
+					newStep(step.TypeAddons, "bar", "789"),
+				}},
+			wantStatus: v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{
+					"Infra":      {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123"},
+					"AKSPoolfoo": {LastTransitionTime: newTime(0), Message: "new"},
+					"Addonsfoo":  {LastTransitionTime: newTime(0), Message: "new"},
+					"AKSPoolbar": {LastTransitionTime: newTime(0), Message: "new"},
+					"Addonsbar":  {LastTransitionTime: newTime(0), Message: "new"},
+				}},
+			wantSteps: []step.Step{
+				newStep(step.TypeAKSPool, "foo", "456"),
+				newStep(step.TypeAKSPool, "bar", "789"),
+			},
+			wantErr: false,
+		},
+		{
+			it: "should keep the approval when the step hash doesn't change",
+			args: args{
+				status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra": {LastTransitionTime: newTime(0), State: "AwaitingApproval", Message: "awaits", Approval: &v1.PlanApproval{Hash: "abc", StepHash: "123"}},
+					}},
+				plan: []step.Step{
+					newStep(step.TypeInfra, "", "123"),
+				}},
+			wantStatus: v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{
+					"Infra": {LastTransitionTime: newTime(0), State: "AwaitingApproval", Message: "awaits", Approval: &v1.PlanApproval{Hash: "abc", StepHash: "123"}},
+				}},
+			wantSteps: []step.Step{newStep(step.TypeInfra, "", "123")},
+			wantErr:   false,
+		},
+		{
+			it: "should invalidate the approval when the step hash changes",
+			args: args{
+				status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra": {LastTransitionTime: newTime(0), State: "AwaitingApproval", Message: "awaits", Approval: &v1.PlanApproval{Hash: "abc", StepHash: "123"}},
+					}},
+				plan: []step.Step{
+					newStep(step.TypeInfra, "", "999123"),
+				}},
+			wantStatus: v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{
+					"Infra": {LastTransitionTime: newTime(0), State: "", Message: "approval invalidated by source or value change"},
+				}},
+			wantSteps: []step.Step{newStep(step.TypeInfra, "", "999123")},
+			wantErr:   false,
+		},
+		{
+			it: "should return a step when a secret it uses is rotated",
+			args: args{
+				status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra":     {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123", Secrets: []v1.SecretVersion{access1}},
+						"Addonsfoo": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "456"},
+					}},
+				plan: []step.Step{
+					newStepWithSecrets(step.TypeInfra, "", "123", access2),
+					newStep(step.TypeAddons, "foo", "456"),
+				}},
+			wantStatus: v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{
+					"Infra":     {LastTransitionTime: newTime(0), State: "", Message: "secret rotated: infra.state.access", Hash: "123", Secrets: []v1.SecretVersion{access1}},
+					"Addonsfoo": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "456"},
+				}},
+			wantSteps: []step.Step{newStepWithSecrets(step.TypeInfra, "", "123", access2)},
+			wantErr:   false,
+		},
+		{
+			it: "should start tracking secret versions of a completed step",
+			args: args{
+				status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123"},
+					}},
+				plan: []step.Step{
+					newStepWithSecrets(step.TypeInfra, "", "123", access1),
+				}},
+			wantStatus: v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{
+					"Infra": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123", Secrets: []v1.SecretVersion{access1}},
+				}},
+			wantSteps: nil,
+			wantErr:   false,
+		},
+		{
+			it: "should replace secret versions that are not keyed",
+			args: args{
+				status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123",
+							Secrets: []v1.SecretVersion{{Path: "infra.state.access", Ref: "vault tf", Version: "abc"}}},
+					}},
+				plan: []step.Step{
+					newStepWithSecrets(step.TypeInfra, "", "123", access1),
+				}},
+			wantStatus: v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{
+					"Infra": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123", Secrets: []v1.SecretVersion{access1}},
+				}},
+			wantSteps: nil,
+			wantErr:   false,
+		},
+		{
+			it: "should tell which hash inputs have changed",
+			args: args{
+				status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Addonsfoo": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "456",
+							HashInputs: map[string]string{"source": "1", "cluster.addons.x": "2", "cluster.addons.jobs": "3"}},
+					}},
+				plan: []step.Step{
+					newStepWithInputs(step.TypeAddons, "foo", "999456", map[string]string{"source": "9", "cluster.addons.x": "9", "cluster.addons.jobs": "3"}),
+				}},
+			wantStatus: v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{
+					"Addonsfoo": {LastTransitionTime: newTime(0), State: "", Message: "cluster.addons.x, source changed", Hash: "456",
+						HashInputs: map[string]string{"source": "1", "cluster.addons.x": "2", "cluster.addons.jobs": "3"}},
+				}},
+			wantSteps: []step.Step{newStepWithInputs(step.TypeAddons, "foo", "999456", map[string]string{"source": "9", "cluster.addons.x": "9", "cluster.addons.jobs": "3"})},
+			wantErr:   false,
+		},
+		{
+			it: "should start tracking hash inputs of a completed step",
+			args: args{
+				status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123"},
+					}},
+				plan: []step.Step{
+					newStepWithInputs(step.TypeInfra, "", "123", map[string]string{"source": "1"}),
+				}},
+			wantStatus: v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{
+					"Infra": {LastTransitionTime: newTime(0), State: "Ready", Message: "new", Hash: "123", HashInputs: map[string]string{"source": "1"}},
+				}},
+			wantSteps: nil,
+			wantErr:   false,
 		},
 	}
 
@@ -266,9 +387,9 @@ func Test_syncStatusWithPlan(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.it, func(t *testing.T) {
 			status := tt.args.status.DeepCopy()
-			gotStep, err := getStepAndSyncStatusWithPlan(status, tt.args.plan, l)
+			gotSteps, err := getStepsAndSyncStatusWithPlan(status, plan.NewGraph(tt.args.plan), l)
 			if assert.NoError(t, err) {
-				assert.Equal(t, tt.wantStep, gotStep)
+				assert.Equal(t, tt.wantSteps, gotSteps)
 				assert.Equal(t, &tt.wantStatus, status)
 			}
 		})
@@ -345,6 +466,30 @@ func Test_updateStatusConditions(t *testing.T) {
 			},
 			wantCondition: v1.EnvironmentCondition{Type: "Ready", Status: "True", Reason: "Ready", Message: "2/2 ready, 0 running, 0 error(s)", LastTransitionTime: time1},
 		},
+		{
+			it: "should say status: False reason: AwaitingApproval when a step waits for approval",
+			args: args{
+				status: &v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra":     {State: "AwaitingApproval", Message: "new", Hash: "123"},
+						"Addonsfoo": {State: "Ready", Message: "new", Hash: "456"},
+					}},
+			},
+			wantCondition: v1.EnvironmentCondition{Type: "Ready", Status: "False", Reason: "AwaitingApproval", Message: "1/2 ready, 0 running, 0 error(s)", LastTransitionTime: time1},
+		},
+		{
+			it: "should say status: False reason: Scheduled when steps wait for a maintenance window",
+			args: args{
+				status: &v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra":     {State: "Ready", Message: "new", Hash: "123"},
+						"Addonsfoo": {State: "", Message: "new", Hash: "456"},
+					},
+					NextWindowStart: &metav1.Time{Time: time.Date(2000, 1, 2, 2, 0, 0, 0, time.UTC)},
+				},
+			},
+			wantCondition: v1.EnvironmentCondition{Type: "Ready", Status: "False", Reason: "Scheduled", Message: "1/2 ready, 0 running, 0 error(s), changes queued, will run at 2000-01-02 02:00 UTC", LastTransitionTime: time1},
+		},
 		{
 			it: "should say status: Unknown, reason: empty when no steps have been defined",
 			args: args{
@@ -370,3 +515,341 @@ func Test_updateStatusConditions(t *testing.T) {
 	}
 
 }
+
+func Test_isApproved(t *testing.T) {
+	newCR := func(annotation string, state v1.StepState) *v1.Environment {
+		cr := &v1.Environment{}
+		if annotation != "" {
+			cr.Annotations = map[string]string{v1.AnnotationApprovedPlan: annotation}
+		}
+		cr.Status.Steps = map[string]v1.StepStatus{
+			"Infra": {State: state, Approval: &v1.PlanApproval{Hash: "abc", StepHash: "123"}},
+		}
+		return cr
+	}
+	stp := &step.InfraStep{
+		Metaa: step.Metaa{ID: step.ID{Type: step.TypeInfra}},
+	}
+
+	tests := []struct {
+		it   string
+		cr   *v1.Environment
+		want bool
+	}{
+		{
+			it:   "should return true when the step is not awaiting approval",
+			cr:   newCR("", v1.StateReady),
+			want: true,
+		},
+		{
+			it:   "should return false when the step is awaiting approval",
+			cr:   newCR("", v1.StateAwaitingApproval),
+			want: false,
+		},
+		{
+			it:   "should return false when another plan is approved",
+			cr:   newCR("def", v1.StateAwaitingApproval),
+			want: false,
+		},
+		{
+			it:   "should return true when the plan is approved",
+			cr:   newCR("abc", v1.StateAwaitingApproval),
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			assert.Equal(t, tt.want, isApproved(tt.cr, stp))
+		})
+	}
+}
+
+func TestEnvironmentReconciler_execute(t *testing.T) {
+	tests := []struct {
+		it               string
+		maxParallelSteps int
+		rollout          v1.RolloutSpec
+		windows          []v1.MaintenanceWindow
+		failing          string
+		pausing          string
+		wantExecuted     []string
+		wantMaxRunning   int32
+		wantPending      []string
+	}{
+		{
+			it:               "should execute the steps of a cluster in order and clusters in parallel",
+			maxParallelSteps: 2,
+			wantExecuted:     []string{"AKSPoolbar", "AKSPoolfoo", "Addonsbar", "Addonsfoo"},
+			wantMaxRunning:   2,
+		},
+		{
+			it:               "should execute one step at a time when max parallel steps is not set",
+			maxParallelSteps: 0,
+			wantExecuted:     []string{"AKSPoolbar", "AKSPoolfoo", "Addonsbar", "Addonsfoo"},
+			wantMaxRunning:   1,
+		},
+		{
+			it:               "should not start new steps after a step fails",
+			maxParallelSteps: 1,
+			failing:          "AKSPoolfoo",
+			wantExecuted:     []string{"AKSPoolfoo"},
+			wantMaxRunning:   1,
+		},
+		{
+			it:               "should not start the next wave before the previous wave is at desired state",
+			maxParallelSteps: 2,
+			rollout: v1.RolloutSpec{
+				Waves: []v1.RolloutWave{
+					{Name: "canary", Clusters: []string{"foo"}},
+				},
+			},
+			wantExecuted:   []string{"AKSPoolfoo", "Addonsfoo"},
+			wantMaxRunning: 1,
+		},
+		{
+			it:               "should continue other clusters when max failures is not exceeded",
+			maxParallelSteps: 1,
+			rollout: v1.RolloutSpec{
+				Waves: []v1.RolloutWave{
+					{Name: "all", Clusters: []string{"foo", "bar"}},
+				},
+				MaxFailures: 1,
+			},
+			failing:        "AKSPoolfoo",
+			wantExecuted:   []string{"AKSPoolbar", "AKSPoolfoo", "Addonsbar"},
+			wantMaxRunning: 1,
+		},
+		{
+			it:               "should let running steps finish but not start new steps when paused",
+			maxParallelSteps: 2,
+			pausing:          "AKSPoolfoo",
+			wantExecuted:     []string{"AKSPoolbar", "AKSPoolfoo"},
+			wantMaxRunning:   2,
+		},
+		{
+			it:               "should list the steps of a cluster outside its window and their dependants once",
+			maxParallelSteps: 1,
+			windows: []v1.MaintenanceWindow{
+				{Steps: []string{"AKSPoolfoo", "Addonsfoo"}, Start: "0 * * * *", Duration: metav1.Duration{Duration: time.Hour}},
+				{Steps: []string{"AKSPoolbar"}, Start: "0 2 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+			wantExecuted:   []string{"AKSPoolfoo", "Addonsfoo"},
+			wantMaxRunning: 1,
+			wantPending:    []string{"AKSPoolbar", "Addonsbar"},
+		},
+	}
+	orgTimeNow := timeNow
+	defer func() { timeNow = orgTimeNow }()
+	timeNow = func() time.Time { return time.Date(2021, 6, 8, 12, 30, 0, 0, time.UTC) }
+
+	scheme := runtime.NewScheme()
+	_ = v1.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			var mu sync.Mutex
+			var executed []string
+			var running, maxRunning int32
+			cl := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(&v1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default"}}).Build()
+			newStep := func(typ step.Type, clusterName, hash string) *fakeStep {
+				return &fakeStep{
+					Metaa: step.Metaa{
+						ID:   step.ID{Type: typ, Namespace: "ns", Name: "name", ClusterName: clusterName},
+						Hash: hash,
+					},
+					exec: func(s *fakeStep) {
+						n := atomic.AddInt32(&running, 1)
+						defer atomic.AddInt32(&running, -1)
+						for {
+							m := atomic.LoadInt32(&maxRunning)
+							if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+								break
+							}
+						}
+						if s.ID.ShortName() == tt.pausing {
+							// user pauses the environment while the step is running.
+							latest := &v1.Environment{}
+							assert.NoError(t, cl.Get(context.Background(), client.ObjectKey{Name: "env1", Namespace: "default"}, latest))
+							latest.Spec.Paused = true
+							assert.NoError(t, cl.Update(context.Background(), latest))
+						}
+						time.Sleep(10 * time.Millisecond)
+
+						mu.Lock()
+						executed = append(executed, s.ID.ShortName())
+						mu.Unlock()
+
+						s.State = v1.StateReady
+						if s.ID.ShortName() == tt.failing {
+							s.State = v1.StateError
+						}
+					},
+				}
+			}
+
+			grph := plan.NewGraph([]step.Step{
+				newStep(step.TypeInfra, "", "123"),
+				newStep(step.TypeAKSPool, "foo", "456"),
+				newStep(step.TypeAddons, "foo", "456"),
+				newStep(step.TypeAKSPool, "bar", "789"),
+				newStep(step.TypeAddons, "bar", "789"),
+			})
+			cr := &v1.Environment{
+				ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default"},
+				Spec: v1.EnvironmentSpec{
+					Rollout: tt.rollout,
+					Windows: tt.windows,
+				},
+				Status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra": {State: v1.StateReady, Hash: "123"},
+					},
+				},
+			}
+			stps, err := getStepsAndSyncStatusWithPlan(&cr.Status, grph, stdr.New(log.New(os.Stdout, "", 0)))
+			assert.NoError(t, err)
+
+			r := &EnvironmentReconciler{
+				Client:           cl,
+				Planner:          &plan.Planner{},
+				MaxParallelSteps: tt.maxParallelSteps,
+			}
+			ctx := logr.NewContext(context.Background(), stdr.New(log.New(os.Stdout, "", 0)))
+			r.execute(ctx, cr, grph, stps)
+
+			sort.Strings(executed)
+			assert.Equal(t, tt.wantExecuted, executed)
+			assert.Equal(t, tt.wantMaxRunning, maxRunning)
+			var pending []string
+			for _, p := range cr.Status.PendingSteps {
+				pending = append(pending, p.Name)
+			}
+			assert.Equal(t, tt.wantPending, pending)
+		})
+	}
+}
+
+// FakeStep is a Step for testing that calls exec when executed.
+type fakeStep struct {
+	step.Metaa
+	exec func(*fakeStep)
+}
+
+func (s *fakeStep) Execute(_ context.Context, _ []string) {
+	s.exec(s)
+}
+
+func TestEnvironmentReconciler_updateDrift(t *testing.T) {
+	tests := []struct {
+		it         string
+		drift      *v1.DriftStatus
+		wantEvents int
+		wantInfra  v1.StepStatus
+	}{
+		{
+			it:         "should record the drift status when no drift is detected",
+			drift:      &v1.DriftStatus{},
+			wantEvents: 0,
+			wantInfra:  v1.StepStatus{State: v1.StateReady, Hash: "123"},
+		},
+		{
+			it: "should record an event when drift is detected",
+			drift: &v1.DriftStatus{
+				Detected:  true,
+				Deleted:   1,
+				Resources: []v1.PlanResource{{Address: "azurerm_subnet.this", Action: "delete"}},
+			},
+			wantEvents: 1,
+			wantInfra:  v1.StepStatus{State: v1.StateReady, Hash: "123"},
+		},
+		{
+			it: "should clear the infra step when drift is remediated",
+			drift: &v1.DriftStatus{
+				Detected:   true,
+				Deleted:    1,
+				Resources:  []v1.PlanResource{{Address: "azurerm_subnet.this", Action: "delete"}},
+				Remediated: true,
+			},
+			wantEvents: 1,
+			wantInfra:  v1.StepStatus{State: "", Hash: "", Message: "remediate drift"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			rec := record.NewFakeRecorder(10)
+			r := &EnvironmentReconciler{Recorder: rec}
+			cr := &v1.Environment{
+				Status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{
+						"Infra": {State: v1.StateReady, Hash: "123"},
+					},
+				},
+			}
+
+			r.updateDrift(cr, tt.drift)
+
+			assert.Equal(t, tt.drift, cr.Status.Drift)
+			assert.Equal(t, tt.wantInfra, cr.Status.Steps["Infra"])
+			assert.Len(t, rec.Events, tt.wantEvents)
+			if tt.wantEvents > 0 {
+				assert.Equal(t, "Warning Drift infra drift detected adds=0 changes=0 deletes=1: delete azurerm_subnet.this", <-rec.Events)
+			}
+		})
+	}
+}
+
+func Test_scheduleDriftCheck(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		it       string
+		drift    *v1.StepStatus
+		wantNext time.Duration
+		wantHash string
+	}{
+		{
+			it:       "should be due when the drift step never ran",
+			wantNext: 0,
+		},
+		{
+			it:       "should not be due within the interval",
+			drift:    &v1.StepStatus{State: v1.StateReady, Hash: "123", LastTransitionTime: metav1.Time{Time: now.Add(-59 * time.Minute)}},
+			wantNext: time.Minute,
+			wantHash: "123",
+		},
+		{
+			it:       "should clear the hash when the check is due",
+			drift:    &v1.StepStatus{State: v1.StateReady, Hash: "123", LastTransitionTime: metav1.Time{Time: now.Add(-time.Hour)}},
+			wantNext: 0,
+			wantHash: "",
+		},
+		{
+			it:       "should retry a failed check when the check is due",
+			drift:    &v1.StepStatus{State: v1.StateError, Hash: "123", LastTransitionTime: metav1.Time{Time: now.Add(-2 * time.Hour)}},
+			wantNext: 0,
+			wantHash: "",
+		},
+		{
+			it:       "should not clear the hash of a running check",
+			drift:    &v1.StepStatus{State: v1.StateRunning, Hash: "123", LastTransitionTime: metav1.Time{Time: now.Add(-2 * time.Hour)}},
+			wantNext: 0,
+			wantHash: "123",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			status := &v1.EnvironmentStatus{
+				Steps: map[string]v1.StepStatus{
+					"Infra": {State: v1.StateReady, Hash: "456"},
+				},
+			}
+			if tt.drift != nil {
+				status.Steps["Drift"] = *tt.drift
+			}
+
+			assert.Equal(t, tt.wantNext, nextDriftCheck(status, time.Hour, now))
+			scheduleDriftCheck(status, time.Hour, now)
+			assert.Equal(t, tt.wantHash, status.Steps["Drift"].Hash)
+			assert.Equal(t, "456", status.Steps["Infra"].Hash, "should not change other steps")
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"net/http"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ValidatePath is the path the EnvironmentValidator is served on.
+const validatePath = "/validate-clusterops-mmlt-nl-v1-environment"
+
+// +kubebuilder:webhook:path=/validate-clusterops-mmlt-nl-v1-environment,mutating=false,failurePolicy=fail,sideEffects=None,groups=clusterops.mmlt.nl,resources=environments,verbs=create;update,versions=v1,name=venvironment.clusterops.mmlt.nl,admissionReviewVersions={v1,v1beta1}
+
+// EnvironmentValidator is an admission webhook that rejects Environments with a spec that can't be reconciled.
+// It performs the same validations as the reconciler does before planning the steps.
+type EnvironmentValidator struct {
+	decoder *admission.Decoder
+}
+
+// SetupWithManager registers the validator with the webhook server of the manager.
+func (v *EnvironmentValidator) SetupWithManager(mgr ctrl.Manager) error {
+	d, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	v.decoder = d
+
+	mgr.GetWebhookServer().Register(validatePath, &webhook.Admission{Handler: v})
+
+	return nil
+}
+
+// Handle allows a request when the Environment spec is valid.
+// Updates that don't change the spec (other than spec.paused) are always allowed, this makes it possible to pause,
+// annotate or delete an Environment that doesn't pass validation.
+func (v *EnvironmentValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	cr := &v1.Environment{}
+	err := v.decoder.Decode(req, cr)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if req.Operation == admissionv1.Update {
+		old := &v1.Environment{}
+		err := v.decoder.DecodeRaw(req.OldObject, old)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if !cr.DeletionTimestamp.IsZero() || sameSpecExceptPaused(old.Spec, cr.Spec) {
+			return admission.Allowed("")
+		}
+	}
+
+	_, err = flattenedClusterSpec(cr.Spec)
+	if err != nil {
+		return admission.Denied(fmt.Sprintf("environment %s: %v", cr.Name, err))
+	}
+
+	return admission.Allowed("")
+}
+
+// SameSpecExceptPaused returns true when a and b are equal when ignoring the paused field.
+func sameSpecExceptPaused(a, b v1.EnvironmentSpec) bool {
+	a.Paused = b.Paused
+	return equality.Semantic.DeepEqual(a, b)
+}
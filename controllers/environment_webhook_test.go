@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"testing"
+)
+
+func TestEnvironmentValidator_Handle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, v1.AddToScheme(scheme))
+	d, err := admission.NewDecoder(scheme)
+	assert.NoError(t, err)
+	v := &EnvironmentValidator{decoder: d}
+
+	tests := []struct {
+		it   string
+		spec func(*v1.EnvironmentSpec)
+		// old (optional) makes the request an update of an Environment with this spec.
+		old        func(*v1.EnvironmentSpec)
+		wantReason string
+	}{
+		{
+			it:   "should allow a valid spec",
+			spec: func(*v1.EnvironmentSpec) {},
+		},
+		{
+			it: "should deny a spec that fails validation",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+			},
+			wantReason: "environment env1: validate spec: spec.clusters: duplicate cluster name cpe",
+		},
+		{
+			it: "should allow pausing an environment that fails validation",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+				es.Paused = true
+			},
+			old: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+			},
+		},
+		{
+			it: "should allow resuming an environment that fails validation",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+			},
+			old: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+				es.Paused = true
+			},
+		},
+		{
+			it: "should allow an update that doesn't change a spec that fails validation",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+			},
+			old: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+			},
+		},
+		{
+			it: "should deny an update that changes a spec that fails validation",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+				es.Infra.EnvDomain = "other.example.com"
+			},
+			old: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+			},
+			wantReason: "environment env1: validate spec: spec.clusters: duplicate cluster name cpe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			cr := &v1.Environment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: v1.GroupVersion.String(), Kind: "Environment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default"},
+				Spec:       *testSpec1(),
+			}
+			req := admissionv1.AdmissionRequest{Operation: admissionv1.Create}
+			if tt.old != nil {
+				old := cr.DeepCopy()
+				tt.old(&old.Spec)
+				raw, err := json.Marshal(old)
+				assert.NoError(t, err)
+				req.Operation = admissionv1.Update
+				req.OldObject = runtime.RawExtension{Raw: raw}
+			}
+			tt.spec(&cr.Spec)
+			raw, err := json.Marshal(cr)
+			assert.NoError(t, err)
+			req.Object = runtime.RawExtension{Raw: raw}
+
+			got := v.Handle(context.Background(), admission.Request{AdmissionRequest: req})
+
+			assert.Equal(t, tt.wantReason == "", got.Allowed)
+			if tt.wantReason != "" {
+				assert.Equal(t, tt.wantReason, string(got.Result.Reason))
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
+)
+
+// +kubebuilder:rbac:groups=clusterops.mmlt.nl,resources=changefreezes,verbs=get;list;watch
+
+// Freezes returns the ChangeFreeze that is in effect for cr at time now (nil if there is none) and the names of the
+// freezes that are in effect but overridden by the cr freeze-override annotation.
+// When freezes overlap the one that ends last is returned.
+func (r *EnvironmentReconciler) freezes(ctx context.Context, cr *v1.Environment, now time.Time) (*v1.ChangeFreeze, []string, error) {
+	var list v1.ChangeFreezeList
+	err := r.List(ctx, &list)
+	if err != nil {
+		return nil, nil, err
+	}
+	frozen, overridden := activeFreeze(list.Items, cr.Annotations[v1.AnnotationFreezeOverride], now)
+	return frozen, overridden, nil
+}
+
+// ActiveFreeze returns the freeze that is in effect at time now and that is not overridden (nil if there is none) and
+// the names of the freezes that are in effect but overridden.
+func activeFreeze(freezes []v1.ChangeFreeze, override string, now time.Time) (*v1.ChangeFreeze, []string) {
+	var frozen *v1.ChangeFreeze
+	var overridden []string
+	for i, f := range freezes {
+		if now.Before(f.Spec.Start.Time) || !now.Before(f.Spec.End.Time) {
+			continue
+		}
+		if f.Name == override {
+			overridden = append(overridden, f.Name)
+			continue
+		}
+		if frozen == nil || f.Spec.End.After(frozen.Spec.End.Time) {
+			frozen = &freezes[i]
+		}
+	}
+	return frozen, overridden
+}
+
+// IsFrozen returns true when a ChangeFreeze is in effect for cr.
+// Errors are logged and treated as not frozen.
+func (r *EnvironmentReconciler) isFrozen(ctx context.Context, cr *v1.Environment) bool {
+	frozen, _, err := r.freezes(ctx, cr, timeNow())
+	if err != nil {
+		logr.FromContext(ctx).Error(err, "list change freezes")
+		return false
+	}
+	return frozen != nil
+}
+
+// SetFrozenCondition updates the Frozen condition in status to reflect the freeze that is in effect (if any) and the
+// freezes that are overridden.
+// The condition is only added when a freeze is in effect, after that it's kept to show when the freeze ended.
+// Returns true when the condition has changed.
+func setFrozenCondition(status *v1.EnvironmentStatus, frozen *v1.ChangeFreeze, overridden []string, now time.Time) bool {
+	c := v1.EnvironmentCondition{
+		Type:               v1.ConditionFrozen,
+		Status:             metav1.ConditionFalse,
+		Reason:             v1.ReasonThawed,
+		Message:            "no change freeze in effect",
+		LastTransitionTime: metav1.Time{Time: now},
+	}
+	switch {
+	case frozen != nil:
+		c.Status = metav1.ConditionTrue
+		c.Reason = v1.ReasonFrozen
+		c.Message = fmt.Sprintf("change freeze %s until %s", frozen.Name, frozen.Spec.End.UTC().Format(time.RFC3339))
+	case len(overridden) > 0:
+		c.Reason = v1.ReasonFreezeOverridden
+		c.Message = fmt.Sprintf("change freeze %s overridden by annotation %s", overridden[0], v1.AnnotationFreezeOverride)
+	}
+
+	for i, x := range status.Conditions {
+		if x.Type != c.Type {
+			continue
+		}
+		if x.Status == c.Status && x.Reason == c.Reason && x.Message == c.Message {
+			return false
+		}
+		status.Conditions[i] = c
+		return true
+	}
+	if c.Reason == v1.ReasonThawed {
+		return false
+	}
+	status.Conditions = append(status.Conditions, c)
+	return true
+}
+
+// FreezeRequests returns a reconcile request for each Environment handled by this reconciler.
+// It's used to reconcile all Environments when a ChangeFreeze changes, for example when a freeze is lifted early.
+func (r *EnvironmentReconciler) freezeRequests(o client.Object) []reconcile.Request {
+	var list v1.EnvironmentList
+	err := r.List(context.Background(), &list, client.MatchingLabels(r.LabelSet))
+	if err != nil {
+		ctrl.Log.WithName("freeze").Error(err, "list environments", "changefreeze", o.GetName())
+		return nil
+	}
+	var reqs []reconcile.Request
+	for i := range list.Items {
+		reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return reqs
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"testing"
+	"time"
+)
+
+func testFreeze(name string, start, end time.Time) v1.ChangeFreeze {
+	return v1.ChangeFreeze{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1.ChangeFreezeSpec{Start: metav1.Time{Time: start}, End: metav1.Time{Time: end}},
+	}
+}
+
+func Test_activeFreeze(t *testing.T) {
+	now := time.Date(2021, 12, 24, 12, 0, 0, 0, time.UTC)
+	yearEnd := testFreeze("year-end", now.Add(-24*time.Hour), now.Add(10*24*time.Hour))
+	release := testFreeze("release", now.Add(-time.Hour), now.Add(24*time.Hour))
+	past := testFreeze("past", now.Add(-48*time.Hour), now)
+	future := testFreeze("future", now.Add(time.Minute), now.Add(time.Hour))
+
+	tests := []struct {
+		it             string
+		freezes        []v1.ChangeFreeze
+		override       string
+		wantFrozen     string
+		wantOverridden []string
+	}{
+		{
+			it: "should not freeze without freezes",
+		},
+		{
+			it:      "should ignore freezes that have ended or not started",
+			freezes: []v1.ChangeFreeze{past, future},
+		},
+		{
+			it:         "should return the freeze that ends last",
+			freezes:    []v1.ChangeFreeze{release, yearEnd, past},
+			wantFrozen: "year-end",
+		},
+		{
+			it:             "should return the freezes that are overridden",
+			freezes:        []v1.ChangeFreeze{yearEnd},
+			override:       "year-end",
+			wantOverridden: []string{"year-end"},
+		},
+		{
+			it:             "should only override the freeze in the annotation",
+			freezes:        []v1.ChangeFreeze{release, yearEnd},
+			override:       "year-end",
+			wantFrozen:     "release",
+			wantOverridden: []string{"year-end"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			frozen, overridden := activeFreeze(tt.freezes, tt.override, now)
+			var name string
+			if frozen != nil {
+				name = frozen.Name
+			}
+			assert.Equal(t, tt.wantFrozen, name)
+			assert.Equal(t, tt.wantOverridden, overridden)
+		})
+	}
+}
+
+func Test_setFrozenCondition(t *testing.T) {
+	now := time.Date(2021, 12, 24, 12, 0, 0, 0, time.UTC)
+	yearEnd := testFreeze("year-end", now.Add(-time.Hour), time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC))
+
+	status := &v1.EnvironmentStatus{}
+	assert.False(t, setFrozenCondition(status, nil, nil, now), "should not add a condition when never frozen")
+	assert.Empty(t, status.Conditions)
+
+	assert.True(t, setFrozenCondition(status, &yearEnd, nil, now))
+	assert.False(t, setFrozenCondition(status, &yearEnd, nil, now.Add(time.Minute)), "should not change when already frozen")
+	if assert.Len(t, status.Conditions, 1) {
+		assert.Equal(t, metav1.ConditionTrue, status.Conditions[0].Status)
+		assert.Equal(t, v1.ReasonFrozen, status.Conditions[0].Reason)
+		assert.Equal(t, "change freeze year-end until 2022-01-03T00:00:00Z", status.Conditions[0].Message)
+		assert.Equal(t, now, status.Conditions[0].LastTransitionTime.Time)
+	}
+
+	assert.True(t, setFrozenCondition(status, nil, []string{"year-end"}, now.Add(time.Hour)))
+	if assert.Len(t, status.Conditions, 1) {
+		assert.Equal(t, metav1.ConditionFalse, status.Conditions[0].Status)
+		assert.Equal(t, v1.ReasonFreezeOverridden, status.Conditions[0].Reason)
+	}
+
+	assert.True(t, setFrozenCondition(status, nil, nil, now.Add(2*time.Hour)))
+	if assert.Len(t, status.Conditions, 1) {
+		assert.Equal(t, v1.ReasonThawed, status.Conditions[0].Reason)
+	}
+}
+
+func TestEnvironmentReconciler_freezes(t *testing.T) {
+	now := time.Date(2021, 12, 24, 12, 0, 0, 0, time.UTC)
+	yearEnd := testFreeze("year-end", now.Add(-time.Hour), now.Add(time.Hour))
+	env1 := &v1.Environment{ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default"}}
+	env2 := &v1.Environment{ObjectMeta: metav1.ObjectMeta{
+		Name:        "env2",
+		Namespace:   "default",
+		Labels:      map[string]string{"team": "other"},
+		Annotations: map[string]string{v1.AnnotationFreezeOverride: "year-end"},
+	}}
+
+	scheme := runtime.NewScheme()
+	_ = v1.AddToScheme(scheme)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&yearEnd, env1, env2).Build()
+	r := &EnvironmentReconciler{Client: cl}
+	ctx := context.Background()
+
+	frozen, overridden, err := r.freezes(ctx, env1, now)
+	assert.NoError(t, err)
+	if assert.NotNil(t, frozen) {
+		assert.Equal(t, "year-end", frozen.Name)
+	}
+	assert.Empty(t, overridden)
+
+	frozen, overridden, err = r.freezes(ctx, env2, now)
+	assert.NoError(t, err)
+	assert.Nil(t, frozen, "should honour the override annotation")
+	assert.Equal(t, []string{"year-end"}, overridden)
+
+	reqs := r.freezeRequests(&yearEnd)
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "env1"}},
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "env2"}},
+	}, reqs, "should reconcile all environments")
+
+	r.LabelSet = map[string]string{"team": "other"}
+	reqs = r.freezeRequests(&yearEnd)
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "default", Name: "env2"}}}, reqs,
+		"should only reconcile the environments of this reconciler")
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"sort"
+)
+
+// ChangedHashInputs returns the sorted names of the hash inputs that differ between last and current.
+// Inputs that are added or removed are changed too.
+// Returns nil when last is unknown (step completed before the inputs were tracked).
+func changedHashInputs(last, current map[string]string) []string {
+	if last == nil {
+		return nil
+	}
+
+	var r []string
+	for n, h := range current {
+		if v, ok := last[n]; !ok || v != h {
+			r = append(r, n)
+		}
+	}
+	for n := range last {
+		if _, ok := current[n]; !ok {
+			r = append(r, n)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/step"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+// MaxStepHistory is the max number of runs that are kept per step.
+const maxStepHistory = 10
+
+// RecordRun updates the history of the step identified by meta.
+// Artefacts are the links to the archived files of a run that has ended.
+// A run is started when the step becomes Running and ends when it becomes Ready, Error or AwaitingApproval.
+// The oldest runs are removed when there are more than maxStepHistory runs.
+func recordRun(status *v1.EnvironmentStatus, meta step.Meta, artefacts []string, now time.Time) {
+	state := meta.GetState()
+	if state == "" {
+		return
+	}
+
+	name := meta.GetID().ShortName()
+	if status.History == nil {
+		status.History = make(map[string]v1.StepRuns)
+	}
+	runs := status.History[name]
+
+	// open returns true when the last run hasn't ended.
+	open := len(runs) > 0 && runs[len(runs)-1].EndTime == nil
+
+	if state == v1.StateRunning {
+		if !open {
+			runs = append(runs, v1.StepRun{StartTime: metav1.Time{Time: now}})
+		}
+		status.History[name] = trimRuns(runs)
+		return
+	}
+
+	if !open {
+		// step ended without running, for example because there is nothing to do.
+		runs = append(runs, v1.StepRun{StartTime: metav1.Time{Time: now}})
+	}
+	run := &runs[len(runs)-1]
+	run.EndTime = &metav1.Time{Time: now}
+	run.Duration = metav1.Duration{Duration: now.Sub(run.StartTime.Time).Round(time.Second)}
+	run.State = state
+	run.Hash = meta.GetHash()
+	run.Message = meta.GetMsg()
+	run.Artefacts = artefacts
+	if c, ok := meta.(step.Counter); ok {
+		a, ch, d := c.GetCounts()
+		run.Added, run.Changed, run.Deleted = int32(a), int32(ch), int32(d)
+	}
+	status.History[name] = trimRuns(runs)
+}
+
+// TrimRuns returns the last maxStepHistory runs.
+func trimRuns(runs v1.StepRuns) v1.StepRuns {
+	if len(runs) <= maxStepHistory {
+		return runs
+	}
+	return append(v1.StepRuns(nil), runs[len(runs)-maxStepHistory:]...)
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_recordRun(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	t1 := t0.Add(90 * time.Second)
+	newStep := func(state v1.StepState, msg string, added int) step.Step {
+		return &step.AddonStep{
+			Metaa: step.Metaa{
+				ID:    step.ID{Type: step.TypeAddons, ClusterName: "one"},
+				Hash:  "123",
+				State: state,
+				Msg:   msg,
+			},
+			Added: added,
+		}
+	}
+
+	status := &v1.EnvironmentStatus{}
+
+	recordRun(status, newStep(v1.StateRunning, "kubectl-tmplt start", 0), nil, t0)
+	recordRun(status, newStep(v1.StateRunning, "kubectl-tmplt running", 0), nil, t0.Add(time.Second))
+	if assert.Len(t, status.History["Addonsone"], 1, "should start a single run") {
+		assert.Nil(t, status.History["Addonsone"][0].EndTime)
+	}
+
+	recordRun(status, newStep(v1.StateReady, "kubectl-tmplt errors=0 added=2", 2), nil, t1)
+	assert.Equal(t, v1.StepRuns{
+		{
+			StartTime: metav1.Time{Time: t0},
+			EndTime:   &metav1.Time{Time: t1},
+			Duration:  metav1.Duration{Duration: 90 * time.Second},
+			State:     v1.StateReady,
+			Hash:      "123",
+			Added:     2,
+			Message:   "kubectl-tmplt errors=0 added=2",
+		},
+	}, status.History["Addonsone"])
+
+	recordRun(status, newStep(v1.StateError, "failed", 0), nil, t1)
+	if assert.Len(t, status.History["Addonsone"], 2, "should record a run that ended without running") {
+		assert.Equal(t, v1.StateError, status.History["Addonsone"][1].State)
+		assert.Equal(t, metav1.Duration{}, status.History["Addonsone"][1].Duration)
+	}
+}
+
+func Test_recordRun_isBounded(t *testing.T) {
+	status := &v1.EnvironmentStatus{}
+	for i := 0; i < maxStepHistory+5; i++ {
+		recordRun(status, &step.InfraStep{
+			Metaa: step.Metaa{ID: step.ID{Type: step.TypeInfra}, State: v1.StateReady, Hash: strconv.Itoa(i)},
+		}, nil, time.Unix(int64(i), 0))
+	}
+
+	runs := status.History["Infra"]
+	if assert.Len(t, runs, maxStepHistory) {
+		assert.Equal(t, "5", runs[0].Hash, "should drop the oldest runs")
+		assert.Equal(t, strconv.Itoa(maxStepHistory+4), runs[len(runs)-1].Hash)
+	}
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/metrics"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"time"
+)
+
+// ObserveStep counts the execution of the step identified by meta and observes its duration when the step has ended.
+func observeStep(meta step.Meta, now time.Time) {
+	switch meta.GetState() {
+	case v1.StateReady, v1.StateError, v1.StateAwaitingApproval:
+	default:
+		return
+	}
+
+	t := string(meta.GetID().Type)
+	metrics.StepExecutions.WithLabelValues(t, string(meta.GetState())).Inc()
+	if start := meta.GetStartTime(); !start.IsZero() {
+		metrics.StepDuration.WithLabelValues(t).Observe(now.Sub(start).Seconds())
+	}
+}
+
+// ObserveErrors sets the number of steps of cr that are in Error state.
+func observeErrors(cr *v1.Environment) {
+	n := len(stepsInState(cr.Status.Steps, v1.StateError))
+	metrics.StepsInError.WithLabelValues(cr.Namespace, cr.Name).Set(float64(n))
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/metrics"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func Test_observeStep(t *testing.T) {
+	executions := func(state v1.StepState) float64 {
+		return testutil.ToFloat64(metrics.StepExecutions.WithLabelValues(string(step.TypeDrift), string(state)))
+	}
+	now := time.Now()
+	newStep := func(state v1.StepState) step.Meta {
+		return &step.DriftStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeDrift}, State: state, StartTime: now.Add(-time.Minute)}}
+	}
+
+	readyBefore, errorBefore := executions(v1.StateReady), executions(v1.StateError)
+
+	observeStep(newStep(v1.StateRunning), now)
+	observeStep(newStep(v1.StateReady), now)
+	observeStep(newStep(v1.StateError), now)
+
+	assert.Equal(t, readyBefore+1, executions(v1.StateReady))
+	assert.Equal(t, errorBefore+1, executions(v1.StateError))
+	assert.Equal(t, float64(0), executions(v1.StateRunning), "should not count running steps")
+}
+
+func Test_observeErrors(t *testing.T) {
+	cr := &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "metrics", Namespace: "default"},
+		Status: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+			"Infra":      {State: v1.StateReady},
+			"AKSPoolxyz": {State: v1.StateError},
+			"Addonsxyz":  {State: v1.StateError},
+		}},
+	}
+
+	observeErrors(cr)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.StepsInError.WithLabelValues("default", "metrics")))
+
+	cr.Status.Steps["Addonsxyz"] = v1.StepStatus{State: v1.StateReady}
+	observeErrors(cr)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.StepsInError.WithLabelValues("default", "metrics")))
+}
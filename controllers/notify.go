@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/notify"
+	"github.com/mmlt/environment-operator/pkg/redact"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"time"
+)
+
+// SetNotifyTargets resolves the notifications of cr and makes them the notification targets of cr.
+// Notifications that can't be resolved or are invalid are reported as an Event, they don't stop the reconciliation.
+func (r *EnvironmentReconciler) setNotifyTargets(ctx context.Context, cr *v1.Environment) {
+	if r.Notifier == nil {
+		return
+	}
+
+	var targets []notify.Target
+	for i, spec := range cr.Spec.Notifications {
+		spec := *spec.DeepCopy()
+		secrets, err := vaultValues(ctx, &spec, fmt.Sprintf("notifications[%d]", i), r.secretMux(), cr.Namespace)
+		redact.Append(cr.Namespace+"/"+cr.Name, secretValues(secrets)...)
+		if err != nil {
+			r.Recorder.Event(cr, "Warning", "Config", err.Error())
+			continue
+		}
+		redact.Append(cr.Namespace+"/"+cr.Name, spec.URL, spec.Secret)
+		t, err := notify.TargetFromSpec(spec)
+		if err != nil {
+			r.Recorder.Event(cr, "Warning", "Config", err.Error())
+			continue
+		}
+		targets = append(targets, t)
+	}
+	r.Notifier.SetTargets(cr.Namespace, cr.Name, targets)
+}
+
+// Notify sends a notification when the step identified by meta has changed state from previous.
+// The Drift step only notifies when it fails or recovers from a failure, detected drift is reported as an Event.
+func (r *EnvironmentReconciler) notify(cr *v1.Environment, meta step.Meta, previous v1.StepState, now time.Time) {
+	if r.Notifier == nil || meta.GetState() == previous {
+		return
+	}
+	if meta.GetID().Type == step.TypeDrift && meta.GetState() != v1.StateError && previous != v1.StateError {
+		return
+	}
+
+	r.Notifier.Notify(notify.Event{
+		Namespace:     cr.Namespace,
+		Environment:   cr.Name,
+		Step:          meta.GetID().ShortName(),
+		Type:          string(meta.GetID().Type),
+		State:         meta.GetState(),
+		PreviousState: previous,
+		Message:       meta.GetMsg(),
+		Time:          now,
+	})
+}
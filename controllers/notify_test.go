@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/notify"
+	"github.com/mmlt/environment-operator/pkg/secret"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnvironmentReconciler_notify(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, r.URL.Path+" "+string(b))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cr := &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default"},
+		Spec: v1.EnvironmentSpec{
+			Notifications: []v1.NotificationSpec{
+				{Type: v1.NotificationSlack, URL: "vault slack url", States: []v1.StepState{v1.StateError}},
+				{Type: v1.NotificationSlack, URL: "vault nonexisting url"},
+			},
+		},
+	}
+	rec := record.NewFakeRecorder(10)
+	r := &EnvironmentReconciler{
+		Recorder: rec,
+		Secrets:  &secret.Mux{Default: fakeSecrets{"slack/url": srv.URL + "/hook"}},
+		Notifier: &notify.Notifier{},
+	}
+
+	r.setNotifyTargets(context.Background(), cr)
+	assert.Len(t, rec.Events, 1, "should report the notification that can't be resolved")
+	assert.Equal(t, "vault slack url", cr.Spec.Notifications[0].URL, "spec should not be modified")
+
+	stp := &fakeStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeInfra}, State: v1.StateError, Msg: "boom"}}
+	r.notify(cr, stp, v1.StateRunning, time.Now())
+	r.notify(cr, stp, v1.StateError, time.Now())
+	r.Notifier.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{`/hook {"text":":x: default/env1 Infra Error: boom"}`}, got, "should notify state changes only")
+}
+
+func TestEnvironmentReconciler_notify_drift(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, string(b))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cr := &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default"},
+		Spec: v1.EnvironmentSpec{
+			Notifications: []v1.NotificationSpec{{Type: v1.NotificationSlack, URL: "vault slack url"}},
+		},
+	}
+	r := &EnvironmentReconciler{
+		Recorder: record.NewFakeRecorder(10),
+		Secrets:  &secret.Mux{Default: fakeSecrets{"slack/url": srv.URL}},
+		Notifier: &notify.Notifier{},
+	}
+	r.setNotifyTargets(context.Background(), cr)
+
+	drift := func(state v1.StepState) step.Step {
+		return &fakeStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeDrift}, State: state, Msg: "check"}}
+	}
+	// a periodic drift check.
+	r.notify(cr, drift(v1.StateRunning), v1.StateReady, time.Now())
+	r.notify(cr, drift(v1.StateReady), v1.StateRunning, time.Now())
+	// a failing drift check.
+	r.notify(cr, drift(v1.StateError), v1.StateRunning, time.Now())
+	r.Notifier.Wait()
+	// a recovering drift check.
+	r.notify(cr, drift(v1.StateRunning), v1.StateError, time.Now())
+	r.Notifier.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, got, 2, "should notify failures and recoveries only") {
+		assert.Contains(t, got[0], "Drift Error")
+		assert.Contains(t, got[1], "Drift Running")
+	}
+}
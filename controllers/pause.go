@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+// SetPausedCondition updates the Paused condition in status to reflect paused.
+// The condition is only added when the Environment is paused, after that it's kept to show when it was resumed.
+// Returns true when the condition has changed.
+func setPausedCondition(status *v1.EnvironmentStatus, paused bool, now time.Time) bool {
+	c := v1.EnvironmentCondition{
+		Type:               v1.ConditionPaused,
+		Status:             metav1.ConditionFalse,
+		Reason:             v1.ReasonResumed,
+		Message:            "steps are started",
+		LastTransitionTime: metav1.Time{Time: now},
+	}
+	if paused {
+		c.Status = metav1.ConditionTrue
+		c.Reason = v1.ReasonPaused
+		c.Message = "no new steps are started until spec.paused is false"
+	}
+
+	for i, x := range status.Conditions {
+		if x.Type != c.Type {
+			continue
+		}
+		if x.Status == c.Status {
+			return false
+		}
+		status.Conditions[i] = c
+		return true
+	}
+	if !paused {
+		return false
+	}
+	status.Conditions = append(status.Conditions, c)
+	return true
+}
+
+// IsPaused returns true when the latest version of cr is paused.
+// Errors are logged and treated as not paused.
+func (r *EnvironmentReconciler) isPaused(ctx context.Context, cr *v1.Environment) bool {
+	latest := &v1.Environment{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(cr), latest)
+	if err != nil {
+		logr.FromContext(ctx).Error(err, "get environment to check pause")
+		return false
+	}
+	return latest.Spec.Paused
+}
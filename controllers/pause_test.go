@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func Test_setPausedCondition(t *testing.T) {
+	now := time.Unix(100, 0)
+	ready := v1.EnvironmentCondition{Type: "Ready", Status: metav1.ConditionTrue, Reason: v1.ReasonReady}
+
+	status := &v1.EnvironmentStatus{Conditions: []v1.EnvironmentCondition{ready}}
+	assert.False(t, setPausedCondition(status, false, now), "should not add a condition when never paused")
+	assert.Len(t, status.Conditions, 1)
+
+	assert.True(t, setPausedCondition(status, true, now))
+	assert.False(t, setPausedCondition(status, true, now.Add(time.Minute)), "should not change when already paused")
+	if assert.Len(t, status.Conditions, 2) {
+		assert.Equal(t, ready, status.Conditions[0])
+		assert.Equal(t, metav1.ConditionTrue, status.Conditions[1].Status)
+		assert.Equal(t, v1.ReasonPaused, status.Conditions[1].Reason)
+		assert.Equal(t, now, status.Conditions[1].LastTransitionTime.Time)
+	}
+
+	assert.True(t, setPausedCondition(status, false, now.Add(time.Hour)))
+	if assert.Len(t, status.Conditions, 2) {
+		assert.Equal(t, metav1.ConditionFalse, status.Conditions[1].Status)
+		assert.Equal(t, v1.ReasonResumed, status.Conditions[1].Reason)
+	}
+}
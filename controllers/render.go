@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"github.com/mitchellh/hashstructure"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"strconv"
+)
+
+// Render returns a copy of environment with spec.defaults merged into spec.clusters and status.clusters set to the
+// hashes of the effective cluster specs.
+// Spec.defaults is kept so status.clusters defaultsHash doesn't change, merging it again doesn't change the clusters.
+// Applying the rendered environment results in the same cluster configuration and status as applying the original.
+func Render(environment *v1.Environment) (*v1.Environment, error) {
+	cspec, err := flattenedClusterSpec(environment.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	r := environment.DeepCopy()
+	r.Status = v1.EnvironmentStatus{
+		Clusters: clusterStatus(environment.Spec.Defaults, cspec),
+	}
+	r.Spec.Clusters = cspec
+
+	return r, nil
+}
+
+// ClusterStatus returns the hashes of the effective cluster specs by cluster name.
+// The hashes are calculated before vault references are resolved so they don't depend on secret values.
+func clusterStatus(defaults v1.ClusterSpec, clusters []v1.ClusterSpec) map[string]v1.ClusterStatus {
+	dh := specHash(defaults)
+	r := make(map[string]v1.ClusterStatus, len(clusters))
+	for _, c := range clusters {
+		r[c.Name] = v1.ClusterStatus{
+			SpecHash:     specHash(c),
+			DefaultsHash: dh,
+		}
+	}
+	return r
+}
+
+// SpecHash returns a string that is unique for spec.
+func specHash(spec interface{}) string {
+	i, err := hashstructure.Hash(spec, nil)
+	if err != nil {
+		return "hasherror"
+	}
+	return strconv.FormatUint(i, 16)
+}
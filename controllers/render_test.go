@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	in := &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default"},
+		Spec:       *testSpec1(),
+	}
+
+	got, err := Render(in)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	want, err := flattenedClusterSpec(in.Spec)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got.Spec.Clusters, "clusters should contain the defaults")
+	assert.Equal(t, in.Spec.Defaults, got.Spec.Defaults, "defaults should be kept")
+	assert.Equal(t, *testSpec1(), in.Spec, "input should not be modified")
+
+	// rendering a rendered environment gives the same clusters.
+	again, err := Render(got)
+	assert.NoError(t, err)
+	assert.Equal(t, got.Spec.Clusters, again.Spec.Clusters)
+
+	if assert.Len(t, got.Status.Clusters, 2) {
+		cpe, second := got.Status.Clusters["cpe"], got.Status.Clusters["second"]
+		assert.NotEqual(t, cpe.SpecHash, second.SpecHash)
+		assert.Equal(t, cpe.DefaultsHash, second.DefaultsHash)
+		assert.Equal(t, cpe, again.Status.Clusters["cpe"], "effective spec and defaults should not change")
+	}
+}
+
+func Test_clusterStatus(t *testing.T) {
+	spec := testSpec1()
+	cspec, err := flattenedClusterSpec(*spec)
+	assert.NoError(t, err)
+	before := clusterStatus(spec.Defaults, cspec)
+
+	// changing a default that is overridden by all clusters changes the defaults hash but not the spec hash.
+	spec.Defaults.Infra.X["overridden"] = "changed"
+	cspec, err = flattenedClusterSpec(*spec)
+	assert.NoError(t, err)
+	after := clusterStatus(spec.Defaults, cspec)
+
+	assert.NotEqual(t, before["cpe"].DefaultsHash, after["cpe"].DefaultsHash)
+	assert.Equal(t, before["cpe"].SpecHash, after["cpe"].SpecHash)
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/plan"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"strings"
+	"time"
+)
+
+// Halted returns true when the failed steps prevent other steps from being executed.
+// Without rollout waves any failed step halts the environment.
+// With rollout waves the environment is halted when an infra step failed or when more than rollout.maxFailures
+// clusters have a failed step.
+// A failed drift check never halts the environment, it's read-only and tried again when the next check is due.
+func halted(rollout v1.RolloutSpec, failed []string) bool {
+	failed = without(failed, string(step.TypeDrift))
+	if len(failed) == 0 {
+		return false
+	}
+	if len(rollout.Waves) == 0 {
+		return true
+	}
+
+	clusters := make(map[string]struct{})
+	for _, n := range failed {
+		cn, ok := clusterOfStep(n)
+		if !ok {
+			return true
+		}
+		clusters[cn] = struct{}{}
+	}
+
+	return int32(len(clusters)) > rollout.MaxFailures
+}
+
+// Without returns s without the elements that are equal to x.
+func without(s []string, x string) []string {
+	var r []string
+	for _, v := range s {
+		if v != x {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// StepsInState returns the names of the steps that are in state.
+func stepsInState(stps map[string]v1.StepStatus, state v1.StepState) []string {
+	var r []string
+	for n, stp := range stps {
+		if stp.State == state {
+			r = append(r, n)
+		}
+	}
+	return r
+}
+
+// ClusterOfStep returns the cluster name of a step short name.
+// Returns false for steps that don't belong to a cluster.
+func clusterOfStep(shortName string) (string, bool) {
+	for _, t := range step.ClusterTypes {
+		if strings.HasPrefix(shortName, string(t)) {
+			return strings.TrimPrefix(shortName, string(t)), true
+		}
+	}
+	return "", false
+}
+
+// WaveGate returns true when stp is allowed to start according to the rollout waves.
+// A step of a cluster can start when the clusters of all previous waves are at desired state and have been Ready for
+// at least rollout.soak. Clusters with a failed step are not waited for, they are accounted for by halted().
+// When the gate is closed because clusters are soaking the remaining soak time is returned.
+func waveGate(rollout v1.RolloutSpec, grph plan.Graph, stps map[string]v1.StepStatus, stp step.Step, now time.Time) (bool, time.Duration) {
+	id := stp.GetID()
+	if id.ClusterName == "" || len(rollout.Waves) == 0 {
+		return true, 0
+	}
+	wave := plan.ClusterWave(rollout, id.ClusterName)
+
+	type clusterState struct {
+		pending, failed bool
+		readySince      time.Time
+	}
+	clusters := make(map[string]*clusterState)
+	for _, s := range grph.Steps {
+		cn := s.GetID().ClusterName
+		if cn == "" || plan.ClusterWave(rollout, cn) >= wave {
+			continue
+		}
+		cs, ok := clusters[cn]
+		if !ok {
+			cs = &clusterState{}
+			clusters[cn] = cs
+		}
+
+		st := stps[s.GetID().ShortName()]
+		switch {
+		case st.State == v1.StateError:
+			cs.failed = true
+		case st.Hash != s.GetHash():
+			cs.pending = true
+		case st.LastTransitionTime.After(cs.readySince):
+			cs.readySince = st.LastTransitionTime.Time
+		}
+	}
+
+	var wait time.Duration
+	for _, cs := range clusters {
+		if cs.failed {
+			continue
+		}
+		if cs.pending {
+			return false, 0
+		}
+		if d := cs.readySince.Add(rollout.Soak.Duration).Sub(now); d > wait {
+			wait = d
+		}
+	}
+
+	return wait <= 0, wait
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/plan"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func Test_halted(t *testing.T) {
+	waves := v1.RolloutSpec{
+		Waves: []v1.RolloutWave{
+			{Name: "canary", Clusters: []string{"canary"}},
+		},
+		MaxFailures: 1,
+	}
+
+	tests := []struct {
+		it      string
+		rollout v1.RolloutSpec
+		failed  []string
+		want    bool
+	}{
+		{
+			it:   "should not halt when no steps failed",
+			want: false,
+		},
+		{
+			it:     "should halt on any failure when there are no waves",
+			failed: []string{"Addonsfoo"},
+			want:   true,
+		},
+		{
+			it:      "should halt when an infra step failed",
+			rollout: waves,
+			failed:  []string{"Infra"},
+			want:    true,
+		},
+		{
+			it:     "should not halt when a drift check failed",
+			failed: []string{"Drift"},
+			want:   false,
+		},
+		{
+			it:      "should not halt when max failures is not exceeded",
+			rollout: waves,
+			failed:  []string{"AKSPoolfoo", "Addonsfoo"},
+			want:    false,
+		},
+		{
+			it:      "should halt when max failures is exceeded",
+			rollout: waves,
+			failed:  []string{"AKSPoolfoo", "Addonsbar"},
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			assert.Equal(t, tt.want, halted(tt.rollout, tt.failed))
+		})
+	}
+}
+
+func Test_clusterOfStep(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{in: "Infra", want: "", wantOK: false},
+		{in: "Destroy", want: "", wantOK: false},
+		{in: "AKSPoolfoo", want: "foo", wantOK: true},
+		{in: "AKSAddonPreflightfoo", want: "foo", wantOK: true},
+		{in: "Addonsfoo", want: "foo", wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := clusterOfStep(tt.in)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_waveGate(t *testing.T) {
+	newStep := func(typ step.Type, clusterName, hash string) step.Step {
+		return &step.AddonStep{
+			Metaa: step.Metaa{
+				ID:   step.ID{Type: typ, Namespace: "ns", Name: "name", ClusterName: clusterName},
+				Hash: hash,
+			},
+		}
+	}
+	grph := plan.NewGraph([]step.Step{
+		newStep(step.TypeInfra, "", "1"),
+		newStep(step.TypeAddons, "canary", "2"),
+		newStep(step.TypeAddons, "foo", "3"),
+	})
+	rollout := v1.RolloutSpec{
+		Waves: []v1.RolloutWave{
+			{Name: "canary", Clusters: []string{"canary"}},
+		},
+		Soak: metav1.Duration{Duration: 10 * time.Minute},
+	}
+	now := time.Unix(3600, 0)
+	readyAt := func(d time.Duration, hash string) v1.StepStatus {
+		return v1.StepStatus{State: v1.StateReady, Hash: hash, LastTransitionTime: metav1.Time{Time: now.Add(-d)}}
+	}
+
+	tests := []struct {
+		it       string
+		rollout  v1.RolloutSpec
+		stps     map[string]v1.StepStatus
+		stp      step.Step
+		want     bool
+		wantWait time.Duration
+	}{
+		{
+			it:      "should be open for clusters when there are no waves",
+			rollout: v1.RolloutSpec{},
+			stp:     grph.Steps[2],
+			want:    true,
+		},
+		{
+			it:      "should be open for infra steps",
+			rollout: rollout,
+			stp:     grph.Steps[0],
+			want:    true,
+		},
+		{
+			it:      "should be open for the first wave",
+			rollout: rollout,
+			stp:     grph.Steps[1],
+			want:    true,
+		},
+		{
+			it:      "should be closed when a previous wave is not at desired state",
+			rollout: rollout,
+			stps: map[string]v1.StepStatus{
+				"Addonscanary": readyAt(time.Hour, "old"),
+			},
+			stp:  grph.Steps[2],
+			want: false,
+		},
+		{
+			it:      "should be closed with the remaining time when a previous wave is soaking",
+			rollout: rollout,
+			stps: map[string]v1.StepStatus{
+				"Addonscanary": readyAt(4*time.Minute, "2"),
+			},
+			stp:      grph.Steps[2],
+			want:     false,
+			wantWait: 6 * time.Minute,
+		},
+		{
+			it:      "should be open when a previous wave has soaked",
+			rollout: rollout,
+			stps: map[string]v1.StepStatus{
+				"Addonscanary": readyAt(time.Hour, "2"),
+			},
+			stp:  grph.Steps[2],
+			want: true,
+		},
+		{
+			it:      "should be open when a previous wave has failed",
+			rollout: rollout,
+			stps: map[string]v1.StepStatus{
+				"Addonscanary": {State: v1.StateError, Hash: "old"},
+			},
+			stp:  grph.Steps[2],
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, gotWait := waveGate(tt.rollout, grph, tt.stps, tt.stp, now)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantWait, gotWait)
+		})
+	}
+}
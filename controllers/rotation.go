@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"strings"
+)
+
+// StepSecretVersions returns the versions of the secrets that are used by the step with id.
+// Infra type steps use the infra and clusters infra secrets except the infra source token, Addons steps use the
+// addons secrets of their cluster (including the source token).
+func stepSecretVersions(id step.ID, secrets []resolvedSecret, key []byte) []v1.SecretVersion {
+	var r []v1.SecretVersion
+	for _, s := range secrets {
+		if usesSecret(id, s.Path) {
+			r = append(r, v1.SecretVersion{Path: s.Path, Ref: s.Ref, Version: secretVersion(key, s.Value)})
+		}
+	}
+	return r
+}
+
+// UsesSecret returns true when the step with id uses the secret referred to by the field at path.
+func usesSecret(id step.ID, path string) bool {
+	switch id.Type {
+	case step.TypeInfra, step.TypeDestroy, step.TypeDrift:
+		if strings.HasPrefix(path, "infra.") {
+			return !strings.HasPrefix(path, "infra.source.")
+		}
+		return strings.HasPrefix(path, "clusters[") && strings.Contains(path, "].infra.")
+	case step.TypeAddons:
+		return strings.HasPrefix(path, "clusters["+id.ClusterName+"].addons.")
+	}
+	return false
+}
+
+// SecretVersionPrefix marks the secret versions that are keyed.
+// Versions without the prefix are unsalted hashes recorded by previous releases.
+const secretVersionPrefix = "hmac:"
+
+// SecretVersion returns an opaque value that changes when value changes.
+// The version is a HMAC keyed with key (a secret of the operator) so guesses of the value can't be tested against the
+// version by users that can read the Environment status.
+func secretVersion(key []byte, value string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(value))
+	return secretVersionPrefix + hex.EncodeToString(m.Sum(nil)[:12])
+}
+
+// LegacySecretVersions returns true when versions contains versions that are not keyed.
+func legacySecretVersions(versions []v1.SecretVersion) bool {
+	for _, v := range versions {
+		if !strings.HasPrefix(v.Version, secretVersionPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RotatedSecrets returns the paths of the secrets in current that have a different version in last.
+// Secrets that are not in last are new references and are not considered rotated.
+// Versions in last that are not keyed can't be compared and are ignored.
+func rotatedSecrets(last, current []v1.SecretVersion) []string {
+	lv := make(map[string]string, len(last))
+	for _, s := range last {
+		if strings.HasPrefix(s.Version, secretVersionPrefix) {
+			lv[s.Path] = s.Version
+		}
+	}
+
+	var r []string
+	for _, s := range current {
+		if v, ok := lv[s.Path]; ok && v != s.Version {
+			r = append(r, s.Path)
+		}
+	}
+	return r
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_stepSecretVersions(t *testing.T) {
+	secrets := []resolvedSecret{
+		{Path: "infra.state.access", Ref: "vault tf access", Value: "a"},
+		{Path: "infra.source.token", Ref: "vault git token", Value: "b"},
+		{Path: "clusters[one].infra.pools.default.vmSize", Ref: "vault vm", Value: "c"},
+		{Path: "clusters[one].addons.source.token", Ref: "vault git token", Value: "b"},
+		{Path: "clusters[two].addons.x.key", Ref: "vault x", Value: "d"},
+	}
+	paths := func(vs []v1.SecretVersion) []string {
+		var r []string
+		for _, v := range vs {
+			r = append(r, v.Path)
+		}
+		return r
+	}
+
+	tests := []struct {
+		it   string
+		id   step.ID
+		want []string
+	}{
+		{
+			it:   "should return infra secrets except the source token for Infra",
+			id:   step.ID{Type: step.TypeInfra},
+			want: []string{"infra.state.access", "clusters[one].infra.pools.default.vmSize"},
+		},
+		{
+			it:   "should return the same secrets for Drift as for Infra",
+			id:   step.ID{Type: step.TypeDrift},
+			want: []string{"infra.state.access", "clusters[one].infra.pools.default.vmSize"},
+		},
+		{
+			it:   "should return the addons secrets of the cluster for Addons",
+			id:   step.ID{Type: step.TypeAddons, ClusterName: "one"},
+			want: []string{"clusters[one].addons.source.token"},
+		},
+		{
+			it:   "should return no secrets for steps that don't use them",
+			id:   step.ID{Type: step.TypeAKSPool, ClusterName: "one"},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			assert.Equal(t, tt.want, paths(stepSecretVersions(tt.id, secrets, []byte("key"))))
+		})
+	}
+}
+
+func Test_secretVersion(t *testing.T) {
+	key := []byte("key")
+	assert.Equal(t, secretVersion(key, "s3cr3t"), secretVersion(key, "s3cr3t"))
+	assert.NotEqual(t, secretVersion(key, "s3cr3t"), secretVersion(key, "s3cr3t2"))
+	assert.NotEqual(t, secretVersion(key, "s3cr3t"), secretVersion([]byte("other"), "s3cr3t"), "should depend on the key")
+	assert.NotContains(t, secretVersion(key, "s3cr3t"), "s3cr3t")
+}
+
+func Test_rotatedSecrets(t *testing.T) {
+	last := []v1.SecretVersion{{Path: "a", Version: "hmac:1"}, {Path: "b", Version: "hmac:1"}, {Path: "d", Version: "1"}}
+	current := []v1.SecretVersion{{Path: "a", Version: "hmac:2"}, {Path: "b", Version: "hmac:1"}, {Path: "c", Version: "hmac:1"},
+		{Path: "d", Version: "hmac:2"}}
+
+	assert.Equal(t, []string{"a"}, rotatedSecrets(last, current))
+	assert.Nil(t, rotatedSecrets(nil, current), "untracked secrets are not rotated")
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/plan"
+	"github.com/mmlt/environment-operator/pkg/step"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sort"
+	"time"
+)
+
+// +kubebuilder:rbac:groups=clusterops.mmlt.nl,resources=environmentruns,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=clusterops.mmlt.nl,resources=environmentruns/status,verbs=get;update;patch
+
+// StartRun creates an EnvironmentRun for the steps in grph.
+// The started steps are added to the run when they are started, see addRunStep.
+// Errors are logged, nil is returned when the run can't be created.
+func (r *EnvironmentReconciler) startRun(ctx context.Context, cr *v1.Environment, grph plan.Graph) *v1.EnvironmentRun {
+	log := logr.FromContext(ctx)
+
+	var src plan.Sourcer
+	if r.Sources != nil {
+		src = r.Sources
+	}
+	r.statusMu.Lock()
+	run := newRun(cr, grph, src)
+	r.statusMu.Unlock()
+
+	err := controllerutil.SetControllerReference(cr, run, r.Scheme)
+	if err != nil {
+		log.Error(err, "run: owner reference")
+		return nil
+	}
+
+	status := run.Status
+	err = r.Create(ctx, run)
+	if err != nil {
+		log.Error(err, "run: create")
+		return nil
+	}
+	// status is a subresource, it's ignored by create.
+	run.Status = status
+	err = r.Status().Update(ctx, run)
+	if err != nil {
+		log.Error(err, "run: update status")
+	}
+
+	r.pruneRuns(ctx, cr)
+
+	return run
+}
+
+// CompleteRun records the outcome of the started steps of run.
+// Errors are logged.
+func (r *EnvironmentReconciler) completeRun(ctx context.Context, cr *v1.Environment, grph plan.Graph, run *v1.EnvironmentRun) {
+	r.statusMu.Lock()
+	runOutcome(run, cr.Status, grph, timeNow())
+	r.statusMu.Unlock()
+
+	err := r.Status().Update(ctx, run)
+	if err != nil {
+		logr.FromContext(ctx).Error(err, "run: update status")
+	}
+}
+
+// AddRunStep records that stp is started by run.
+func addRunStep(run *v1.EnvironmentRun, stp step.Step) {
+	if run == nil {
+		return
+	}
+	run.Status.StartedSteps = append(run.Status.StartedSteps, stp.GetID().ShortName())
+}
+
+// PruneRuns deletes the oldest runs of cr when there are more than MaxRuns.
+// Errors are logged.
+func (r *EnvironmentReconciler) pruneRuns(ctx context.Context, cr *v1.Environment) {
+	log := logr.FromContext(ctx)
+
+	var runs v1.EnvironmentRunList
+	err := r.List(ctx, &runs, client.InNamespace(cr.Namespace), client.MatchingLabels{v1.LabelEnvironment: cr.Name})
+	if err != nil {
+		log.Error(err, "run: list")
+		return
+	}
+
+	items := runs.Items
+	sort.Slice(items, func(i, j int) bool {
+		ti, tj := items[i].Status.StartTime, items[j].Status.StartTime
+		if ti.Equal(&tj) {
+			return items[i].Name < items[j].Name
+		}
+		return ti.Before(&tj)
+	})
+	for i := 0; i < len(items)-r.MaxRuns; i++ {
+		err := r.Delete(ctx, &items[i])
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "run: delete", "name", items[i].Name)
+		}
+	}
+}
+
+// NewRun returns an EnvironmentRun for the steps in grph.
+// Sources are the hashes of the sources used by the steps in grph.
+func newRun(cr *v1.Environment, grph plan.Graph, src plan.Sourcer) *v1.EnvironmentRun {
+	run := &v1.EnvironmentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: cr.Name + "-",
+			Namespace:    cr.Namespace,
+			Labels:       map[string]string{v1.LabelEnvironment: cr.Name},
+		},
+		Spec: v1.EnvironmentRunSpec{
+			EnvironmentName: cr.Name,
+			Generation:      cr.Generation,
+			Sources:         make(map[string]string),
+		},
+		Status: v1.EnvironmentRunStatus{
+			StartTime: metav1.Time{Time: timeNow()},
+			Phase:     v1.RunPhaseRunning,
+		},
+	}
+
+	nsn := types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name}
+	for _, stp := range grph.Steps {
+		id := stp.GetID()
+		run.Spec.Steps = append(run.Spec.Steps, id.ShortName())
+
+		k := id.ClusterName
+		if k == "" {
+			k = "infra"
+		}
+		if _, ok := run.Spec.Sources[k]; ok || src == nil {
+			continue
+		}
+		if w, ok := src.Workspace(nsn, id.ClusterName); ok {
+			run.Spec.Sources[k] = w.Hash
+		}
+	}
+
+	return run
+}
+
+// RunOutcome updates run with the state of the started steps in status.
+// The run has failed when a started step didn't become Ready, it's awaiting approval when the other started steps
+// are Ready but one waits for an approval.
+func runOutcome(run *v1.EnvironmentRun, status v1.EnvironmentStatus, grph plan.Graph, now time.Time) {
+	hashes := make(map[string]string, len(grph.Steps))
+	for _, stp := range grph.Steps {
+		hashes[stp.GetID().ShortName()] = stp.GetHash()
+	}
+
+	run.Status.Phase = v1.RunPhaseSucceeded
+	run.Status.Steps = make(map[string]v1.RunStepStatus, len(run.Status.StartedSteps))
+	for _, n := range run.Status.StartedSteps {
+		ss := status.Steps[n]
+		run.Status.Steps[n] = v1.RunStepStatus{
+			State:   ss.State,
+			Message: ss.Message,
+			Hash:    hashes[n],
+		}
+		switch ss.State {
+		case v1.StateReady:
+		case v1.StateAwaitingApproval:
+			// waiting is not a failure, the approved plan is applied by a next run.
+			if run.Status.Phase == v1.RunPhaseSucceeded {
+				run.Status.Phase = v1.RunPhaseAwaitingApproval
+			}
+		default:
+			run.Status.Phase = v1.RunPhaseFailed
+		}
+	}
+	run.Status.CompletionTime = &metav1.Time{Time: now}
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/stdr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/plan"
+	"github.com/mmlt/environment-operator/pkg/source"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"log"
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+	"time"
+)
+
+// FakeSourcer is a plan.Sourcer with fixed workspaces by name.
+type fakeSourcer map[string]source.Workspace
+
+func (f fakeSourcer) Workspace(_ types.NamespacedName, name string) (source.Workspace, bool) {
+	w, ok := f[name]
+	return w, ok
+}
+
+func testRunGraph() plan.Graph {
+	newStep := func(typ step.Type, clusterName, hash string) step.Step {
+		return &fakeStep{Metaa: step.Metaa{ID: step.ID{Type: typ, ClusterName: clusterName}, Hash: hash}}
+	}
+	return plan.NewGraph([]step.Step{
+		newStep(step.TypeInfra, "", "123"),
+		newStep(step.TypeAKSPool, "foo", "456"),
+		newStep(step.TypeAddons, "foo", "789"),
+	})
+}
+
+func Test_newRun(t *testing.T) {
+	orgTimeNow := timeNow
+	defer func() { timeNow = orgTimeNow }()
+	timeNow = func() time.Time { return time.Unix(100, 0) }
+
+	cr := &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default", Generation: 3},
+		Status: v1.EnvironmentStatus{
+			Steps: map[string]v1.StepStatus{
+				"Infra":      {State: v1.StateReady, Hash: "123"},
+				"AKSPoolfoo": {State: v1.StateReady, Hash: "456"},
+				"Addonsfoo":  {State: "", Hash: "000"},
+			},
+		},
+	}
+	src := fakeSourcer{"": {Hash: "abc"}, "foo": {Hash: "def"}}
+
+	got := newRun(cr, testRunGraph(), src)
+
+	assert.Equal(t, &v1.EnvironmentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "env1-",
+			Namespace:    "default",
+			Labels:       map[string]string{v1.LabelEnvironment: "env1"},
+		},
+		Spec: v1.EnvironmentRunSpec{
+			EnvironmentName: "env1",
+			Generation:      3,
+			Sources:         map[string]string{"infra": "abc", "foo": "def"},
+			Steps:           []string{"Infra", "AKSPoolfoo", "Addonsfoo"},
+		},
+		Status: v1.EnvironmentRunStatus{
+			StartTime: metav1.Time{Time: time.Unix(100, 0)},
+			Phase:     v1.RunPhaseRunning,
+		},
+	}, got)
+}
+
+func Test_runOutcome(t *testing.T) {
+	tests := []struct {
+		it        string
+		status    v1.EnvironmentStatus
+		wantPhase v1.RunPhase
+	}{
+		{
+			it: "should succeed when all started steps are Ready",
+			status: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"AKSPoolfoo": {State: v1.StateReady},
+				"Addonsfoo":  {State: v1.StateReady, Message: "applied"},
+			}},
+			wantPhase: v1.RunPhaseSucceeded,
+		},
+		{
+			it: "should fail when a started step is in Error",
+			status: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"AKSPoolfoo": {State: v1.StateReady},
+				"Addonsfoo":  {State: v1.StateError, Message: "applied"},
+			}},
+			wantPhase: v1.RunPhaseFailed,
+		},
+		{
+			it: "should await approval when a started step awaits approval",
+			status: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"AKSPoolfoo": {State: v1.StateReady},
+				"Addonsfoo":  {State: v1.StateAwaitingApproval, Message: "applied"},
+			}},
+			wantPhase: v1.RunPhaseAwaitingApproval,
+		},
+		{
+			it: "should fail when a started step is in Error and another awaits approval",
+			status: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"AKSPoolfoo": {State: v1.StateError},
+				"Addonsfoo":  {State: v1.StateAwaitingApproval, Message: "applied"},
+			}},
+			wantPhase: v1.RunPhaseFailed,
+		},
+		{
+			it: "should ignore steps that are not started",
+			status: v1.EnvironmentStatus{Steps: map[string]v1.StepStatus{
+				"Infra":      {State: v1.StateError},
+				"AKSPoolfoo": {State: v1.StateReady},
+				"Addonsfoo":  {State: v1.StateReady, Message: "applied"},
+			}},
+			wantPhase: v1.RunPhaseSucceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			run := &v1.EnvironmentRun{Status: v1.EnvironmentRunStatus{StartedSteps: []string{"AKSPoolfoo", "Addonsfoo"}}}
+
+			runOutcome(run, tt.status, testRunGraph(), time.Unix(200, 0))
+
+			assert.Equal(t, tt.wantPhase, run.Status.Phase)
+			assert.Equal(t, &metav1.Time{Time: time.Unix(200, 0)}, run.Status.CompletionTime)
+			assert.Equal(t, v1.RunStepStatus{State: tt.status.Steps["Addonsfoo"].State, Message: "applied", Hash: "789"}, run.Status.Steps["Addonsfoo"])
+		})
+	}
+}
+
+func TestEnvironmentReconciler_execute_recordsRun(t *testing.T) {
+	tests := []struct {
+		it        string
+		awaiting  string
+		wantPhase v1.RunPhase
+	}{
+		{
+			it:        "should record a succeeded run",
+			wantPhase: v1.RunPhaseSucceeded,
+		},
+		{
+			it:        "should record a run that awaits approval",
+			awaiting:  "Addonsfoo",
+			wantPhase: v1.RunPhaseAwaitingApproval,
+		},
+	}
+	scheme := runtime.NewScheme()
+	_ = v1.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			cr := &v1.Environment{
+				ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default", UID: "uid1"},
+				Status: v1.EnvironmentStatus{
+					Steps: map[string]v1.StepStatus{"Infra": {State: v1.StateReady, Hash: "123"}},
+				},
+			}
+			// existing runs of which the oldest is pruned.
+			var objs []client.Object
+			for i, n := range []string{"env1-old", "env1-older"} {
+				objs = append(objs, &v1.EnvironmentRun{
+					ObjectMeta: metav1.ObjectMeta{Name: n, Namespace: "default", Labels: map[string]string{v1.LabelEnvironment: "env1"}},
+					Status:     v1.EnvironmentRunStatus{StartTime: metav1.Time{Time: time.Unix(int64(10-i), 0)}},
+				})
+			}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+			r := &EnvironmentReconciler{Client: cl, Scheme: scheme, MaxRuns: 2}
+
+			grph := testRunGraph()
+			for _, stp := range grph.Steps {
+				stp.(*fakeStep).exec = func(s *fakeStep) {
+					// fakeStep doesn't call OnUpdate, record the outcome like update does.
+					r.statusMu.Lock()
+					s.State = v1.StateReady
+					if s.ID.ShortName() == tt.awaiting {
+						s.State = v1.StateAwaitingApproval
+					}
+					cr.Status.Steps[s.ID.ShortName()] = v1.StepStatus{State: s.State, Hash: s.Hash}
+					r.statusMu.Unlock()
+				}
+			}
+			stps, err := getStepsAndSyncStatusWithPlan(&cr.Status, grph, stdr.New(log.New(os.Stdout, "", 0)))
+			assert.NoError(t, err)
+
+			ctx := logr.NewContext(context.Background(), stdr.New(log.New(os.Stdout, "", 0)))
+			r.execute(ctx, cr, grph, stps)
+
+			var runs v1.EnvironmentRunList
+			err = cl.List(ctx, &runs)
+			assert.NoError(t, err)
+			if assert.Len(t, runs.Items, 2, "should prune the oldest run") {
+				var got *v1.EnvironmentRun
+				for i := range runs.Items {
+					assert.NotEqual(t, "env1-older", runs.Items[i].Name)
+					if runs.Items[i].Name != "env1-old" {
+						got = &runs.Items[i]
+					}
+				}
+				if assert.NotNil(t, got) {
+					assert.Equal(t, []string{"Infra", "AKSPoolfoo", "Addonsfoo"}, got.Spec.Steps)
+					assert.Equal(t, []string{"AKSPoolfoo", "Addonsfoo"}, got.Status.StartedSteps)
+					assert.Equal(t, "env1", got.OwnerReferences[0].Name)
+					assert.Equal(t, tt.wantPhase, got.Status.Phase)
+					assert.NotNil(t, got.Status.CompletionTime)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvironmentReconciler_execute_driftCheckIsNotARun(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1.AddToScheme(scheme)
+	cl := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &EnvironmentReconciler{Client: cl, Scheme: scheme, MaxRuns: 2}
+
+	cr := &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "env1", Namespace: "default", UID: "uid1"},
+		Status: v1.EnvironmentStatus{
+			Steps: map[string]v1.StepStatus{"Infra": {State: v1.StateReady, Hash: "123"}},
+		},
+	}
+	drift := &fakeStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeDrift}, Hash: "abc"}}
+	drift.exec = func(s *fakeStep) {
+		r.statusMu.Lock()
+		s.State = v1.StateReady
+		cr.Status.Steps[s.ID.ShortName()] = v1.StepStatus{State: s.State, Hash: s.Hash}
+		r.statusMu.Unlock()
+	}
+	grph := plan.NewGraph([]step.Step{
+		&fakeStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeInfra}, Hash: "123"}},
+		drift,
+	})
+	stps, err := getStepsAndSyncStatusWithPlan(&cr.Status, grph, stdr.New(log.New(os.Stdout, "", 0)))
+	assert.NoError(t, err)
+
+	ctx := logr.NewContext(context.Background(), stdr.New(log.New(os.Stdout, "", 0)))
+	r.execute(ctx, cr, grph, stps)
+
+	assert.Equal(t, v1.StateReady, cr.Status.Steps["Drift"].State, "should run the drift check")
+	var runs v1.EnvironmentRunList
+	err = cl.List(ctx, &runs)
+	assert.NoError(t, err)
+	assert.Empty(t, runs.Items, "should not record a drift check as a run")
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/mmlt/environment-operator/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Traced calls fn with a context that contains a span named name.
+// The error returned by fn is recorded with the span and returned.
+func traced(ctx context.Context, name string, fn func(context.Context) error) error {
+	ctx, span := tracing.Tracer().Start(ctx, name)
+	defer span.End()
+
+	err := fn(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// PhaseTracer traces the phases of a step execution.
+// A phase starts when the step reports it's Running and ends with the next update of the step.
+type phaseTracer struct {
+	ctx   context.Context
+	phase trace.Span
+}
+
+// Update ends the current phase and starts a new phase when meta is Running.
+func (t *phaseTracer) update(meta step.Meta) {
+	t.end()
+
+	state := meta.GetState()
+	span := trace.SpanFromContext(t.ctx)
+	if state != v1.StateRunning {
+		span.SetAttributes(attribute.String("state", string(state)))
+		if state == v1.StateError {
+			span.SetStatus(codes.Error, meta.GetMsg())
+		}
+		return
+	}
+	_, t.phase = tracing.Tracer().Start(t.ctx, "phase", trace.WithAttributes(attribute.String("message", meta.GetMsg())))
+}
+
+// End ends the current phase (if any).
+func (t *phaseTracer) end() {
+	if t.phase != nil {
+		t.phase.End()
+		t.phase = nil
+	}
+}
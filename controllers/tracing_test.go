@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+// TestRecorder returns a recorder of the spans that are ended while the test runs.
+func testRecorder(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	return sr
+}
+
+func Test_traced(t *testing.T) {
+	sr := testRecorder(t)
+
+	err := traced(context.Background(), "fails", func(context.Context) error { return errors.New("boom") })
+	assert.EqualError(t, err, "boom")
+
+	spans := sr.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "fails", spans[0].Name())
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+	}
+}
+
+func Test_phaseTracer(t *testing.T) {
+	sr := testRecorder(t)
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "Execute")
+	phases := &phaseTracer{ctx: ctx}
+	stp := &fakeStep{Metaa: step.Metaa{ID: step.ID{Type: step.TypeInfra}}}
+	for _, u := range []struct {
+		state v1.StepState
+		msg   string
+	}{
+		{v1.StateRunning, "terraform init"},
+		{v1.StateRunning, "terraform plan"},
+		{v1.StateError, "plan limits exceeded"},
+	} {
+		stp.State, stp.Msg = u.state, u.msg
+		phases.update(stp)
+	}
+	phases.end()
+	span.End()
+
+	spans := sr.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	for i, msg := range []string{"terraform init", "terraform plan"} {
+		assert.Equal(t, "phase", spans[i].Name())
+		assert.Contains(t, spans[i].Attributes(), attribute.String("message", msg))
+		assert.Equal(t, span.SpanContext().SpanID(), spans[i].Parent().SpanID())
+	}
+	assert.Contains(t, spans[2].Attributes(), attribute.String("state", "Error"))
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+}
@@ -3,6 +3,13 @@ package controllers
 import (
 	"fmt"
 	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/secret"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // ValidateSpec returns an error when spec values are missing or wrong.
@@ -11,7 +18,30 @@ func validateSpec(es *v1.EnvironmentSpec) error {
 		return fmt.Errorf("spec.infra.az.subscription: at least 1 subscription expected")
 	}
 
-	//TODO Add validation logAnalyticsWorkspace.subscriptionName must be in spec.infra.subscription[]
+	err := validateSchedule(es.Infra.Schedule)
+	if err != nil {
+		return fmt.Errorf("spec.infra.schedule: %w", err)
+	}
+
+	err = validateWindows(es)
+	if err != nil {
+		return err
+	}
+
+	err = validateVaultRefs(es)
+	if err != nil {
+		return err
+	}
+
+	err = validateNetwork(&es.Infra.AZ)
+	if err != nil {
+		return fmt.Errorf("spec.infra.az: %w", err)
+	}
+
+	err = validateRolloutSpec(&es.Rollout, es.Clusters)
+	if err != nil {
+		return fmt.Errorf("spec.rollout: %w", err)
+	}
 
 	//TODO Add validation of 'x' values k8sCluster (must equal cluster name), k8sEnvironment, k8sDomain, k8sProvider
 	// or derive these values from other fields.
@@ -19,9 +49,240 @@ func validateSpec(es *v1.EnvironmentSpec) error {
 	return nil
 }
 
-// ValidateClusterSpec returns an error when cluster values are missing or wrong.
-func validateClusterSpec(cs *v1.ClusterSpec) error {
-	//validations go here...
-	_ = cs
+// ValidateClusterSpec returns an error when cluster values (merged with defaults) are missing or wrong.
+func validateClusterSpec(cs *v1.ClusterSpec, infra *v1.InfraSpec) error {
+	if _, ok := cs.Infra.Pools["default"]; !ok {
+		return fmt.Errorf("infra.pools: a pool named 'default' is expected")
+	}
+
+	if infra.AZ.VNetCIDR != "" {
+		last := int32(1)<<infra.AZ.SubnetNewbits - 1
+		if cs.Infra.SubnetNum < 1 || cs.Infra.SubnetNum > last {
+			return fmt.Errorf("infra.subnetNum: %d not in range 1-%d (2^subnetNewbits-1)", cs.Infra.SubnetNum, last)
+		}
+	}
+
+	if law := cs.Infra.AZ.LogAnalyticsWorkspace; law != nil {
+		var ok bool
+		for _, s := range infra.AZ.Subscription {
+			if s.Name == law.SubscriptionName {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("infra.az.logAnalyticsWorkspace.subscriptionName: unknown subscription %s", law.SubscriptionName)
+		}
+	}
+
+	err := validateSchedule(cs.Addons.Schedule)
+	if err != nil {
+		return fmt.Errorf("addons.schedule: %w", err)
+	}
+
+	err = validateClusterNetwork(cs, &infra.AZ)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateClusterNetwork returns an error when the network ranges of a cluster overlap.
+// Network ranges are the infra.x values with a key ending in CIDR (like podCIDR, serviceCIDR or dockerBridgeCIDR),
+// they must not overlap each other or the VNet that contains the cluster subnets.
+// Network ranges of different clusters may overlap because they are local to the cluster.
+func validateClusterNetwork(cs *v1.ClusterSpec, az *v1.AZSpec) error {
+	var keys []string
+	for k, v := range cs.Infra.X {
+		if !strings.HasSuffix(strings.ToLower(k), "cidr") || v == "" {
+			continue
+		}
+		if _, ok, _ := secret.ParseRef(v); ok {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	nets := make([]*net.IPNet, len(keys))
+	for i, k := range keys {
+		_, n, err := net.ParseCIDR(cs.Infra.X[k])
+		if err != nil {
+			return fmt.Errorf("infra.x.%s: %w", k, err)
+		}
+		nets[i] = n
+	}
+
+	if az.VNetCIDR != "" {
+		_, vnet, err := net.ParseCIDR(az.VNetCIDR)
+		if err != nil {
+			return fmt.Errorf("vnetCIDR: %w", err)
+		}
+		for i, k := range keys {
+			if netOverlaps(vnet, nets[i]) {
+				return fmt.Errorf("infra.x.%s: %s overlaps vnetCIDR %s", k, cs.Infra.X[k], az.VNetCIDR)
+			}
+		}
+	}
+
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if netOverlaps(nets[i], nets[j]) {
+				return fmt.Errorf("infra.x.%s: %s overlaps infra.x.%s %s", keys[i], cs.Infra.X[keys[i]], keys[j], cs.Infra.X[keys[j]])
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateClusters returns an error when clusters (merged with defaults) conflict with each other.
+func validateClusters(clusters []v1.ClusterSpec, infra *v1.InfraSpec) error {
+	names := make(map[string]bool, len(clusters))
+	for _, c := range clusters {
+		if names[c.Name] {
+			return fmt.Errorf("spec.clusters: duplicate cluster name %s", c.Name)
+		}
+		names[c.Name] = true
+	}
+
+	if infra.AZ.VNetCIDR == "" {
+		return nil
+	}
+
+	// Subnets are equally sized so they only overlap when their subnetNum is the same.
+	nums := make(map[int32]string, len(clusters))
+	for _, c := range clusters {
+		if n, ok := nums[c.Infra.SubnetNum]; ok {
+			return fmt.Errorf("spec.clusters: cluster %s and %s have the same subnetNum %d", n, c.Name, c.Infra.SubnetNum)
+		}
+		nums[c.Infra.SubnetNum] = c.Name
+	}
+
+	return nil
+}
+
+// ValidateSchedule returns an error when schedule is not a valid CRON schedule.
+func validateSchedule(schedule string) error {
+	if schedule == "" {
+		return nil
+	}
+	_, err := scheduleParser.Parse(schedule)
+	return err
+}
+
+// ValidateWindows returns an error when a maintenance window can't be parsed or selects an unknown step.
+func validateWindows(es *v1.EnvironmentSpec) error {
+	known := make(map[string]bool)
+	for _, t := range step.Types {
+		known[string(t)] = true
+		for _, c := range es.Clusters {
+			known[step.ID{Type: t, ClusterName: c.Name}.ShortName()] = true
+		}
+	}
+
+	for i, w := range es.Windows {
+		_, err := parseWindow(w)
+		if err != nil {
+			return fmt.Errorf("spec.windows[%d].%w", i, err)
+		}
+		for _, s := range w.Steps {
+			if !known[s] {
+				return fmt.Errorf("spec.windows[%d].steps: unknown step %s", i, s)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateVaultRefs returns an error when a string in the infra, defaults or clusters spec is a malformed vault
+// reference.
+// A vault reference has the form "vault name" or "vault name field", see package secret.
+func validateVaultRefs(es *v1.EnvironmentSpec) error {
+	var err error
+	check := func(path, s string) (string, bool) {
+		if _, _, e := secret.ParseRef(s); e != nil && err == nil {
+			err = fmt.Errorf("%s: %w", path, e)
+		}
+		return s, false
+	}
+	walkStrings(reflect.ValueOf(&es.Infra), "spec.infra", check)
+	walkStrings(reflect.ValueOf(&es.Defaults), "spec.defaults", check)
+	for i := range es.Clusters {
+		walkStrings(reflect.ValueOf(&es.Clusters[i]), "spec.clusters["+strconv.Itoa(i)+"]", check)
+	}
+	return err
+}
+
+// ValidateNetwork returns an error when the VNet can't be divided in subnets or when routes overlap with the VNet.
+// Routes for (part of) the VNet would send cluster traffic out of the VNet, routes containing the whole VNet
+// (like 0.0.0.0/0) are allowed.
+func validateNetwork(az *v1.AZSpec) error {
+	if az.VNetCIDR == "" {
+		return nil
+	}
+
+	_, vnet, err := net.ParseCIDR(az.VNetCIDR)
+	if err != nil {
+		return fmt.Errorf("vnetCIDR: %w", err)
+	}
+	ones, bits := vnet.Mask.Size()
+	if az.SubnetNewbits < 1 || ones+int(az.SubnetNewbits) > bits {
+		return fmt.Errorf("subnetNewbits: %d doesn't fit in vnetCIDR %s", az.SubnetNewbits, az.VNetCIDR)
+	}
+
+	for i, r := range az.Routes {
+		_, p, err := net.ParseCIDR(r.AddressPrefix)
+		if err != nil {
+			return fmt.Errorf("routes[%d].addressPrefix: %w", i, err)
+		}
+		if netOverlaps(vnet, p) && !netContains(p, vnet) {
+			return fmt.Errorf("routes[%d].addressPrefix: %s overlaps vnetCIDR %s", i, r.AddressPrefix, az.VNetCIDR)
+		}
+	}
+
+	return nil
+}
+
+// NetOverlaps returns true when network a and b have addresses in common.
+func netOverlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// NetContains returns true when network a contains all addresses of network b.
+func netContains(a, b *net.IPNet) bool {
+	ao, _ := a.Mask.Size()
+	bo, _ := b.Mask.Size()
+	return ao <= bo && a.Contains(b.IP)
+}
+
+// ValidateRolloutSpec returns an error when rollout values are wrong.
+func validateRolloutSpec(rs *v1.RolloutSpec, clusters []v1.ClusterSpec) error {
+	if rs.Soak.Duration < 0 {
+		return fmt.Errorf("soak: must not be negative")
+	}
+	if rs.MaxFailures < 0 {
+		return fmt.Errorf("maxFailures: must not be negative")
+	}
+
+	names := make(map[string]bool, len(clusters))
+	for _, c := range clusters {
+		names[c.Name] = false
+	}
+	for i, w := range rs.Waves {
+		for _, n := range w.Clusters {
+			seen, ok := names[n]
+			if !ok {
+				return fmt.Errorf("waves[%d]: unknown cluster %s", i, n)
+			}
+			if seen {
+				return fmt.Errorf("waves[%d]: cluster %s is in more than one wave", i, n)
+			}
+			names[n] = true
+		}
+	}
+
 	return nil
 }
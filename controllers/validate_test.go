@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func Test_validateRolloutSpec(t *testing.T) {
+	clusters := []v1.ClusterSpec{{Name: "canary"}, {Name: "foo"}}
+
+	tests := []struct {
+		it      string
+		rollout v1.RolloutSpec
+		wantErr string
+	}{
+		{
+			it: "should accept an empty rollout",
+		},
+		{
+			it: "should accept waves with known clusters",
+			rollout: v1.RolloutSpec{
+				Waves: []v1.RolloutWave{
+					{Name: "canary", Clusters: []string{"canary"}},
+					{Name: "rest", Clusters: []string{"foo"}},
+				},
+				Soak: metav1.Duration{Duration: time.Minute},
+			},
+		},
+		{
+			it: "should reject unknown clusters",
+			rollout: v1.RolloutSpec{
+				Waves: []v1.RolloutWave{
+					{Name: "canary", Clusters: []string{"bar"}},
+				},
+			},
+			wantErr: "waves[0]: unknown cluster bar",
+		},
+		{
+			it: "should reject a cluster in more than one wave",
+			rollout: v1.RolloutSpec{
+				Waves: []v1.RolloutWave{
+					{Name: "canary", Clusters: []string{"canary"}},
+					{Name: "rest", Clusters: []string{"foo", "canary"}},
+				},
+			},
+			wantErr: "waves[1]: cluster canary is in more than one wave",
+		},
+		{
+			it: "should reject a negative soak",
+			rollout: v1.RolloutSpec{
+				Soak: metav1.Duration{Duration: -time.Minute},
+			},
+			wantErr: "soak: must not be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			err := validateRolloutSpec(&tt.rollout, clusters)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateSpec(t *testing.T) {
+	tests := []struct {
+		it      string
+		spec    func(*v1.EnvironmentSpec)
+		wantErr string
+	}{
+		{
+			it:   "should accept a valid spec",
+			spec: func(*v1.EnvironmentSpec) {},
+		},
+		{
+			it: "should reject a spec without subscriptions",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Infra.AZ.Subscription = nil
+			},
+			wantErr: "spec.infra.az.subscription: at least 1 subscription expected",
+		},
+		{
+			it: "should reject an invalid schedule",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Infra.Schedule = "* 25 * * *"
+			},
+			wantErr: "spec.infra.schedule: end of range (25) above maximum (23): 25",
+		},
+		{
+			it: "should accept maintenance windows",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Windows = []v1.MaintenanceWindow{
+					{Start: "0 22 * * MON-FRI", Duration: metav1.Duration{Duration: 4 * time.Hour}, TimeZone: "Europe/Amsterdam"},
+					{Steps: []string{"AKSPool", "Addonscpe"}, Start: "0 2 * * SAT", Duration: metav1.Duration{Duration: time.Hour}},
+				}
+			},
+		},
+		{
+			it: "should reject a window with an unknown time zone",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Windows = []v1.MaintenanceWindow{
+					{Start: "0 22 * * *", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Europe/Nowhere"},
+				}
+			},
+			wantErr: "spec.windows[0].timeZone: unknown time zone Europe/Nowhere",
+		},
+		{
+			it: "should reject a window without duration",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Windows = []v1.MaintenanceWindow{{Start: "0 22 * * *"}}
+			},
+			wantErr: "spec.windows[0].duration: must be greater than 0",
+		},
+		{
+			it: "should reject a window for an unknown step",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Windows = []v1.MaintenanceWindow{
+					{Steps: []string{"Addonsfoo"}, Start: "0 22 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+				}
+			},
+			wantErr: "spec.windows[0].steps: unknown step Addonsfoo",
+		},
+		{
+			it: "should reject a malformed vault reference",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Infra.State.Access = "vault name field extra"
+			},
+			wantErr: "spec.infra.state.access: vault reference wrong, expected 'vault name [field]'",
+		},
+		{
+			it: "should reject an invalid vnetCIDR",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Infra.AZ.VNetCIDR = "10.20.300.0/24"
+			},
+			wantErr: "spec.infra.az: vnetCIDR: invalid CIDR address: 10.20.300.0/24",
+		},
+		{
+			it: "should reject subnetNewbits that don't fit the vnet",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Infra.AZ.SubnetNewbits = 9
+			},
+			wantErr: "spec.infra.az: subnetNewbits: 9 doesn't fit in vnetCIDR 10.20.30.0/24",
+		},
+		{
+			it: "should reject a route that overlaps part of the vnet",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Infra.AZ.Routes = []v1.AZRoute{
+					{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"},
+					{Name: "fw", AddressPrefix: "10.20.30.128/25", NextHopType: "VirtualAppliance"},
+				}
+			},
+			wantErr: "spec.infra.az: routes[1].addressPrefix: 10.20.30.128/25 overlaps vnetCIDR 10.20.30.0/24",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			es := testSpec1()
+			es.Infra.AZ.VNetCIDR = "10.20.30.0/24"
+			es.Infra.AZ.SubnetNewbits = 5
+			tt.spec(es)
+			err := validateSpec(es)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateClusters(t *testing.T) {
+	tests := []struct {
+		it      string
+		spec    func(*v1.EnvironmentSpec)
+		wantErr string
+	}{
+		{
+			it:   "should accept valid clusters",
+			spec: func(*v1.EnvironmentSpec) {},
+		},
+		{
+			it: "should reject a cluster without default pool",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Defaults.Infra.Pools = map[string]v1.NodepoolSpec{"extra": {Scale: 1}}
+			},
+			wantErr: "validate spec.cluster cpe: infra.pools: a pool named 'default' is expected",
+		},
+		{
+			it: "should reject a subnetNum out of range",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Infra.SubnetNum = 32
+			},
+			wantErr: "validate spec.cluster second: infra.subnetNum: 32 not in range 1-31 (2^subnetNewbits-1)",
+		},
+		{
+			it: "should reject duplicate cluster names",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Name = "cpe"
+			},
+			wantErr: "validate spec: spec.clusters: duplicate cluster name cpe",
+		},
+		{
+			it: "should reject duplicate subnetNums",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Infra.SubnetNum = 1
+			},
+			wantErr: "validate spec: spec.clusters: cluster cpe and second have the same subnetNum 1",
+		},
+		{
+			it: "should accept cluster network ranges that don't overlap",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Defaults.Infra.X["podCIDR"] = "10.244.0.0/16"
+				es.Defaults.Infra.X["serviceCIDR"] = "172.18.0.0/16"
+				es.Defaults.Infra.X["dockerBridgeCIDR"] = "172.17.0.1/16"
+			},
+		},
+		{
+			it: "should accept the same network ranges in different clusters",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[0].Infra.X["podCIDR"] = "10.244.0.0/16"
+				es.Clusters[1].Infra.X["podCIDR"] = "10.244.0.0/16"
+			},
+		},
+		{
+			it: "should skip network ranges that are vault references",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Defaults.Infra.X["podCIDR"] = "vault network podCIDR"
+			},
+		},
+		{
+			it: "should reject an invalid network range",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[0].Infra.X["podCIDR"] = "10.244.0.0"
+			},
+			wantErr: "validate spec.cluster cpe: infra.x.podCIDR: invalid CIDR address: 10.244.0.0",
+		},
+		{
+			it: "should reject a network range that overlaps the vnet",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[1].Infra.X["serviceCIDR"] = "10.20.0.0/16"
+			},
+			wantErr: "validate spec.cluster second: infra.x.serviceCIDR: 10.20.0.0/16 overlaps vnetCIDR 10.20.30.0/24",
+		},
+		{
+			it: "should reject a network range that overlaps a subnet",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[0].Infra.X["podCIDR"] = "10.20.30.8/29"
+			},
+			wantErr: "validate spec.cluster cpe: infra.x.podCIDR: 10.20.30.8/29 overlaps vnetCIDR 10.20.30.0/24",
+		},
+		{
+			it: "should reject network ranges that overlap each other",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Defaults.Infra.X["podCIDR"] = "172.16.0.0/12"
+				es.Clusters[0].Infra.X["serviceCIDR"] = "172.18.0.0/16"
+			},
+			wantErr: "validate spec.cluster cpe: infra.x.podCIDR: 172.16.0.0/12 overlaps infra.x.serviceCIDR 172.18.0.0/16",
+		},
+		{
+			it: "should reject an unknown logAnalyticsWorkspace subscription",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Defaults.Infra.AZ.LogAnalyticsWorkspace = &v1.LogAnalyticsWorkspace{SubscriptionName: "other"}
+			},
+			wantErr: "validate spec.cluster cpe: infra.az.logAnalyticsWorkspace.subscriptionName: unknown subscription other",
+		},
+		{
+			it: "should reject an invalid addons schedule",
+			spec: func(es *v1.EnvironmentSpec) {
+				es.Clusters[0].Addons.Schedule = "daily"
+			},
+			wantErr: "validate spec.cluster cpe: addons.schedule: expected exactly 5 fields, found 1: [daily]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			es := testSpec1()
+			es.Infra.AZ.VNetCIDR = "10.20.30.0/24"
+			es.Infra.AZ.SubnetNewbits = 5
+			es.Clusters[0].Infra.SubnetNum = 1
+			es.Clusters[1].Infra.SubnetNum = 2
+			tt.spec(es)
+			_, err := flattenedClusterSpec(*es)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,65 +1,153 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 	"github.com/hashicorp/go-multierror"
 	v1 "github.com/mmlt/environment-operator/api/v1"
-	"github.com/mmlt/environment-operator/pkg/cloud"
+	"github.com/mmlt/environment-operator/pkg/secret"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
-// VaultInfraValues replaces references to a vault value with the actual value.
-// A value is considered a reference when it uses the form "vault secretname secretfield"
-func vaultInfraValues(infra v1.InfraSpec, c cloud.Cloud) (v1.InfraSpec, error) {
-	var err error
-
-	err = vaultValue(&infra.Source.Token, c, "infra.source.token", err)
-
-	err = vaultValue(&infra.State.Access, c, "access", err)
-	err = vaultValue(&infra.AAD.TenantID, c, "tenantID", err)
-	err = vaultValue(&infra.AAD.ClientAppID, c, "clientAppID", err)
-	err = vaultValue(&infra.AAD.ServerAppID, c, "serverAppID", err)
-	err = vaultValue(&infra.AAD.ServerAppSecret, c, "serverAppSecret", err)
-
-	return infra, err
+// ResolvedSecret is a secret value that is resolved from a vault reference.
+type resolvedSecret struct {
+	// Path is the path of the field that contains the reference, for example infra.state.access
+	Path string
+	// Ref is the reference, for example "vault tfstate access-key"
+	Ref string
+	// Value is the resolved value.
+	Value string
 }
 
-// VaultClusterValues replaces references to a vault value with the actual value.
-// A value is considered a reference when it uses the form "vault secretname secretfield"
-func vaultClusterValues(clusters []v1.ClusterSpec, c cloud.Cloud) ([]v1.ClusterSpec, error) {
-	var err error
+// VaultInfraValues returns a copy of infra with references to a vault value replaced by the actual value.
+// A value is considered a reference when it uses the form "vault secretname secretfield", any string field (including
+// the values of X) can be a reference.
+// The resolved secrets are returned so they can be kept out of logs and their rotation can be tracked.
+// The error lists every reference that could not be resolved.
+func vaultInfraValues(ctx context.Context, infra v1.InfraSpec, m *secret.Mux, namespace string) (v1.InfraSpec, []resolvedSecret, error) {
+	r := infra.DeepCopy()
+	secrets, err := vaultValues(ctx, r, "infra", m, namespace)
+	return *r, secrets, err
+}
 
-	for i := range clusters {
-		err = vaultValue(&clusters[i].Addons.Source.Token, c, "addons.source.token", err)
+// VaultClusterValues returns a copy of clusters with references to a vault value replaced by the actual value.
+// See vaultInfraValues.
+func vaultClusterValues(ctx context.Context, clusters []v1.ClusterSpec, m *secret.Mux, namespace string) ([]v1.ClusterSpec, []resolvedSecret, error) {
+	var errs error
+	var secrets []resolvedSecret
+	r := make([]v1.ClusterSpec, len(clusters))
+	for i, c := range clusters {
+		c.DeepCopyInto(&r[i])
+		ss, err := vaultValues(ctx, &r[i], "clusters["+c.Name+"]", m, namespace)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		secrets = append(secrets, ss...)
 	}
+	return r, secrets, errs
+}
 
-	return clusters, err
+// VaultValues replaces all references in the strings of v (a pointer) with the referenced values.
+// The name of a reference can be prefixed with a backend, see package secret.
+func vaultValues(ctx context.Context, v interface{}, path string, m *secret.Mux, namespace string) ([]resolvedSecret, error) {
+	var errs error
+	var secrets []resolvedSecret
+	walkStrings(reflect.ValueOf(v), path, func(p, s string) (string, bool) {
+		if _, ok, _ := secret.ParseRef(s); !ok {
+			return s, false
+		}
+		r, err := m.Resolve(ctx, namespace, s)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("field %s: %w", p, err))
+			return s, false
+		}
+		secrets = append(secrets, resolvedSecret{Path: p, Ref: s, Value: r})
+		return r, true
+	})
+	return secrets, errs
 }
 
-// VaultValue changes an s with "vault name field" to the referenced value.
-func vaultValue(s *string, c cloud.Cloud, msg string, errs error) error {
-	if !strings.HasPrefix(*s, "vault ") {
-		return nil
+// SecretValues returns the values of secrets.
+func secretValues(secrets []resolvedSecret) []string {
+	r := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		r = append(r, s.Value)
 	}
+	return r
+}
 
-	ss := strings.Fields(*s)
-	var n, f string
-	switch len(ss) {
-	case 2:
-		n = ss[1]
-	case 3:
-		n = ss[1]
-		f = ss[2]
-	default:
-		return multierror.Append(errs, fmt.Errorf("field %s: vault reference wrong", msg))
+// WalkStrings calls fn for each string in v with the JSON path of that string.
+// When fn returns true the string is replaced with the returned value.
+// V is expected to be a pointer so strings in structs can be set.
+func walkStrings(v reflect.Value, path string, fn func(path, s string) (string, bool)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walkStrings(v.Elem(), path, fn)
+		}
+	case reflect.String:
+		if s, ok := fn(path, v.String()); ok && v.CanSet() {
+			v.SetString(s)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				// unexported
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			switch {
+			case name == "-":
+				continue
+			case name == "" && f.Anonymous:
+				walkStrings(v.Field(i), path, fn)
+			case name == "":
+				walkStrings(v.Field(i), path+"."+f.Name, fn)
+			default:
+				walkStrings(v.Field(i), path+"."+name, fn)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkStrings(v.Index(i), path+"["+strconv.Itoa(i)+"]", fn)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// map values are not addressable, walk a copy and put it back when a string in it has changed.
+			e := reflect.New(iter.Value().Type()).Elem()
+			e.Set(iter.Value())
+			var changed bool
+			walkStrings(e, path+"."+fmt.Sprint(iter.Key().Interface()), func(path, s string) (string, bool) {
+				r, ok := fn(path, s)
+				changed = changed || ok && r != s
+				return r, ok
+			})
+			if changed {
+				v.SetMapIndex(iter.Key(), e)
+			}
+		}
 	}
+}
 
-	v, err := c.VaultGet(n, f)
-	if err != nil {
-		return multierror.Append(errs, err)
+// SensitiveValues returns the values of infra and clusters fields that are secret even when they are specified as a
+// literal instead of a vault reference.
+func sensitiveValues(infra v1.InfraSpec, clusters []v1.ClusterSpec) []string {
+	r := []string{infra.Source.Token, infra.State.Access, infra.AAD.ServerAppSecret}
+	for _, c := range clusters {
+		r = append(r, c.Addons.Source.Token)
 	}
+	return r
+}
 
-	*s = v
-
-	return errs
+// SecretMux returns the resolver for secret references.
+func (r *EnvironmentReconciler) secretMux() *secret.Mux {
+	if r.Secrets != nil {
+		return r.Secrets
+	}
+	return &secret.Mux{Default: secret.Cloud{Cloud: r.Cloud}}
 }
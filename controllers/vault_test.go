@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/secret"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) Get(_ context.Context, _, name, field string) (string, error) {
+	v, ok := f[name+"/"+field]
+	if !ok {
+		return "", fmt.Errorf("not found")
+	}
+	return v, nil
+}
+
+func Test_vaultInfraValues(t *testing.T) {
+	m := &secret.Mux{Default: fakeSecrets{
+		"aad/tenant": "t1",
+		"tf/":        "s3cr3t",
+		"x/owner":    "harry",
+	}}
+
+	in := v1.InfraSpec{
+		EnvName: "local",
+		State:   v1.StateSpec{Access: "vault tf"},
+		AAD:     v1.AADSpec{TenantID: "vault aad tenant", ClientAppID: "literal"},
+		AZ: v1.AZSpec{
+			Routes: []v1.AZRoute{{Name: "vault x owner"}},
+		},
+		X: map[string]string{"owner": "vault x owner", "plain": "value"},
+	}
+	orig := in.DeepCopy()
+
+	got, secrets, err := vaultInfraValues(context.Background(), in, m, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", got.State.Access)
+	assert.Equal(t, "t1", got.AAD.TenantID)
+	assert.Equal(t, "literal", got.AAD.ClientAppID)
+	assert.Equal(t, "harry", got.AZ.Routes[0].Name)
+	assert.Equal(t, map[string]string{"owner": "harry", "plain": "value"}, got.X)
+	assert.ElementsMatch(t, []string{"s3cr3t", "t1", "harry", "harry"}, secretValues(secrets))
+	assert.Contains(t, secrets, resolvedSecret{Path: "infra.state.access", Ref: "vault tf", Value: "s3cr3t"})
+	assert.Equal(t, orig, &in, "input should not be modified")
+}
+
+func Test_vaultClusterValues(t *testing.T) {
+	m := &secret.Mux{Default: fakeSecrets{"git/token": "t0k3n"}}
+
+	in := []v1.ClusterSpec{
+		{
+			Name: "one",
+			Infra: v1.ClusterInfraSpec{
+				Pools: map[string]v1.NodepoolSpec{"default": {VMSize: "vault vm size"}},
+			},
+			Addons: v1.ClusterAddonSpec{
+				Source: v1.SourceSpec{Token: "vault git token"},
+				X:      map[string]string{"a": "vault nope", "b": "vault git token"},
+			},
+		},
+		{
+			Name:   "two",
+			Addons: v1.ClusterAddonSpec{Jobs: []string{"vault git nope"}},
+		},
+	}
+
+	got, secrets, err := vaultClusterValues(context.Background(), in, m, "default")
+	if assert.Error(t, err) {
+		// every unresolved path is reported.
+		for _, p := range []string{
+			"field clusters[one].infra.pools.default.vmSize: not found",
+			"field clusters[one].addons.x.a: not found",
+			"field clusters[two].addons.jobs[0]: not found",
+		} {
+			assert.Contains(t, err.Error(), p)
+		}
+	}
+	assert.Equal(t, "t0k3n", got[0].Addons.Source.Token)
+	assert.Equal(t, "t0k3n", got[0].Addons.X["b"])
+	assert.Equal(t, []resolvedSecret{
+		{Path: "clusters[one].addons.source.token", Ref: "vault git token", Value: "t0k3n"},
+		{Path: "clusters[one].addons.x.b", Ref: "vault git token", Value: "t0k3n"},
+	}, secrets)
+	assert.Equal(t, "vault git token", in[0].Addons.Source.Token, "input should not be modified")
+}
+
+func Test_walkStrings(t *testing.T) {
+	spec := v1.ClusterSpec{
+		Name:  "vault x name",
+		Infra: v1.ClusterInfraSpec{X: map[string]string{"a": "vault x a", "b": "plain"}},
+	}
+	var paths []string
+	walkStrings(reflect.ValueOf(&spec), "spec", func(path, s string) (string, bool) {
+		paths = append(paths, path)
+		if strings.HasPrefix(s, "vault ") {
+			return "resolved", true
+		}
+		return s, false
+	})
+
+	assert.Equal(t, "resolved", spec.Name)
+	assert.Equal(t, map[string]string{"a": "resolved", "b": "plain"}, spec.Infra.X)
+	assert.Contains(t, paths, "spec.infra.x.a")
+	assert.Contains(t, paths, "spec.infra.x.b")
+}
+
+func Test_sensitiveValues(t *testing.T) {
+	infra := v1.InfraSpec{
+		EnvName: "local",
+		Source:  v1.SourceSpec{Token: "infra-token"},
+		State:   v1.StateSpec{StorageAccount: "account", Access: "access-key"},
+		AAD:     v1.AADSpec{TenantID: "tenant", ServerAppSecret: "server-secret"},
+	}
+	clusters := []v1.ClusterSpec{
+		{Name: "one", Addons: v1.ClusterAddonSpec{Source: v1.SourceSpec{URL: "https://example.com", Token: "addons-token"}}},
+	}
+
+	got := sensitiveValues(infra, clusters)
+
+	assert.Equal(t, []string{"infra-token", "access-key", "server-secret", "addons-token"}, got)
+}
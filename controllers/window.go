@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"fmt"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/plan"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+	"time"
+)
+
+// LegacyScheduleDuration is the duration of the window that is opened by the deprecated infra and addons schedules.
+// The window opens this long before the schedule fires and closes when it fires, like the schedules always did.
+const legacyScheduleDuration = 10 * time.Minute
+
+// ScheduleParser parses the CRON formatted schedules in the spec.
+//
+//	Field name   | Mandatory? | Allowed values  | Allowed special characters
+//	----------   | ---------- | --------------  | --------------------------
+//	Minutes      | Yes        | 0-59            | * / , -
+//	Hours        | Yes        | 0-23            | * / , -
+//	Day of month | Yes        | 1-31            | * / , - ?
+//	Month        | Yes        | 1-12 or JAN-DEC | * / , -
+//	Day of week  | Yes        | 0-6 or SUN-SAT  | * / , - ?
+//
+//	Special character | Meaning
+//	----------------- | -------
+//	*                 | always
+//	/                 | interval, for example */5 is every 5m
+//	,                 | list, for example MON,FRI in DayOfWeek field
+//	-                 | range, for example 20-04 in hour field
+//
+// See https://godoc.org/github.com/robfig/cron#Parser
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// Window is a parsed maintenance window.
+type window struct {
+	// steps are the step types or short names the window applies to, empty means all steps.
+	steps []string
+	start cron.Schedule
+	// lead is the time the window opens before start fires.
+	lead     time.Duration
+	duration time.Duration
+	location *time.Location
+}
+
+// MaintenanceWindows returns the windows of spec.windows and the windows that replace the deprecated
+// spec.infra.schedule and (cluster) addons.schedule.
+func maintenanceWindows(spec v1.EnvironmentSpec) ([]window, error) {
+	var r []window
+	for i, w := range spec.Windows {
+		pw, err := parseWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("spec.windows[%d].%w", i, err)
+		}
+		r = append(r, pw)
+	}
+
+	// The deprecated schedules are evaluated in the time zone of the operator like they have always been.
+	if s := spec.Infra.Schedule; s != "" {
+		sc, err := scheduleParser.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("spec.infra.schedule: %w", err)
+		}
+		r = append(r, legacyWindow(nil, sc))
+	}
+	for _, c := range spec.Clusters {
+		s := c.Addons.Schedule
+		if s == "" {
+			s = spec.Defaults.Addons.Schedule
+		}
+		if s == "" {
+			continue
+		}
+		sc, err := scheduleParser.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s addons.schedule: %w", c.Name, err)
+		}
+		n := step.ID{Type: step.TypeAddons, ClusterName: c.Name}.ShortName()
+		r = append(r, legacyWindow([]string{n}, sc))
+	}
+
+	return r, nil
+}
+
+// LegacyWindow returns the window of a deprecated schedule for steps.
+func legacyWindow(steps []string, sc cron.Schedule) window {
+	return window{steps: steps, start: sc, lead: legacyScheduleDuration, duration: legacyScheduleDuration, location: time.Local}
+}
+
+// ParseWindow returns the window defined by w.
+// Errors are prefixed with the name of the field in error.
+func parseWindow(w v1.MaintenanceWindow) (window, error) {
+	sc, err := scheduleParser.Parse(w.Start)
+	if err != nil {
+		return window{}, fmt.Errorf("start: %w", err)
+	}
+	if w.Duration.Duration <= 0 {
+		return window{}, fmt.Errorf("duration: must be greater than 0")
+	}
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return window{}, fmt.Errorf("timeZone: %w", err)
+	}
+	return window{steps: w.Steps, start: sc, duration: w.Duration.Duration, location: loc}, nil
+}
+
+// AppliesTo returns true when the window applies to the step with id.
+func (w window) appliesTo(id step.ID) bool {
+	if len(w.steps) == 0 {
+		return true
+	}
+	for _, s := range w.steps {
+		if s == string(id.Type) || s == id.ShortName() {
+			return true
+		}
+	}
+	return false
+}
+
+// Open returns true when the window is open at time now.
+// When the window is closed the time until it opens again is returned.
+func (w window) open(now time.Time) (bool, time.Duration) {
+	// the first start after now-duration is either the start of the current window or the start of the next window.
+	start := w.start.Next(now.Add(w.lead - w.duration).In(w.location)).Add(-w.lead)
+	if !start.After(now) {
+		return true, 0
+	}
+	return false, start.Sub(now)
+}
+
+// WindowGate returns true when the step with id is allowed to start at time now.
+// A step is allowed to start when one of the windows that apply to it is open or when no window applies to it.
+// When the gate is closed the time until the first window opens is returned.
+func windowGate(windows []window, id step.ID, now time.Time) (bool, time.Duration) {
+	var applies bool
+	var wait time.Duration
+	for _, w := range windows {
+		if !w.appliesTo(id) {
+			continue
+		}
+		applies = true
+		ok, d := w.open(now)
+		if ok {
+			return true, 0
+		}
+		if wait == 0 || d < wait {
+			wait = d
+		}
+	}
+	return !applies, wait
+}
+
+// PendingSteps returns the steps in pending and the steps that can't start before a pending step has completed.
+// A dependant can start when the last of the windows of its pending dependencies and its own windows opens.
+func pendingSteps(grph plan.Graph, completed, started map[string]bool, pending map[string]v1.PendingStep, windows []window, now time.Time) []v1.PendingStep {
+	all := make(map[string]v1.PendingStep, len(pending))
+	for n, p := range pending {
+		all[n] = p
+	}
+	// grph.Steps are in execution order so dependencies are visited before their dependants.
+	for _, stp := range grph.Steps {
+		n := stp.GetID().ShortName()
+		if _, ok := all[n]; ok || completed[n] || started[n] {
+			continue
+		}
+		var start *metav1.Time
+		for _, d := range grph.DependsOn[n] {
+			if p, ok := all[d]; ok && (start == nil || p.WindowStart.After(start.Time)) {
+				start = p.WindowStart.DeepCopy()
+			}
+		}
+		if start == nil {
+			continue
+		}
+		if ok, w := windowGate(windows, stp.GetID(), now); !ok && now.Add(w).After(start.Time) {
+			start = &metav1.Time{Time: now.Add(w).Truncate(time.Second)}
+		}
+		all[n] = v1.PendingStep{Name: n, Hash: stp.GetHash(), WindowStart: *start}
+	}
+
+	r := make([]v1.PendingStep, 0, len(all))
+	for _, p := range all {
+		r = append(r, p)
+	}
+	return r
+}
+
+// SetWindowStatus sets the steps that are waiting for a maintenance window and the time the first window opens in
+// status.
+// Returns true when status has changed.
+func setWindowStatus(status *v1.EnvironmentStatus, pending []v1.PendingStep) bool {
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Name < pending[j].Name
+	})
+	var next *metav1.Time
+	for i, p := range pending {
+		if next == nil || p.WindowStart.Before(next) {
+			next = &pending[i].WindowStart
+		}
+	}
+	if next != nil {
+		next = next.DeepCopy()
+	}
+
+	if samePendingSteps(status.PendingSteps, pending) {
+		return false
+	}
+	status.PendingSteps = pending
+	status.NextWindowStart = next
+	return true
+}
+
+// SamePendingSteps returns true when a and b contain the same steps, hashes and window start times.
+func samePendingSteps(a, b []v1.PendingStep) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Hash != b[i].Hash || !a[i].WindowStart.Equal(&b[i].WindowStart) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/step"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func Test_windowGate(t *testing.T) {
+	infra := step.ID{Type: step.TypeInfra}
+	pool := step.ID{Type: step.TypeAKSPool, ClusterName: "cpe"}
+	addons := step.ID{Type: step.TypeAddons, ClusterName: "cpe"}
+
+	tests := []struct {
+		it       string
+		windows  []v1.MaintenanceWindow
+		id       step.ID
+		now      string
+		want     bool
+		wantWait time.Duration
+	}{
+		{
+			it:   "should allow a step when there are no windows",
+			id:   infra,
+			now:  "2021-06-07T15:04:00Z",
+			want: true,
+		},
+		{
+			it: "should allow a step within a window",
+			windows: []v1.MaintenanceWindow{
+				{Start: "0 22 * * MON-FRI", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			},
+			id:   infra,
+			now:  "2021-06-08T01:30:00Z",
+			want: true,
+		},
+		{
+			it: "should return the time until the window opens",
+			windows: []v1.MaintenanceWindow{
+				{Start: "0 22 * * MON-FRI", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			},
+			id:       infra,
+			now:      "2021-06-08T02:00:00Z",
+			want:     false,
+			wantWait: 20 * time.Hour,
+		},
+		{
+			it: "should evaluate the window in its time zone",
+			windows: []v1.MaintenanceWindow{
+				{Start: "0 22 * * *", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Europe/Amsterdam"},
+			},
+			id:   infra,
+			now:  "2021-06-07T20:30:00Z", // 22:30 CEST
+			want: true,
+		},
+		{
+			it: "should allow a step that is not selected by a window",
+			windows: []v1.MaintenanceWindow{
+				{Steps: []string{"Infra"}, Start: "0 22 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+			id:   pool,
+			now:  "2021-06-07T15:00:00Z",
+			want: true,
+		},
+		{
+			it: "should allow a step when one of its windows is open",
+			windows: []v1.MaintenanceWindow{
+				{Steps: []string{"AKSPool"}, Start: "0 22 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+				{Steps: []string{"AKSPoolcpe"}, Start: "0 14 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+			},
+			id:   pool,
+			now:  "2021-06-07T15:00:00Z",
+			want: true,
+		},
+		{
+			it: "should return the time until the first window opens",
+			windows: []v1.MaintenanceWindow{
+				{Steps: []string{"Addons"}, Start: "0 22 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+				{Steps: []string{"Addonscpe"}, Start: "0 18 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+			id:       addons,
+			now:      "2021-06-07T15:00:00Z",
+			want:     false,
+			wantWait: 3 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			windows, err := maintenanceWindows(v1.EnvironmentSpec{Windows: tt.windows})
+			assert.NoError(t, err)
+			now, err := time.Parse(time.RFC3339, tt.now)
+			assert.NoError(t, err)
+
+			got, wait := windowGate(windows, tt.id, now)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantWait, wait)
+		})
+	}
+}
+
+func Test_maintenanceWindows_legacySchedules(t *testing.T) {
+	tests := []struct {
+		it       string
+		schedule string
+		now      string
+		want     bool
+	}{
+		{
+			it:       "should return true when in schedule",
+			schedule: "* 15 * * *",
+			now:      "2006-01-02T15:04:05",
+			want:     true,
+		},
+		{
+			it:       "should return false when outside schedule",
+			schedule: "* 22-23,0-4 * * *",
+			now:      "2006-01-02T15:04:05",
+			want:     false,
+		},
+		{
+			it:       "should return true at start of nightly schedule",
+			schedule: "* 0-4 * * *",
+			now:      "2006-01-02T00:04:05",
+			want:     true,
+		},
+		{
+			it:       "should return true within 10 minutes before the schedule fires",
+			schedule: "0 3 * * *",
+			now:      "2006-01-02T02:55:00",
+			want:     true,
+		},
+		{
+			it:       "should return false when the schedule has fired",
+			schedule: "0 3 * * *",
+			now:      "2006-01-02T03:05:00",
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			// the deprecated schedules are evaluated in the time zone of the operator.
+			now, err := time.ParseInLocation("2006-01-02T15:04:05", tt.now, time.Local)
+			assert.NoError(t, err)
+
+			spec := v1.EnvironmentSpec{
+				Infra:    v1.InfraSpec{Schedule: tt.schedule},
+				Clusters: []v1.ClusterSpec{{Name: "cpe"}, {Name: "second", Addons: v1.ClusterAddonSpec{Schedule: "0 0 1 1 *"}}},
+				Defaults: v1.ClusterSpec{Addons: v1.ClusterAddonSpec{Schedule: tt.schedule}},
+			}
+			windows, err := maintenanceWindows(spec)
+			assert.NoError(t, err)
+
+			got, _ := windowGate(windows, step.ID{Type: step.TypeInfra}, now)
+			assert.Equal(t, tt.want, got, "infra.schedule")
+			// addons of cluster cpe are allowed by the infra or the default addons schedule.
+			got, _ = windowGate(windows, step.ID{Type: step.TypeAddons, ClusterName: "cpe"}, now)
+			assert.Equal(t, tt.want, got, "defaults.addons.schedule")
+		})
+	}
+
+	_, err := maintenanceWindows(v1.EnvironmentSpec{Infra: v1.InfraSpec{Schedule: "* 22-04 * * *"}})
+	assert.EqualError(t, err, "spec.infra.schedule: beginning of range (22) beyond end of range (4): 22-04")
+}
+
+func Test_setWindowStatus(t *testing.T) {
+	t1 := metav1.Time{Time: time.Date(2021, 6, 8, 2, 0, 0, 0, time.UTC)}
+	t2 := metav1.Time{Time: time.Date(2021, 6, 8, 22, 0, 0, 0, time.UTC)}
+
+	status := &v1.EnvironmentStatus{}
+	assert.False(t, setWindowStatus(status, nil), "should not change when nothing is pending")
+
+	assert.True(t, setWindowStatus(status, []v1.PendingStep{
+		{Name: "Infra", Hash: "123", WindowStart: t2},
+		{Name: "AKSPoolcpe", Hash: "456", WindowStart: t1},
+	}))
+	assert.Equal(t, []v1.PendingStep{
+		{Name: "AKSPoolcpe", Hash: "456", WindowStart: t1},
+		{Name: "Infra", Hash: "123", WindowStart: t2},
+	}, status.PendingSteps, "should sort by name")
+	if assert.NotNil(t, status.NextWindowStart) {
+		assert.True(t, t1.Equal(status.NextWindowStart), "should be the first window to open")
+	}
+
+	assert.False(t, setWindowStatus(status, []v1.PendingStep{
+		{Name: "Infra", Hash: "123", WindowStart: metav1.Time{Time: t2.In(time.Local)}},
+		{Name: "AKSPoolcpe", Hash: "456", WindowStart: t1},
+	}), "should not change when the same steps are pending")
+
+	assert.True(t, setWindowStatus(status, nil))
+	assert.Nil(t, status.PendingSteps)
+	assert.Nil(t, status.NextWindowStart)
+}
@@ -80,8 +80,8 @@ func testSpecLocal(clusterCnt int) *v1.EnvironmentSpec {
 	}
 
 	name := func(i int) string {
-		if i > 1 {
-			return "xyz" + strconv.Itoa(i)
+		if i > 0 {
+			return "xyz" + strconv.Itoa(i+1)
 		}
 		return "xyz"
 	}
@@ -92,7 +92,7 @@ func testSpecLocal(clusterCnt int) *v1.EnvironmentSpec {
 				Name: name(i),
 
 				Infra: v1.ClusterInfraSpec{
-					SubnetNum: 1,
+					SubnetNum: int32(i + 1),
 					Pools: map[string]v1.NodepoolSpec{
 						"default": {Scale: 2, VMSize: "Standard_DS2_v2"},
 					},
@@ -15,11 +15,16 @@ require (
 	github.com/mmlt/testr v0.0.0-20200331071714-d38912dd7e5a
 	github.com/otiai10/copy v1.1.1
 	github.com/patrickmn/go-cache v2.1.0+incompatible
+	github.com/prometheus/client_golang v1.11.0
 	github.com/robfig/cron/v3 v3.0.0
 	github.com/rodaine/hclencoder v0.0.0-20190213202847-fb9757bb536e
 	github.com/securego/gosec/v2 v2.8.1
 	github.com/spf13/cobra v1.1.3
 	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	golang.org/x/tools v0.1.3
 	k8s.io/api v0.21.1
 	k8s.io/apimachinery v0.21.1
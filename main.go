@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/mmlt/environment-operator/cmd"
 	"os"
+	// embed the time zone database so maintenance windows work in images without tzdata.
+	_ "time/tzdata"
 )
 
 func main() {
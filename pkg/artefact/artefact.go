@@ -0,0 +1,112 @@
+// Package artefact archives the files written by steps (like terraform plan and apply output) to a store.
+//
+// Artefacts are stored per run with key prefix/run/file where run is the UTC start time of the step, for example:
+//
+//	default/env1/Infra/20210603T101112Z/plan.txt
+//
+// Runs are sortable by key so the oldest runs can be removed when there are more runs than the retention.
+package artefact
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store stores artefacts by key.
+// Keys are slash separated paths.
+type Store interface {
+	// Put stores data with key and returns a link to the stored artefact.
+	Put(ctx context.Context, key string, data []byte) (string, error)
+	// List returns the keys that start with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes the artefact with key.
+	Delete(ctx context.Context, key string) error
+}
+
+// RunID returns the run part of the key for a step that started at t.
+func RunID(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// Archive puts the files in paths that are modified at or after since in store with key prefix/RunID(since)/filename.
+// Files that don't exist or are older than since (written by a previous run) are skipped.
+// After archiving the oldest runs are removed so at most keep runs remain, keep < 1 keeps all runs.
+// Archive returns the links to the stored artefacts.
+func Archive(ctx context.Context, store Store, prefix string, paths []string, since time.Time, keep int) ([]string, error) {
+	var links []string
+	var errs error
+
+	run := RunID(since)
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil || fi.IsDir() || fi.ModTime().Before(since.Truncate(time.Second)) {
+			continue
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		l, err := store.Put(ctx, path.Join(prefix, run, filepath.Base(p)), b)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("put %s: %w", filepath.Base(p), err))
+			continue
+		}
+		links = append(links, l)
+	}
+
+	if keep > 0 {
+		err := prune(ctx, store, prefix, keep)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	return links, errs
+}
+
+// Prune removes the artefacts of the oldest runs under prefix so at most keep runs remain.
+func prune(ctx context.Context, store Store, prefix string, keep int) error {
+	keys, err := store.List(ctx, prefix+"/")
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+
+	byRun := make(map[string][]string)
+	for _, k := range keys {
+		rel := strings.TrimPrefix(k, prefix+"/")
+		i := strings.Index(rel, "/")
+		if i < 0 {
+			continue
+		}
+		byRun[rel[:i]] = append(byRun[rel[:i]], k)
+	}
+	if len(byRun) <= keep {
+		return nil
+	}
+
+	runs := make([]string, 0, len(byRun))
+	for r := range byRun {
+		runs = append(runs, r)
+	}
+	sort.Strings(runs)
+
+	var errs error
+	for _, r := range runs[:len(runs)-keep] {
+		for _, k := range byRun[r] {
+			err := store.Delete(ctx, k)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("delete %s: %w", k, err))
+			}
+		}
+	}
+	return errs
+}
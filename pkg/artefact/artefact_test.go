@@ -0,0 +1,81 @@
+package artefact
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	src := t.TempDir()
+	store := Dir{Path: t.TempDir()}
+	ctx := context.Background()
+
+	write := func(name, text string, modTime time.Time) string {
+		p := filepath.Join(src, name)
+		assert.NoError(t, ioutil.WriteFile(p, []byte(text), 0644))
+		assert.NoError(t, os.Chtimes(p, modTime, modTime))
+		return p
+	}
+
+	start := time.Date(2021, 6, 3, 10, 11, 12, 0, time.UTC)
+	paths := []string{
+		write("plan.txt", "plan", start.Add(time.Second)),
+		write("apply.txt", "stale apply from a previous run", start.Add(-time.Hour)),
+		filepath.Join(src, "nonexisting.txt"),
+	}
+
+	links, err := Archive(ctx, store, "default/env1/Infra", paths, start, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"file://" + filepath.ToSlash(filepath.Join(store.Path, "default/env1/Infra/20210603T101112Z/plan.txt"))}, links)
+
+	b, err := ioutil.ReadFile(filepath.Join(store.Path, "default/env1/Infra/20210603T101112Z/plan.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "plan", string(b))
+
+	// two more runs, the oldest run is removed.
+	for _, d := range []time.Duration{time.Hour, 2 * time.Hour} {
+		p := write("plan.txt", "plan", start.Add(d))
+		_, err := Archive(ctx, store, "default/env1/Infra", []string{p}, start.Add(d), 2)
+		assert.NoError(t, err)
+	}
+
+	keys, err := store.List(ctx, "default/env1/")
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{
+		"default/env1/Infra/20210603T111112Z/plan.txt",
+		"default/env1/Infra/20210603T121112Z/plan.txt",
+	}, keys)
+	_, err = os.Stat(filepath.Join(store.Path, "default/env1/Infra/20210603T101112Z"))
+	assert.True(t, os.IsNotExist(err), "should remove the directory of a pruned run")
+}
+
+func TestArchive_keepsOtherSteps(t *testing.T) {
+	store := Dir{Path: t.TempDir()}
+	ctx := context.Background()
+	for _, k := range []string{
+		"default/env1/Infra/20210603T101112Z/plan.txt",
+		"default/env1/Infra/20210603T111112Z/plan.txt",
+		"default/env1/Drift/20210603T101112Z/drift-plan.txt",
+	} {
+		_, err := store.Put(ctx, k, []byte("x"))
+		assert.NoError(t, err)
+	}
+
+	_, err := Archive(ctx, store, "default/env1/Infra", nil, time.Now(), 1)
+	assert.NoError(t, err)
+
+	keys, err := store.List(ctx, "")
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{
+		"default/env1/Drift/20210603T101112Z/drift-plan.txt",
+		"default/env1/Infra/20210603T111112Z/plan.txt",
+	}, keys)
+}
@@ -0,0 +1,72 @@
+package artefact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir stores artefacts as files in a local directory, typically a persistent volume.
+type Dir struct {
+	// Path of the directory.
+	Path string
+}
+
+var _ Store = Dir{}
+
+// Put writes data to the file Path/key and returns its file:// URL.
+func (d Dir) Put(_ context.Context, key string, data []byte) (string, error) {
+	p := filepath.Join(d.Path, filepath.FromSlash(key))
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(p, data, 0644)
+	if err != nil {
+		return "", err
+	}
+	return "file://" + filepath.ToSlash(p), nil
+}
+
+// List returns the keys of the files under Path that start with prefix.
+func (d Dir) List(_ context.Context, prefix string) ([]string, error) {
+	var r []string
+	err := filepath.Walk(d.Path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(d.Path, p)
+		if err != nil {
+			return err
+		}
+		if k := filepath.ToSlash(rel); strings.HasPrefix(k, prefix) {
+			r = append(r, k)
+		}
+		return nil
+	})
+	return r, err
+}
+
+// Delete removes the file Path/key and the directories that became empty.
+func (d Dir) Delete(_ context.Context, key string) error {
+	p := filepath.Join(d.Path, filepath.FromSlash(key))
+	err := os.Remove(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// remove empty parent directories (Remove fails on non-empty directories).
+	for dir := filepath.Dir(p); dir != filepath.Clean(d.Path) && strings.HasPrefix(dir, filepath.Clean(d.Path)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
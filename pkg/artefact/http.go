@@ -0,0 +1,240 @@
+package artefact
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// API is the flavor of object storage API that is used by HTTP.
+type API string
+
+const (
+	// APIS3 is the Amazon S3 (compatible) API.
+	APIS3 API = "s3"
+	// APIAzure is the Azure Blob Storage API.
+	APIAzure API = "azure"
+)
+
+// HTTP stores artefacts in an S3 bucket or Azure Blob Storage container.
+// S3 requests are signed with S3Credentials when they are set. Otherwise authorization is by the query of URL (for
+// example an Azure SAS token) and/or Header (for example a bearer token added by a proxy).
+type HTTP struct {
+	// URL of the bucket or container, for example https://account.blob.core.windows.net/artefacts?sv=...&sig=...
+	// The query of the URL is added to every request but not to the returned links.
+	URL string
+	// API is the flavor of API to use, empty means APIS3.
+	API API
+	// Header (optional) is added to every request.
+	Header http.Header
+	// S3Credentials (optional) are used to sign the requests when API is APIS3.
+	S3Credentials *S3Credentials
+	// Client is the HTTP client to use, nil uses http.DefaultClient.
+	Client *http.Client
+}
+
+var _ Store = HTTP{}
+
+// Put uploads data as object key and returns the object URL.
+func (h HTTP) Put(ctx context.Context, key string, data []byte) (string, error) {
+	base, query, err := h.split()
+	if err != nil {
+		return "", err
+	}
+	u := base + "/" + escapeKey(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, withQuery(u, query), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if h.API == APIAzure {
+		req.Header.Set("x-ms-blob-type", "BlockBlob")
+	}
+
+	resp, err := h.do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	return u, nil
+}
+
+// List returns the keys of the objects that start with prefix.
+func (h HTTP) List(ctx context.Context, prefix string) ([]string, error) {
+	base, query, err := h.split()
+	if err != nil {
+		return nil, err
+	}
+
+	var r []string
+	var marker string
+	for {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("prefix", prefix)
+		if h.API == APIAzure {
+			q.Set("restype", "container")
+			q.Set("comp", "list")
+			if marker != "" {
+				q.Set("marker", marker)
+			}
+		} else {
+			q.Set("list-type", "2")
+			if marker != "" {
+				q.Set("continuation-token", marker)
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := h.do(req)
+		if err != nil {
+			return nil, err
+		}
+		keys, next, err := h.parseList(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list: %w", err)
+		}
+
+		r = append(r, keys...)
+		if next == "" {
+			return r, nil
+		}
+		marker = next
+	}
+}
+
+// Delete removes object key.
+func (h HTTP) Delete(ctx context.Context, key string) error {
+	base, query, err := h.split()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, withQuery(base+"/"+escapeKey(key), query), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Split returns URL without query and the query of URL.
+func (h HTTP) split() (string, url.Values, error) {
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return "", nil, fmt.Errorf("artefact url: %w", err)
+	}
+	q := u.Query()
+	u.RawQuery = ""
+	return strings.TrimSuffix(u.String(), "/"), q, nil
+}
+
+// Do sends req with Header (signed when S3Credentials are set) and returns an error when the response status is not 2xx.
+func (h HTTP) do(req *http.Request) (*http.Response, error) {
+	for k, vs := range h.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if h.API != APIAzure && h.S3Credentials != nil {
+		err := h.S3Credentials.sign(req)
+		if err != nil {
+			return nil, fmt.Errorf("sign: %w", err)
+		}
+	}
+
+	cl := h.Client
+	if cl == nil {
+		cl = http.DefaultClient
+	}
+	resp, err := cl.Do(req)
+	if err != nil {
+		// the error contains the URL, remove the query because it might contain a token.
+		if ue, ok := err.(*url.Error); ok {
+			ue.URL = strings.SplitN(ue.URL, "?", 2)[0]
+		}
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+// ParseList returns the keys in a list response and the marker for the next page (empty if there is none).
+func (h HTTP) parseList(r io.Reader) ([]string, string, error) {
+	if h.API == APIAzure {
+		var l struct {
+			Blobs struct {
+				Blob []struct {
+					Name string `xml:"Name"`
+				} `xml:"Blob"`
+			} `xml:"Blobs"`
+			NextMarker string `xml:"NextMarker"`
+		}
+		err := xml.NewDecoder(r).Decode(&l)
+		if err != nil {
+			return nil, "", err
+		}
+		var keys []string
+		for _, b := range l.Blobs.Blob {
+			keys = append(keys, b.Name)
+		}
+		return keys, l.NextMarker, nil
+	}
+
+	var l struct {
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+	err := xml.NewDecoder(r).Decode(&l)
+	if err != nil {
+		return nil, "", err
+	}
+	var keys []string
+	for _, c := range l.Contents {
+		keys = append(keys, c.Key)
+	}
+	if !l.IsTruncated {
+		return keys, "", nil
+	}
+	return keys, l.NextContinuationToken, nil
+}
+
+// EscapeKey returns key with each path segment escaped.
+// Only the unreserved characters are kept so the path is the same as the canonical path of a signed request.
+func escapeKey(key string) string {
+	return uriEncode(key, false)
+}
+
+// WithQuery returns u with query q.
+func withQuery(u string, q url.Values) string {
+	if len(q) == 0 {
+		return u
+	}
+	return u + "?" + q.Encode()
+}
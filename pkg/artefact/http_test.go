@@ -0,0 +1,178 @@
+package artefact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FakeObjectStore is a minimal in-memory stand-in for an S3 bucket or Azure Blob container.
+// Lists return one key per page to exercise paging.
+type fakeObjectStore struct {
+	api API
+	sig string
+	// creds when set are used to verify the signature of requests instead of sig.
+	creds *S3Credentials
+
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func (f *fakeObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if f.creds != nil && !f.validSignature(r, body) || f.creds == nil && r.URL.Query().Get("sig") != f.sig {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+
+	switch r.Method {
+	case http.MethodPut:
+		if f.api == APIAzure && r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = string(body)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodGet:
+		q := r.URL.Query()
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, q.Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		// page is a single key, the marker is the index of the key.
+		i, _ := strconv.Atoi(q.Get("marker") + q.Get("continuation-token"))
+		var page []string
+		if i < len(keys) {
+			page = keys[i : i+1]
+		}
+		var next string
+		if i+1 < len(keys) {
+			next = strconv.Itoa(i + 1)
+		}
+
+		if f.api == APIAzure {
+			fmt.Fprint(w, "<EnumerationResults><Blobs>")
+			for _, k := range page {
+				fmt.Fprintf(w, "<Blob><Name>%s</Name></Blob>", k)
+			}
+			fmt.Fprintf(w, "</Blobs><NextMarker>%s</NextMarker></EnumerationResults>", next)
+			return
+		}
+		fmt.Fprint(w, "<ListBucketResult>")
+		for _, k := range page {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", k)
+		}
+		fmt.Fprintf(w, "<IsTruncated>%t</IsTruncated><NextContinuationToken>%s</NextContinuationToken></ListBucketResult>", next != "", next)
+	}
+}
+
+// ValidSignature returns true when r with body is signed with creds.
+func (f *fakeObjectStore) validSignature(r *http.Request, body []byte) bool {
+	auth := r.Header.Get("Authorization")
+	i := strings.Index(auth, "SignedHeaders=")
+	if i < 0 {
+		return false
+	}
+	signed := strings.SplitN(auth[i+len("SignedHeaders="):], ",", 2)[0]
+
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	for _, h := range strings.Split(signed, ";") {
+		if h != "host" && h != "x-amz-date" && h != "x-amz-content-sha256" {
+			req.Header.Set(h, r.Header.Get(h))
+		}
+	}
+	err = f.creds.sign(req)
+	return err == nil && req.Header.Get("Authorization") == auth
+}
+
+func TestHTTP(t *testing.T) {
+	creds := &S3Credentials{AccessKeyID: "id", SecretAccessKey: "s3cr3t", Region: "eu-west-1"}
+	tests := []struct {
+		it    string
+		api   API
+		query string
+		creds *S3Credentials
+	}{
+		{it: "s3 with a presigned query", api: APIS3, query: "?sig=s3cr3t"},
+		{it: "s3 with signed requests", api: APIS3, creds: creds},
+		{it: "azure", api: APIAzure, query: "?sig=s3cr3t"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			fake := &fakeObjectStore{api: tt.api, sig: "s3cr3t", creds: tt.creds, objects: map[string]string{}}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			ctx := context.Background()
+
+			h := HTTP{URL: srv.URL + "/bucket/" + tt.query, API: tt.api, S3Credentials: tt.creds}
+
+			link, err := h.Put(ctx, "default/env1/Infra/20210603T101112Z/plan.txt", []byte("plan"))
+			assert.NoError(t, err)
+			assert.Equal(t, srv.URL+"/bucket/default/env1/Infra/20210603T101112Z/plan.txt", link, "link should not contain the query")
+			_, err = h.Put(ctx, "default/env1/Infra/20210603T111112Z/plan.txt", []byte("plan2"))
+			assert.NoError(t, err)
+			_, err = h.Put(ctx, "default/env2/Infra/20210603T111112Z/plan.txt", []byte("other"))
+			assert.NoError(t, err)
+			assert.Equal(t, "plan", fake.objects["default/env1/Infra/20210603T101112Z/plan.txt"])
+
+			keys, err := h.List(ctx, "default/env1/")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{
+				"default/env1/Infra/20210603T101112Z/plan.txt",
+				"default/env1/Infra/20210603T111112Z/plan.txt",
+			}, keys)
+
+			err = prune(ctx, h, "default/env1/Infra", 1)
+			assert.NoError(t, err)
+			assert.Len(t, fake.objects, 2)
+			assert.NotContains(t, fake.objects, "default/env1/Infra/20210603T101112Z/plan.txt")
+		})
+	}
+}
+
+func TestHTTP_errors(t *testing.T) {
+	fake := &fakeObjectStore{sig: "s3cr3t", objects: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	h := HTTP{URL: srv.URL + "/bucket?sig=wrong"}
+	_, err := h.Put(context.Background(), "a/b.txt", []byte("x"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "403")
+		assert.NotContains(t, err.Error(), "wrong", "error should not contain the query")
+	}
+}
+
+func TestHTTP_wrongSignature(t *testing.T) {
+	fake := &fakeObjectStore{creds: &S3Credentials{AccessKeyID: "id", SecretAccessKey: "s3cr3t"}, objects: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	h := HTTP{URL: srv.URL + "/bucket", S3Credentials: &S3Credentials{AccessKeyID: "id", SecretAccessKey: "wrong"}}
+	_, err := h.Put(context.Background(), "a/b.txt", []byte("x"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "403")
+	}
+}
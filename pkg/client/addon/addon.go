@@ -64,7 +64,7 @@ func (a *Addon) Start(ctx context.Context, env []string, dir, jobPath, valuesPat
 
 	cmd.Stderr = cmd.Stdout // combine
 
-	err = cmd.Start()
+	err = exe.Start(ctx, cmd)
 	if err != nil {
 		return nil, nil, err
 	}
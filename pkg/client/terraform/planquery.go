@@ -13,7 +13,7 @@ import (
 func (t *Terraform) GetPlan(ctx context.Context, env []string, dir string) (*gabs.Container, error) {
 	log := logr.FromContext(ctx).WithName("GetPlan")
 
-	o, _, err := exe.Run(log, &exe.Opt{Dir: dir, Env: env}, "", "terraform", "show",
+	o, _, err := exe.RunContext(ctx, log, &exe.Opt{Dir: dir, Env: env}, "", "terraform", "show",
 		"-json", planName)
 	if err != nil {
 		return nil, err
@@ -84,6 +84,58 @@ const (
 	ActionDelete
 )
 
+// String returns the action as used in terraform plans.
+// A delete and create of the same resource is a "replace".
+func (a Action) String() string {
+	switch a {
+	case 0:
+		return "no-op"
+	case ActionCreate:
+		return "create"
+	case ActionUpdate:
+		return "update"
+	case ActionDelete:
+		return "delete"
+	case ActionCreate | ActionDelete:
+		return "replace"
+	default:
+		return fmt.Sprintf("action(%d)", int(a))
+	}
+}
+
+// ResourceChangesFromPlan parses a plan and returns all resources that are going to be created, updated or deleted.
+// The plan json conforms to https://www.terraform.io/docs/internals/json-format.html
+func ResourceChangesFromPlan(plan *gabs.Container) []ResourceChange {
+	var r []ResourceChange
+	for _, chg := range plan.Path("resource_changes").Children() {
+		act := stringsToAction(chg.Path("change.actions").Children())
+		if act == 0 {
+			// no change
+			continue
+		}
+
+		addr, _ := chg.Path("address").Data().(string)
+		typ, _ := chg.Path("type").Data().(string)
+
+		r = append(r, ResourceChange{
+			Address: addr,
+			Type:    typ,
+			Action:  act,
+		})
+	}
+
+	return r
+}
+
+// ResourceChange represents a terraform resource change.
+type ResourceChange struct {
+	// Address is the absolute resource address, for example module.aks1.azurerm_kubernetes_cluster.this
+	Address string
+	// Type is the resource type, for example azurerm_kubernetes_cluster
+	Type   string
+	Action Action
+}
+
 // PoolsFromPlan parses a plan and returns AKS Pools that are going to be created, updated or deleted.
 // The plan json conforms to https://www.terraform.io/docs/internals/json-format.html
 func PoolsFromPlan(plan *gabs.Container) ([]AKSPool, error) {
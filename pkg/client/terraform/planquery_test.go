@@ -48,6 +48,38 @@ func Test_PoolsFromPlan(t *testing.T) {
 	}
 }
 
+func Test_ResourceChangesFromPlan(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "plan.json"))
+	assert.NoError(t, err)
+	json, err := gabs.ParseJSON(b)
+	assert.NoError(t, err)
+
+	// cat pkg/client/terraform/testdata/plan.json | jq '.resource_changes[] | select(.change.actions != ["no-op"]) | .address'
+	want := []ResourceChange{
+		{Address: "azurerm_management_lock.env-sa", Type: "azurerm_management_lock", Action: ActionDelete},
+		{Address: "azurerm_monitor_diagnostic_setting.aks1", Type: "azurerm_monitor_diagnostic_setting", Action: ActionDelete},
+		{Address: "azurerm_role_assignment.sa1", Type: "azurerm_role_assignment", Action: ActionDelete},
+		{Address: "azurerm_storage_account.sa1", Type: "azurerm_storage_account", Action: ActionDelete},
+		{Address: "azurerm_storage_container.velero1", Type: "azurerm_storage_container", Action: ActionDelete},
+		{Address: "module.aks1.azurerm_kubernetes_cluster.this", Type: "azurerm_kubernetes_cluster", Action: ActionDelete},
+		{Address: `module.aks1.azurerm_kubernetes_cluster_node_pool.this["extra"]`, Type: "azurerm_kubernetes_cluster_node_pool", Action: ActionUpdate},
+		{Address: `module.aks1.azurerm_kubernetes_cluster_node_pool.this["extra1"]`, Type: "azurerm_kubernetes_cluster_node_pool", Action: ActionDelete},
+		{Address: `module.aks1.azurerm_kubernetes_cluster_node_pool.this["extra2"]`, Type: "azurerm_kubernetes_cluster_node_pool", Action: ActionDelete},
+		{Address: `module.aks1.azurerm_kubernetes_cluster_node_pool.this["extra3"]`, Type: "azurerm_kubernetes_cluster_node_pool", Action: ActionDelete},
+	}
+
+	got := ResourceChangesFromPlan(json)
+	assert.Equal(t, want, got)
+}
+
+func TestAction_String(t *testing.T) {
+	assert.Equal(t, "no-op", Action(0).String())
+	assert.Equal(t, "create", ActionCreate.String())
+	assert.Equal(t, "update", ActionUpdate.String())
+	assert.Equal(t, "delete", ActionDelete.String())
+	assert.Equal(t, "replace", (ActionCreate | ActionDelete).String())
+}
+
 func Test_pathToMap(t *testing.T) {
 	tests := []struct {
 		it      string
@@ -90,7 +90,7 @@ const planName = "newplan"
 func (t *Terraform) Init(ctx context.Context, env []string, dir string) *TFResult {
 	log := logr.FromContext(ctx).WithName("TFInit")
 
-	o, _, err := exe.Run(log, &exe.Opt{Dir: dir, Env: env}, "", "terraform", "init", "-input=false", "-no-color")
+	o, _, err := exe.RunContext(ctx, log, &exe.Opt{Dir: dir, Env: env}, "", "terraform", "init", "-input=false", "-no-color")
 
 	return parseInitResponse(o, err)
 }
@@ -119,7 +119,7 @@ func parseInitResponse(text string, err error) *TFResult {
 func (t *Terraform) Plan(ctx context.Context, env []string, dir string) *TFResult {
 	log := logr.FromContext(ctx).WithName("TFPlan")
 
-	o, _, err := exe.Run(log, &exe.Opt{Dir: dir, Env: env}, "", "terraform", "plan",
+	o, _, err := exe.RunContext(ctx, log, &exe.Opt{Dir: dir, Env: env}, "", "terraform", "plan",
 		"-out="+planName, "-detailed-exitcode", "-input=false", "-no-color")
 	return parsePlanResponse(o, err)
 }
@@ -182,7 +182,7 @@ func (t *Terraform) StartApply(ctx context.Context, env []string, dir string) (*
 
 	cmd.Stderr = cmd.Stdout // combine
 
-	err = cmd.Start()
+	err = exe.Start(ctx, cmd)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -208,7 +208,7 @@ func (t *Terraform) StartDestroy(ctx context.Context, env []string, dir string)
 
 	cmd.Stderr = cmd.Stdout // combine
 
-	err = cmd.Start()
+	err = exe.Start(ctx, cmd)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -341,7 +341,7 @@ func normalizeAction(s string) string {
 func (t *Terraform) Output(ctx context.Context, env []string, dir string) (map[string]interface{}, error) {
 	log := logr.FromContext(ctx).WithName("TFOutput")
 
-	o, _, err := exe.Run(log, &exe.Opt{Dir: dir, Env: env}, "", "terraform", "output", "-json", "-no-color")
+	o, _, err := exe.RunContext(ctx, log, &exe.Opt{Dir: dir, Env: env}, "", "terraform", "output", "-json", "-no-color")
 	if err != nil {
 		return nil, err
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/mmlt/environment-operator/pkg/client/azure"
+	"github.com/mmlt/environment-operator/pkg/redact"
 	gocache "github.com/patrickmn/go-cache"
 	"io/ioutil"
 	"time"
@@ -48,6 +49,7 @@ func (a *Azure) Login() (*ServicePrincipal, error) {
 	}
 
 	// login
+	redact.Add(sp.ClientSecret)
 	err = a.Client.LoginSP(sp.ClientID, sp.ClientSecret, sp.Tenant)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,83 @@
+// Package metrics defines the envop Prometheus metrics.
+// The metrics are registered with the controller-runtime registry and served on the manager metrics endpoint.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "envop"
+
+var (
+	// StepExecutions counts the steps that have ended by type and final state.
+	StepExecutions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "step_executions_total",
+		Help:      "Number of step executions by step type and final state.",
+	}, []string{"type", "state"})
+
+	// StepDuration observes the time from a step start until it ends.
+	StepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "step_duration_seconds",
+		Help:      "Duration of step executions by step type.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"type"})
+
+	// TerraformResources counts the resources that are added, changed or deleted by terraform.
+	TerraformResources = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "terraform_resources_total",
+		Help:      "Number of resources added, changed or deleted by terraform by step type and action.",
+	}, []string{"type", "action"})
+
+	// BudgetRejections counts the plans that are rejected because they exceed a budget or violate the policy.
+	BudgetRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "budget_rejections_total",
+		Help:      "Number of terraform plans rejected by a budget or policy by step type and reason (limits, rules or policy).",
+	}, []string{"type", "reason"})
+
+	// SourceFetchDuration observes the time it takes to fetch a source repo.
+	SourceFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "source_fetch_duration_seconds",
+		Help:      "Duration of source fetches by repo.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"repo"})
+
+	// SourceFetchFailures counts the failed fetches of a source repo.
+	SourceFetchFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "source_fetch_failures_total",
+		Help:      "Number of failed source fetches by repo.",
+	}, []string{"repo"})
+
+	// ExecInvocations counts the invocations of external binaries like terraform, az, kubectl and git.
+	ExecInvocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exec_invocations_total",
+		Help:      "Number of external tool invocations by binary and exit code (-1 when the binary failed to start).",
+	}, []string{"binary", "exit_code"})
+
+	// StepsInError is the number of steps in Error state per Environment.
+	StepsInError = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "steps_in_error",
+		Help:      "Number of steps in Error state by Environment.",
+	}, []string{"namespace", "environment"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		StepExecutions,
+		StepDuration,
+		TerraformResources,
+		BudgetRejections,
+		SourceFetchDuration,
+		SourceFetchFailures,
+		ExecInvocations,
+		StepsInError,
+	)
+}
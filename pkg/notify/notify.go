@@ -0,0 +1,176 @@
+// Package notify sends notifications of step state changes to sinks like webhooks, Slack and Microsoft Teams.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/util/backoff"
+	"sync"
+	"time"
+)
+
+// Event is a step state change.
+type Event struct {
+	// Namespace and Environment identify the Environment.
+	Namespace   string `json:"namespace"`
+	Environment string `json:"environment"`
+	// Step is the short name of the step, for example Infra or AKSPoolcpe.
+	Step string `json:"step"`
+	// Type is the step type, for example Infra or AKSPool.
+	Type string `json:"type"`
+	// State is the new state, PreviousState is the state before the change.
+	State         v1.StepState `json:"state"`
+	PreviousState v1.StepState `json:"previousState,omitempty"`
+	// Message explains the state.
+	Message string `json:"message"`
+	// Time of the state change.
+	Time time.Time `json:"time"`
+}
+
+// Title returns a one line summary of e.
+func (e Event) Title() string {
+	return fmt.Sprintf("%s/%s %s %s", e.Namespace, e.Environment, e.Step, e.State)
+}
+
+// Sink delivers events.
+type Sink interface {
+	// Send delivers e.
+	Send(ctx context.Context, e Event) error
+}
+
+// Filter selects the events that are sent to a sink.
+type Filter struct {
+	// Steps are the step types to select, empty selects all.
+	Steps []string
+	// States are the states to select, empty selects all.
+	States []v1.StepState
+}
+
+// Match returns true when e is selected by f.
+func (f Filter) Match(e Event) bool {
+	if len(f.Steps) > 0 && !contains(f.Steps, e.Type) {
+		return false
+	}
+	if len(f.States) == 0 {
+		return true
+	}
+	for _, s := range f.States {
+		if s == e.State {
+			return true
+		}
+	}
+	return false
+}
+
+// Target is a sink with the filter that selects the events for it.
+type Target struct {
+	Sink   Sink
+	Filter Filter
+}
+
+// TargetFromSpec returns the Target specified by spec.
+// References to vault values in spec are expected to be resolved.
+func TargetFromSpec(spec v1.NotificationSpec) (Target, error) {
+	t := Target{Filter: Filter{Steps: spec.Steps, States: spec.States}}
+	if spec.URL == "" {
+		return t, fmt.Errorf("notification %s: url is required", spec.Type)
+	}
+	switch spec.Type {
+	case v1.NotificationWebhook:
+		t.Sink = &Webhook{URL: spec.URL, Secret: spec.Secret}
+	case v1.NotificationSlack:
+		t.Sink = &Slack{URL: spec.URL}
+	case v1.NotificationTeams:
+		t.Sink = &Teams{URL: spec.URL}
+	default:
+		return t, fmt.Errorf("notification: unknown type: %q", spec.Type)
+	}
+	return t, nil
+}
+
+// Notifier sends events to the targets of the operator and the targets of the Environment the event belongs to.
+// Events are sent in the background, failed sends are retried with an exponential backoff.
+// The order in which events are delivered is not guaranteed.
+type Notifier struct {
+	// Targets receive the events of all Environments.
+	Targets []Target
+	// Retries is the number of times a failed send is retried.
+	Retries int
+	// Log is used to report sends that failed after all retries.
+	Log logr.Logger
+
+	mu sync.Mutex
+	// EnvTargets are the targets per Environment (namespace/name).
+	envTargets map[string][]Target
+	// WG tracks the sends in progress.
+	wg sync.WaitGroup
+}
+
+// SetTargets sets the targets of the Environment namespace/name.
+func (n *Notifier) SetTargets(namespace, name string, targets []Target) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.envTargets == nil {
+		n.envTargets = make(map[string][]Target)
+	}
+	k := namespace + "/" + name
+	if len(targets) == 0 {
+		delete(n.envTargets, k)
+		return
+	}
+	n.envTargets[k] = targets
+}
+
+// Notify sends e to the targets with a filter that matches e.
+func (n *Notifier) Notify(e Event) {
+	n.mu.Lock()
+	targets := append(append([]Target(nil), n.Targets...), n.envTargets[e.Namespace+"/"+e.Environment]...)
+	n.mu.Unlock()
+
+	for _, t := range targets {
+		if !t.Filter.Match(e) {
+			continue
+		}
+		n.wg.Add(1)
+		go func(s Sink) {
+			defer n.wg.Done()
+			n.send(s, e)
+		}(t.Sink)
+	}
+}
+
+// Wait blocks until all sends in progress have completed.
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+// Send sends e to s and retries when sending fails.
+func (n *Notifier) send(s Sink, e Event) {
+	for exp := backoff.NewExponential(time.Minute); ; exp.Sleep() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := s.Send(ctx, e)
+		cancel()
+		if err == nil {
+			return
+		}
+		if exp.Retries() >= n.Retries {
+			if n.Log != nil {
+				n.Log.Error(err, "notify", "event", e.Title(), "retries", exp.Retries())
+			}
+			return
+		}
+	}
+}
+
+// Contains returns true when s is in list.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/util/backoff"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+// FakeSink records the events it receives, the first fails events fail.
+type fakeSink struct {
+	mu     sync.Mutex
+	fails  int
+	sends  int
+	events []Event
+}
+
+func (f *fakeSink) Send(_ context.Context, e Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sends++
+	if f.sends <= f.fails {
+		return errors.New("unavailable")
+	}
+	f.events = append(f.events, e)
+	return nil
+}
+
+func TestFilter_Match(t *testing.T) {
+	tests := []struct {
+		it     string
+		filter Filter
+		event  Event
+		want   bool
+	}{
+		{
+			it:    "should match all events with an empty filter",
+			event: Event{Type: "Infra", State: v1.StateRunning},
+			want:  true,
+		},
+		{
+			it:     "should match on step type",
+			filter: Filter{Steps: []string{"AKSPool"}},
+			event:  Event{Step: "AKSPoolcpe", Type: "AKSPool", State: v1.StateReady},
+			want:   true,
+		},
+		{
+			it:     "should not match other step types",
+			filter: Filter{Steps: []string{"AKSPool"}},
+			event:  Event{Step: "Infra", Type: "Infra", State: v1.StateReady},
+			want:   false,
+		},
+		{
+			it:     "should match on state",
+			filter: Filter{Steps: []string{"Infra"}, States: []v1.StepState{v1.StateError, v1.StateAwaitingApproval}},
+			event:  Event{Type: "Infra", State: v1.StateAwaitingApproval},
+			want:   true,
+		},
+		{
+			it:     "should not match other states",
+			filter: Filter{States: []v1.StepState{v1.StateError}},
+			event:  Event{Type: "Infra", State: v1.StateReady},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(tt.event))
+		})
+	}
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	backoff.FF = true
+	defer func() { backoff.FF = false }()
+
+	operator := &fakeSink{}
+	flaky := &fakeSink{fails: 2}
+	broken := &fakeSink{fails: 100}
+	other := &fakeSink{}
+
+	n := &Notifier{
+		Targets: []Target{{Sink: operator, Filter: Filter{States: []v1.StepState{v1.StateError}}}},
+		Retries: 3,
+	}
+	n.SetTargets("default", "env1", []Target{{Sink: flaky}, {Sink: broken}})
+	n.SetTargets("default", "env2", []Target{{Sink: other}})
+
+	n.Notify(Event{Namespace: "default", Environment: "env1", Step: "Infra", Type: "Infra", State: v1.StateError})
+	n.Notify(Event{Namespace: "default", Environment: "env1", Step: "Infra", Type: "Infra", State: v1.StateRunning})
+	n.Wait()
+
+	assert.Len(t, operator.events, 1, "operator target should receive the events of all Environments that match its filter")
+	assert.Len(t, flaky.events, 2, "should retry failed sends")
+	assert.Equal(t, 8, broken.sends, "should give up after Retries")
+	assert.Len(t, other.events, 0, "should not receive events of other Environments")
+
+	n.SetTargets("default", "env1", nil)
+	n.Notify(Event{Namespace: "default", Environment: "env1", Step: "Infra", Type: "Infra", State: v1.StateReady})
+	n.Wait()
+	assert.Len(t, flaky.events, 2, "should not send to removed targets")
+}
+
+func TestTargetFromSpec(t *testing.T) {
+	tests := []struct {
+		it      string
+		spec    v1.NotificationSpec
+		want    Sink
+		wantErr string
+	}{
+		{
+			it:   "should create a webhook",
+			spec: v1.NotificationSpec{Type: v1.NotificationWebhook, URL: "https://example.com/hook", Secret: "s3cr3t"},
+			want: &Webhook{URL: "https://example.com/hook", Secret: "s3cr3t"},
+		},
+		{
+			it:   "should create a teams sink",
+			spec: v1.NotificationSpec{Type: v1.NotificationTeams, URL: "https://example.com/hook"},
+			want: &Teams{URL: "https://example.com/hook"},
+		},
+		{
+			it:      "should require an url",
+			spec:    v1.NotificationSpec{Type: v1.NotificationSlack},
+			wantErr: "notification slack: url is required",
+		},
+		{
+			it:      "should error on unknown types",
+			spec:    v1.NotificationSpec{Type: "pager", URL: "https://example.com/hook"},
+			wantErr: `notification: unknown type: "pager"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := TargetFromSpec(tt.spec)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Sink)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the HTTP header with the HMAC-SHA256 signature of a Webhook payload.
+const SignatureHeader = "X-Envop-Signature"
+
+// Webhook posts events as JSON to a generic webhook.
+type Webhook struct {
+	// URL of the webhook.
+	URL string
+	// Secret (optional) is the key to sign the payload with, see SignatureHeader.
+	Secret string
+	// Client is the HTTP client to use, nil uses http.DefaultClient.
+	Client *http.Client
+}
+
+var _ Sink = &Webhook{}
+
+// Send implements Sink.
+func (w *Webhook) Send(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	h := http.Header{}
+	if w.Secret != "" {
+		h.Set(SignatureHeader, "sha256="+Sign(w.Secret, b))
+	}
+	return post(ctx, w.Client, w.URL, h, b)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of payload using secret as key.
+func Sign(secret string, payload []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(payload)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Slack posts events as a message to a Slack compatible incoming webhook.
+type Slack struct {
+	// URL of the incoming webhook.
+	URL string
+	// Client is the HTTP client to use, nil uses http.DefaultClient.
+	Client *http.Client
+}
+
+var _ Sink = &Slack{}
+
+// Send implements Sink.
+func (s *Slack) Send(ctx context.Context, e Event) error {
+	b, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf("%s %s: %s", stateEmoji(e.State), e.Title(), e.Message),
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.URL, nil, b)
+}
+
+// Teams posts events as a message card to a Microsoft Teams incoming webhook.
+type Teams struct {
+	// URL of the incoming webhook.
+	URL string
+	// Client is the HTTP client to use, nil uses http.DefaultClient.
+	Client *http.Client
+}
+
+var _ Sink = &Teams{}
+
+// Send implements Sink.
+func (t *Teams) Send(ctx context.Context, e Event) error {
+	type fact struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	card := struct {
+		Type       string `json:"@type"`
+		Context    string `json:"@context"`
+		ThemeColor string `json:"themeColor"`
+		Summary    string `json:"summary"`
+		Title      string `json:"title"`
+		Text       string `json:"text"`
+		Sections   []struct {
+			Facts []fact `json:"facts"`
+		} `json:"sections"`
+	}{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		ThemeColor: stateColor(e.State),
+		Summary:    e.Title(),
+		Title:      e.Title(),
+		Text:       e.Message,
+	}
+	card.Sections = append(card.Sections, struct {
+		Facts []fact `json:"facts"`
+	}{Facts: []fact{
+		{Name: "Environment", Value: e.Namespace + "/" + e.Environment},
+		{Name: "Step", Value: e.Step},
+		{Name: "State", Value: string(e.State)},
+		{Name: "Time", Value: e.Time.UTC().Format(time.RFC3339)},
+	}})
+
+	b, err := json.Marshal(card)
+	if err != nil {
+		return err
+	}
+	return post(ctx, t.Client, t.URL, nil, b)
+}
+
+// Post sends a JSON payload to u and returns an error when the response status is not 2xx.
+// The url is omitted from errors because webhook URLs often contain a token.
+func post(ctx context.Context, cl *http.Client, u string, header http.Header, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("webhook request: invalid url")
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if cl == nil {
+		cl = http.DefaultClient
+	}
+	resp, err := cl.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", req.URL.Host, unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook %s: %s %s", req.URL.Host, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// UnwrapURLError returns the error wrapped by an *url.Error so the URL isn't part of the error message.
+func unwrapURLError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		return fmt.Errorf("%s: %w", ue.Op, ue.Err)
+	}
+	return err
+}
+
+// StateEmoji returns a Slack emoji for state.
+func stateEmoji(state v1.StepState) string {
+	switch state {
+	case v1.StateReady:
+		return ":white_check_mark:"
+	case v1.StateError:
+		return ":x:"
+	case v1.StateAwaitingApproval:
+		return ":raised_hand:"
+	}
+	return ":arrows_counterclockwise:"
+}
+
+// StateColor returns a Teams theme color for state.
+func stateColor(state v1.StepState) string {
+	switch state {
+	case v1.StateReady:
+		return "2EB886"
+	case v1.StateError:
+		return "D40E0D"
+	case v1.StateAwaitingApproval:
+		return "FFC107"
+	}
+	return "0078D7"
+}
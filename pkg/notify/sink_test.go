@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Request is a request received by the test server.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// TestServer returns a server that records the requests it receives and responds with status.
+func testServer(t *testing.T, status int) (*httptest.Server, *[]request) {
+	var reqs []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs = append(reqs, request{header: r.Header, body: b})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &reqs
+}
+
+var testEvent = Event{
+	Namespace:   "default",
+	Environment: "env1",
+	Step:        "Infra",
+	Type:        "Infra",
+	State:       v1.StateError,
+	Message:     "plan limits exceeded",
+	Time:        time.Date(2021, 6, 3, 10, 11, 12, 0, time.UTC),
+}
+
+func TestWebhook_Send(t *testing.T) {
+	srv, reqs := testServer(t, http.StatusOK)
+
+	err := (&Webhook{URL: srv.URL, Secret: "s3cr3t"}).Send(context.Background(), testEvent)
+	assert.NoError(t, err)
+	if !assert.Len(t, *reqs, 1) {
+		return
+	}
+	r := (*reqs)[0]
+	var got Event
+	assert.NoError(t, json.Unmarshal(r.body, &got))
+	assert.Equal(t, testEvent, got)
+	assert.Equal(t, "sha256="+Sign("s3cr3t", r.body), r.header.Get(SignatureHeader))
+	assert.Equal(t, "application/json", r.header.Get("Content-Type"))
+}
+
+func TestSlack_Send(t *testing.T) {
+	srv, reqs := testServer(t, http.StatusOK)
+
+	err := (&Slack{URL: srv.URL}).Send(context.Background(), testEvent)
+	assert.NoError(t, err)
+	if assert.Len(t, *reqs, 1) {
+		assert.JSONEq(t, `{"text":":x: default/env1 Infra Error: plan limits exceeded"}`, string((*reqs)[0].body))
+		assert.Empty(t, (*reqs)[0].header.Get(SignatureHeader))
+	}
+}
+
+func TestTeams_Send(t *testing.T) {
+	srv, reqs := testServer(t, http.StatusOK)
+
+	err := (&Teams{URL: srv.URL}).Send(context.Background(), testEvent)
+	assert.NoError(t, err)
+	if !assert.Len(t, *reqs, 1) {
+		return
+	}
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal((*reqs)[0].body, &got))
+	assert.Equal(t, "MessageCard", got["@type"])
+	assert.Equal(t, "default/env1 Infra Error", got["title"])
+	assert.Equal(t, "D40E0D", got["themeColor"])
+}
+
+func TestSend_errors(t *testing.T) {
+	srv, _ := testServer(t, http.StatusForbidden)
+
+	err := (&Slack{URL: srv.URL + "/services/T0/B0/t0k3n"}).Send(context.Background(), testEvent)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "403")
+		assert.NotContains(t, err.Error(), "t0k3n", "error should not contain the url path")
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/mmlt/environment-operator/pkg/step"
 	"k8s.io/apimachinery/pkg/types"
 	"path/filepath"
+	"sort"
 	"strconv"
 )
 
@@ -51,12 +52,58 @@ type Sourcer interface {
 	Workspace(nsn types.NamespacedName, name string) (source.Workspace, bool)
 }
 
-// Plan returns an ordered collection of steps.
+// Graph is a plan expressed as steps and the dependencies between them.
+type Graph struct {
+	// Steps are the steps to perform in a valid execution order.
+	Steps []step.Step
+	// DependsOn maps a step short name to the short names of the steps that must be completed before it can run.
+	DependsOn map[string][]string
+}
+
+// NewGraph returns a Graph for steps.
+// Infra steps depend on the infra steps before them.
+// Cluster steps depend on the last infra step and on the previous step of the same cluster.
+// Steps of different clusters don't depend on each other and can be run in parallel.
+func NewGraph(steps []step.Step) Graph {
+	r := Graph{
+		Steps:     steps,
+		DependsOn: make(map[string][]string, len(steps)),
+	}
+
+	var lastInfra string
+	lastOfCluster := make(map[string]string)
+	for _, stp := range steps {
+		id := stp.GetID()
+		n := id.ShortName()
+
+		var deps []string
+		if lastInfra != "" {
+			deps = append(deps, lastInfra)
+		}
+
+		if id.ClusterName == "" {
+			lastInfra = n
+		} else {
+			if prev, ok := lastOfCluster[id.ClusterName]; ok {
+				deps = append(deps, prev)
+			}
+			lastOfCluster[id.ClusterName] = n
+		}
+
+		r.DependsOn[n] = deps
+	}
+
+	return r
+}
+
+// Plan returns a graph of steps.
 // The step hash field reflects the current source/parameters for that step.
-func (p *Planner) Plan(nsn types.NamespacedName, src Sourcer, destroy bool, ispec v1.InfraSpec, cspec []v1.ClusterSpec) ([]step.Step, error) {
-	pl, ok := p.buildPlan(nsn, src, destroy, ispec, cspec)
+// The cluster steps are ordered by rollout wave.
+// An empty graph is returned when not all prerequisites are fulfilled.
+func (p *Planner) Plan(nsn types.NamespacedName, src Sourcer, destroy bool, ispec v1.InfraSpec, cspec []v1.ClusterSpec, rollout v1.RolloutSpec) (Graph, error) {
+	pl, ok := p.buildPlan(nsn, src, destroy, ispec, cspec, rollout)
 	if !ok {
-		return nil, nil
+		return Graph{}, nil
 	}
 
 	if p.currentPlans == nil {
@@ -64,7 +111,7 @@ func (p *Planner) Plan(nsn types.NamespacedName, src Sourcer, destroy bool, ispe
 	}
 	p.currentPlans[nsn] = pl
 
-	return pl, nil
+	return NewGraph(pl), nil
 }
 
 // PossibleSteps returns a set of possible step names.
@@ -99,7 +146,7 @@ func (p *Planner) PossibleSteps(cspec []v1.ClusterSpec) map[string]struct{} {
 // BuildPlan builds a plan containing the steps to create/update/delete a target environment.
 // An environment is identified by nsn.
 // Returns false if not all prerequisites are fulfilled.
-func (p *Planner) buildPlan(nsn types.NamespacedName, src Sourcer, destroy bool, ispec v1.InfraSpec, cspec []v1.ClusterSpec) (plan, bool) {
+func (p *Planner) buildPlan(nsn types.NamespacedName, src Sourcer, destroy bool, ispec v1.InfraSpec, cspec []v1.ClusterSpec, rollout v1.RolloutSpec) (plan, bool) {
 	var pl plan
 	var ok bool
 	switch {
@@ -107,7 +154,7 @@ func (p *Planner) buildPlan(nsn types.NamespacedName, src Sourcer, destroy bool,
 		pl, ok = p.buildDestroyPlan(nsn, src, ispec, cspec)
 
 	default:
-		pl, ok = p.buildCreatePlan(nsn, src, ispec, cspec, p.Client)
+		pl, ok = p.buildCreatePlan(nsn, src, ispec, cspec, rollout, p.Client)
 	}
 	if !ok {
 		return nil, false
@@ -130,7 +177,7 @@ func (p *Planner) buildDestroyPlan(nsn types.NamespacedName, src Sourcer, ispec
 	pl := make(plan, 0, 1)
 	pl = append(pl,
 		&step.DestroyStep{
-			Metaa: stepMeta(nsn, "", step.TypeDestroy, h),
+			Metaa: stepMeta(nsn, "", step.TypeDestroy, h, p.hashInputs("source", tfw.Hash)),
 			Values: step.InfraValues{
 				Infra:    ispec,
 				Clusters: cspec,
@@ -145,8 +192,9 @@ func (p *Planner) buildDestroyPlan(nsn types.NamespacedName, src Sourcer, ispec
 }
 
 // BuildCreatePlan builds a plan to create or update a target environment.
+// The cluster steps are ordered by rollout wave.
 // Returns false if workspaces are not prepped with sources.
-func (p *Planner) buildCreatePlan(nsn types.NamespacedName, src Sourcer, ispec v1.InfraSpec, cspec []v1.ClusterSpec, client cluster.Client) (plan, bool) {
+func (p *Planner) buildCreatePlan(nsn types.NamespacedName, src Sourcer, ispec v1.InfraSpec, cspec []v1.ClusterSpec, rollout v1.RolloutSpec, client cluster.Client) (plan, bool) {
 	tfw, ok := src.Workspace(nsn, "")
 	if !ok || !tfw.Synced {
 		return nil, false
@@ -158,21 +206,23 @@ func (p *Planner) buildCreatePlan(nsn types.NamespacedName, src Sourcer, ispec v
 		cspecInfra = append(cspecInfra, s.Infra)
 	}
 	h := p.hash(tfw.Hash, ispec, cspecInfra)
+	hi := p.hashInputs("source", tfw.Hash, "infra", ispec, "clusters.infra", cspecInfra)
 
 	pl := make(plan, 0, 1+4*len(cspec))
 	pl = append(pl,
 		&step.InfraStep{
-			Metaa: stepMeta(nsn, "", step.TypeInfra, h),
+			Metaa: stepMeta(nsn, "", step.TypeInfra, h, hi),
 			Values: step.InfraValues{
 				Infra:    ispec,
 				Clusters: cspec,
 			},
-			SourcePath: tfPath,
-			Cloud:      p.Cloud,
-			Azure:      p.Azure,
-			Terraform:  p.Terraform,
-			Client:     client,
-			Kubectl:    p.Kubectl,
+			SourcePath:    tfPath,
+			WorkspacePath: tfw.Path,
+			Cloud:         p.Cloud,
+			Azure:         p.Azure,
+			Terraform:     p.Terraform,
+			Client:        client,
+			Kubectl:       p.Kubectl,
 			KubeconfigPathFn: func(n string) (string, error) {
 				cw, ok := src.Workspace(nsn, n)
 				if !ok {
@@ -182,7 +232,7 @@ func (p *Planner) buildCreatePlan(nsn types.NamespacedName, src Sourcer, ispec v
 			},
 		})
 
-	for _, cl := range cspec {
+	for _, cl := range orderedByWave(cspec, rollout) {
 		cw, ok := src.Workspace(nsn, cl.Name)
 		if !ok || cw.Hash == "" {
 			return nil, false
@@ -195,19 +245,23 @@ func (p *Planner) buildCreatePlan(nsn types.NamespacedName, src Sourcer, ispec v
 		az.SetSubscription(ispec.AZ.Subscription[0].Name) // already validated
 		pl = append(pl,
 			&step.AKSPoolStep{
-				Metaa:         stepMeta(nsn, cl.Name, step.TypeAKSPool, p.hash(tfw.Hash, ispec.AZ.ResourceGroup, cl.Infra.Version)),
+				Metaa: stepMeta(nsn, cl.Name, step.TypeAKSPool,
+					p.hash(tfw.Hash, ispec.AZ.ResourceGroup, cl.Infra.Version),
+					p.hashInputs("source", tfw.Hash, "infra.az.resourceGroup", ispec.AZ.ResourceGroup, "cluster.infra.version", cl.Infra.Version)),
 				ResourceGroup: ispec.AZ.ResourceGroup,
 				Cluster:       prefixedClusterName("aks", ispec.EnvName, cl.Name),
 				Version:       cl.Infra.Version,
 				Azure:         az,
 			},
 			&step.AKSAddonPreflightStep{
-				Metaa:   stepMeta(nsn, cl.Name, step.TypeAKSAddonPreflight, h),
+				Metaa:   stepMeta(nsn, cl.Name, step.TypeAKSAddonPreflight, h, hi),
 				KCPath:  kcPath,
 				Kubectl: p.Kubectl,
 			},
 			&step.AddonStep{
-				Metaa:           stepMeta(nsn, cl.Name, step.TypeAddons, p.hash(cw.Hash, cl.Addons.Jobs, cl.Addons.X)),
+				Metaa: stepMeta(nsn, cl.Name, step.TypeAddons,
+					p.hash(cw.Hash, cl.Addons.Jobs, cl.Addons.X),
+					p.hashInputs("source", cw.Hash, "cluster.addons.jobs", cl.Addons.Jobs, "cluster.addons.x", cl.Addons.X)),
 				SourcePath:      cw.Path,
 				KCPath:          kcPath,
 				MasterVaultPath: mvPath,
@@ -218,11 +272,50 @@ func (p *Planner) buildCreatePlan(nsn types.NamespacedName, src Sourcer, ispec v
 		)
 	}
 
+	if ispec.Drift.Interval.Duration > 0 {
+		// the controller makes the drift step run periodically.
+		pl = append(pl,
+			&step.DriftStep{
+				Metaa: stepMeta(nsn, "", step.TypeDrift, p.hash(h), p.hashInputs("Infra", h)),
+				Values: step.InfraValues{
+					Infra:    ispec,
+					Clusters: cspec,
+				},
+				SourcePath: tfPath,
+				Cloud:      p.Cloud,
+				Terraform:  p.Terraform,
+			})
+	}
+
 	return pl, true
 }
 
+// ClusterWave returns the index of the rollout wave that contains the named cluster.
+// Clusters that are not in a wave are in the implicit last wave with index len(rollout.Waves).
+func ClusterWave(rollout v1.RolloutSpec, clusterName string) int {
+	for i, w := range rollout.Waves {
+		for _, n := range w.Clusters {
+			if n == clusterName {
+				return i
+			}
+		}
+	}
+	return len(rollout.Waves)
+}
+
+// OrderedByWave returns cspec ordered by rollout wave.
+// The order of the clusters within a wave is kept.
+func orderedByWave(cspec []v1.ClusterSpec, rollout v1.RolloutSpec) []v1.ClusterSpec {
+	r := make([]v1.ClusterSpec, len(cspec))
+	copy(r, cspec)
+	sort.SliceStable(r, func(i, j int) bool {
+		return ClusterWave(rollout, r[i].Name) < ClusterWave(rollout, r[j].Name)
+	})
+	return r
+}
+
 // StepMeta is sugar for creating a step.Metaa struct.
-func stepMeta(nsn types.NamespacedName, clusterName string, typ step.Type, hash string) step.Metaa {
+func stepMeta(nsn types.NamespacedName, clusterName string, typ step.Type, hash string, hashInputs map[string]string) step.Metaa {
 	return step.Metaa{
 		ID: step.ID{
 			Type:        typ,
@@ -230,7 +323,8 @@ func stepMeta(nsn types.NamespacedName, clusterName string, typ step.Type, hash
 			Name:        nsn.Name,
 			ClusterName: clusterName,
 		},
-		Hash: hash,
+		Hash:       hash,
+		HashInputs: hashInputs,
 	}
 }
 
@@ -245,6 +339,17 @@ func (p *Planner) hash(args ...interface{}) string {
 	return strconv.FormatUint(i, 16)
 }
 
+// HashInputs returns the hashes of the inputs of a step hash.
+// Args are name, value pairs, for example hashInputs("source", src, "cluster.addons.x", x).
+// Names are spec paths (cluster relative for cluster steps), "source" for the source hash or the name of a step.
+func (p *Planner) hashInputs(args ...interface{}) map[string]string {
+	r := make(map[string]string, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		r[fmt.Sprint(args[i])] = p.hash(args[i+1])
+	}
+	return r
+}
+
 // PrefixedClusterName returns the name as it's used in Azure.
 // NB. the same algo is in terraform
 func prefixedClusterName(resource, env, name string) string {
@@ -12,6 +12,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_planFilter(t *testing.T) {
@@ -22,10 +23,10 @@ func Test_planFilter(t *testing.T) {
 
 	planInfraDestroy := plan{
 		&step.InfraStep{
-			Metaa: stepMeta(nsn, "", step.TypeInfra, ""),
+			Metaa: stepMeta(nsn, "", step.TypeInfra, "", nil),
 		},
 		&step.DestroyStep{
-			Metaa: stepMeta(nsn, "", step.TypeDestroy, ""),
+			Metaa: stepMeta(nsn, "", step.TypeDestroy, "", nil),
 		},
 	}
 
@@ -64,7 +65,7 @@ func Test_planFilter(t *testing.T) {
 			},
 			want: plan{
 				&step.DestroyStep{
-					Metaa: stepMeta(nsn, "", step.TypeDestroy, ""),
+					Metaa: stepMeta(nsn, "", step.TypeDestroy, "", nil),
 				},
 			},
 		},
@@ -77,6 +78,112 @@ func Test_planFilter(t *testing.T) {
 	}
 }
 
+func TestNewGraph(t *testing.T) {
+	nsn := metav1.NamespacedName{
+		Namespace: "default",
+		Name:      "test",
+	}
+
+	tests := []struct {
+		it    string
+		steps []step.Step
+		want  map[string][]string
+	}{
+		{
+			it:   "should return an empty graph when there are no steps",
+			want: map[string][]string{},
+		},
+		{
+			it: "should have no dependencies for a single infra step",
+			steps: []step.Step{
+				&step.DestroyStep{Metaa: stepMeta(nsn, "", step.TypeDestroy, "", nil)},
+			},
+			want: map[string][]string{
+				"Destroy": nil,
+			},
+		},
+		{
+			it: "should chain the steps of a cluster and make them depend on infra",
+			steps: []step.Step{
+				&step.InfraStep{Metaa: stepMeta(nsn, "", step.TypeInfra, "", nil)},
+				&step.AKSPoolStep{Metaa: stepMeta(nsn, "a", step.TypeAKSPool, "", nil)},
+				&step.AKSAddonPreflightStep{Metaa: stepMeta(nsn, "a", step.TypeAKSAddonPreflight, "", nil)},
+				&step.AddonStep{Metaa: stepMeta(nsn, "a", step.TypeAddons, "", nil)},
+				&step.AKSPoolStep{Metaa: stepMeta(nsn, "b", step.TypeAKSPool, "", nil)},
+				&step.AKSAddonPreflightStep{Metaa: stepMeta(nsn, "b", step.TypeAKSAddonPreflight, "", nil)},
+				&step.AddonStep{Metaa: stepMeta(nsn, "b", step.TypeAddons, "", nil)},
+			},
+			want: map[string][]string{
+				"Infra":              nil,
+				"AKSPoola":           {"Infra"},
+				"AKSAddonPreflighta": {"Infra", "AKSPoola"},
+				"Addonsa":            {"Infra", "AKSAddonPreflighta"},
+				"AKSPoolb":           {"Infra"},
+				"AKSAddonPreflightb": {"Infra", "AKSPoolb"},
+				"Addonsb":            {"Infra", "AKSAddonPreflightb"},
+			},
+		},
+		{
+			it: "should not depend on steps that are filtered out",
+			steps: []step.Step{
+				&step.AddonStep{Metaa: stepMeta(nsn, "a", step.TypeAddons, "", nil)},
+				&step.AddonStep{Metaa: stepMeta(nsn, "b", step.TypeAddons, "", nil)},
+			},
+			want: map[string][]string{
+				"Addonsa": nil,
+				"Addonsb": nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got := NewGraph(tt.steps)
+			assert.Equal(t, tt.steps, got.Steps)
+			assert.Equal(t, tt.want, got.DependsOn)
+		})
+	}
+}
+
+func Test_orderedByWave(t *testing.T) {
+	clusters := func(names ...string) []v1.ClusterSpec {
+		var r []v1.ClusterSpec
+		for _, n := range names {
+			r = append(r, v1.ClusterSpec{Name: n})
+		}
+		return r
+	}
+
+	tests := []struct {
+		it      string
+		cspec   []v1.ClusterSpec
+		rollout v1.RolloutSpec
+		want    []v1.ClusterSpec
+	}{
+		{
+			it:    "should keep the order when there are no waves",
+			cspec: clusters("a", "b", "c"),
+			want:  clusters("a", "b", "c"),
+		},
+		{
+			it:    "should order clusters by wave and put clusters without a wave last",
+			cspec: clusters("a", "b", "canary", "c", "d"),
+			rollout: v1.RolloutSpec{
+				Waves: []v1.RolloutWave{
+					{Name: "canary", Clusters: []string{"canary"}},
+					{Name: "second", Clusters: []string{"d", "b"}},
+				},
+			},
+			want: clusters("canary", "b", "d", "a", "c"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got := orderedByWave(tt.cspec, tt.rollout)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 // TestPlanner_Plan_ignore_parameters asserts the planner returns the correct steps based on step.Metaa.
 // It doesn't not assert the step specific parameters are correctly set.
 func TestPlanner_Plan_ignore_parameters(t *testing.T) {
@@ -245,16 +352,18 @@ func TestPlanner_Plan_ignore_parameters(t *testing.T) {
 
 				Log: l,
 			}
-			got, err := p.Plan(tt.args.nsn, tt.args.src, tt.args.destroy, tt.args.ispec, tt.args.cspec)
+			got, err := p.Plan(tt.args.nsn, tt.args.src, tt.args.destroy, tt.args.ispec, tt.args.cspec, v1.RolloutSpec{})
 
 			// collect metaa struct refs
 			var gotmeta []*step.Metaa
-			for _, st := range got {
+			for _, st := range got.Steps {
 				v := reflect.ValueOf(st).Elem()
 				for i := 0; i < v.NumField(); i++ {
 					n := v.Type().Field(i).Name
 					if n == "Metaa" {
 						m := v.Field(i).Addr().Interface().(*step.Metaa)
+						// hash inputs are checked by TestPlanner_Plan_step_hash
+						m.HashInputs = nil
 						gotmeta = append(gotmeta, m)
 						break
 					}
@@ -279,20 +388,24 @@ func TestPlanner_Plan_step_hash(t *testing.T) {
 		mutateISpec func(*v1.InfraSpec)
 		mutateCSpec func(*[]v1.ClusterSpec)
 		want        []string
+		// wantInputs are the names of the changed hash inputs of the steps in want that exist in both plans.
+		wantInputs map[string][]string
 	}{
 		{
 			id: "ispec change triggers Infra step",
 			mutateISpec: func(ispec *v1.InfraSpec) {
 				ispec.EnvDomain = "xxx"
 			},
-			want: []string{"Infra", "AKSAddonPreflightxyz"},
+			want:       []string{"Infra", "AKSAddonPreflightxyz"},
+			wantInputs: map[string][]string{"Infra": {"infra"}, "AKSAddonPreflightxyz": {"infra"}},
 		},
 		{
 			id: "add pool to cluster triggers Infra step",
 			mutateCSpec: func(cspec *[]v1.ClusterSpec) {
 				(*cspec)[0].Infra.Pools["new"] = (*cspec)[0].Infra.Pools["default"]
 			},
-			want: []string{"Infra", "AKSAddonPreflightxyz"},
+			want:       []string{"Infra", "AKSAddonPreflightxyz"},
+			wantInputs: map[string][]string{"Infra": {"clusters.infra"}, "AKSAddonPreflightxyz": {"clusters.infra"}},
 		},
 		{
 			id: "add 2nd cluster triggers Infra step",
@@ -301,14 +414,16 @@ func TestPlanner_Plan_step_hash(t *testing.T) {
 				cl.Name = "new"
 				*cspec = append(*cspec, cl)
 			},
-			want: []string{"Infra", "AKSAddonPreflightxyz", "AKSPoolnew", "AKSAddonPreflightnew", "Addonsnew"},
+			want:       []string{"Infra", "AKSAddonPreflightxyz", "AKSPoolnew", "AKSAddonPreflightnew", "Addonsnew"},
+			wantInputs: map[string][]string{"Infra": {"clusters.infra"}, "AKSAddonPreflightxyz": {"clusters.infra"}},
 		},
 		{
 			id: "cspec Addons change trigger Addons step",
 			mutateCSpec: func(cspec *[]v1.ClusterSpec) {
 				(*cspec)[0].Addons.X["key"] = "values"
 			},
-			want: []string{"Addonsxyz"},
+			want:       []string{"Addonsxyz"},
+			wantInputs: map[string][]string{"Addonsxyz": {"cluster.addons.x"}},
 		},
 	}
 
@@ -337,7 +452,7 @@ func TestPlanner_Plan_step_hash(t *testing.T) {
 			ispec := infraSpec("does/not/matter")
 			cspec := clusterSpec("does/not/matter/either")
 
-			p1, err := p.Plan(nsn, src, false, ispec, cspec)
+			p1, err := p.Plan(nsn, src, false, ispec, cspec, v1.RolloutSpec{})
 			assert.NoError(t, err)
 
 			if tt.mutateISpec != nil {
@@ -347,13 +462,14 @@ func TestPlanner_Plan_step_hash(t *testing.T) {
 				tt.mutateCSpec(&cspec)
 			}
 
-			p2, err := p.Plan(nsn, src, false, ispec, cspec)
+			p2, err := p.Plan(nsn, src, false, ispec, cspec, v1.RolloutSpec{})
 			assert.NoError(t, err)
 
 			// compare the step hashes of both plans and collect the names of the steps that have changed.
-			pm1 := planAsMap(p1)
+			pm1 := planAsMap(p1.Steps)
 			var changed []string
-			for _, s2 := range p2 {
+			changedInputs := map[string][]string{}
+			for _, s2 := range p2.Steps {
 				n := s2.GetID().ShortName()
 				s1, ok := pm1[n]
 				if !ok {
@@ -364,9 +480,15 @@ func TestPlanner_Plan_step_hash(t *testing.T) {
 				if s1.GetHash() != s2.GetHash() {
 					changed = append(changed, n)
 				}
+				for k, v := range s2.GetHashInputs() {
+					if s1.GetHashInputs()[k] != v {
+						changedInputs[n] = append(changedInputs[n], k)
+					}
+				}
 			}
 
 			assert.Equal(t, tt.want, changed)
+			assert.Equal(t, tt.wantInputs, changedInputs)
 		})
 	}
 }
@@ -449,3 +571,47 @@ func planAsMap(p []step.Step) map[string]step.Step {
 	}
 	return r
 }
+
+// TestPlanner_Plan_drift checks that a Drift step is planned and that its hash only changes with the infra values.
+func TestPlanner_Plan_drift(t *testing.T) {
+	nsn := metav1.NamespacedName{
+		Namespace: "default",
+		Name:      "test",
+	}
+	src := fakeSource{
+		workspace: source.Workspace{
+			Path:   "does/not/matter",
+			Hash:   "9999",
+			Synced: true,
+		},
+	}
+	p := &Planner{
+		Azure: &azure.AZFake{},
+		Log:   stdr.New(log.New(os.Stdout, "", log.Lshortfile|log.Ltime)),
+	}
+
+	ispec := infraSpec("does/not/matter")
+	cspec := clusterSpec("does/not/matter/either")
+
+	// drift is not checked by default.
+	g, err := p.Plan(nsn, src, false, ispec, cspec, v1.RolloutSpec{})
+	assert.NoError(t, err)
+	assert.NotContains(t, planAsMap(g.Steps), "Drift")
+
+	driftHash := func(ispec v1.InfraSpec) string {
+		ispec.Drift.Interval.Duration = time.Hour
+		g, err := p.Plan(nsn, src, false, ispec, cspec, v1.RolloutSpec{})
+		assert.NoError(t, err)
+		if assert.Equal(t, step.TypeDrift, g.Steps[len(g.Steps)-1].GetID().Type, "Drift is the last step") {
+			assert.Equal(t, []string{"Infra"}, g.DependsOn["Drift"])
+		}
+		return g.Steps[len(g.Steps)-1].GetHash()
+	}
+
+	h1 := driftHash(ispec)
+	h2 := driftHash(ispec)
+	assert.Equal(t, h1, h2, "hash should not change over time")
+	ispec.EnvDomain = "other.example.com"
+	h3 := driftHash(ispec)
+	assert.NotEqual(t, h1, h3, "hash should change with the infra values")
+}
@@ -0,0 +1,328 @@
+// Package policy evaluates rules against a terraform JSON plan.
+//
+// Policies are YAML (or JSON) files that are shipped alongside the terraform code, for example:
+//
+//	rules:
+//	- name: no-public-node-ips
+//	  description: nodes must not have a public IP
+//	  match:
+//	    type: azurerm_kubernetes_cluster_node_pool
+//	    actions: [create, update]
+//	  conditions:
+//	  - path: change.after.enable_node_public_ip
+//	    op: equals
+//	    value: true
+//
+// A rule is violated by each resource change in the plan that matches the rule and meets all of its conditions.
+package policy
+
+import (
+	"fmt"
+	"github.com/Jeffail/gabs/v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strings"
+)
+
+// Policy is a set of rules.
+type Policy struct {
+	// Rules that deny resource changes.
+	Rules []Rule `json:"rules"`
+}
+
+// Rule denies the resource changes that match and meet all conditions.
+type Rule struct {
+	// Name identifies the rule.
+	Name string `json:"name"`
+	// Description explains the rule to the reader of a violation.
+	Description string `json:"description,omitempty"`
+	// Match selects the resource changes the rule applies to.
+	Match Match `json:"match,omitempty"`
+	// Conditions must all be true for a matching resource change to violate the rule.
+	// No conditions means all matching resource changes violate the rule.
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// Match selects resource changes.
+// Empty fields match any resource change.
+type Match struct {
+	// Type is a glob pattern for the resource type, for example azurerm_*
+	Type string `json:"type,omitempty"`
+	// Address is a glob pattern for the resource address, for example module.aks1.*
+	Address string `json:"address,omitempty"`
+	// Actions are the actions of which one must equal the resource change action.
+	// Valid values are: create, update, delete, replace (delete and create)
+	Actions []string `json:"actions,omitempty"`
+}
+
+// Condition is a test on a value in a resource change.
+type Condition struct {
+	// Path is the dot separated path to the value in the resource change, for example change.after.vm_size
+	Path string `json:"path"`
+	// Op is the test to perform.
+	// Valid values are: equals, notEquals, in, notIn, exists, notExists, matches, lessThan, greaterThan
+	Op string `json:"op"`
+	// Value is the operand of the test.
+	// For in and notIn it's a list, for matches it's a regular expression.
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Violation is a rule that is violated by one or more resource changes.
+type Violation struct {
+	// Rule is the name of the violated rule.
+	Rule string
+	// Description is the description of the violated rule.
+	Description string
+	// Addresses are the addresses of the resources that violate the rule.
+	Addresses []string
+}
+
+// String returns a human readable violation.
+func (v Violation) String() string {
+	s := v.Rule
+	if v.Description != "" {
+		s += " (" + v.Description + ")"
+	}
+	return fmt.Sprintf("%s %v", s, v.Addresses)
+}
+
+// Load reads all *.yaml, *.yml and *.json files in dir and returns the combined policy.
+// Files are read in lexical order.
+// An error is returned when dir doesn't exist or contains no policy files, a policy that can't be found must not
+// result in changes being applied unchecked.
+func Load(dir string) (*Policy, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s: not a directory", dir)
+	}
+
+	var files []string
+	for _, ext := range []string{"*.yaml", "*.yml", "*.json"} {
+		m, err := filepath.Glob(filepath.Join(dir, ext))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, m...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no policy files (*.yaml, *.yml, *.json)", dir)
+	}
+	sort.Strings(files)
+
+	r := &Policy{}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		p, err := Parse(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(f), err)
+		}
+		r.Rules = append(r.Rules, p.Rules...)
+	}
+
+	return r, nil
+}
+
+// Parse returns the policy in b (YAML or JSON).
+// An error is returned when a rule is invalid.
+func Parse(b []byte) (*Policy, error) {
+	p := &Policy{}
+	err := yaml.UnmarshalStrict(b, p)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, r := range p.Rules {
+		err := r.validate()
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		}
+	}
+
+	return p, nil
+}
+
+// Validate returns an error when the rule can't be evaluated.
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name: required")
+	}
+	for _, pat := range []string{r.Match.Type, r.Match.Address} {
+		if _, err := filepath.Match(pat, ""); err != nil {
+			return fmt.Errorf("%s: match: %w", r.Name, err)
+		}
+	}
+	for _, a := range r.Match.Actions {
+		if _, ok := actions[a]; !ok {
+			return fmt.Errorf("%s: match: unknown action %s", r.Name, a)
+		}
+	}
+	for _, c := range r.Conditions {
+		if c.Path == "" {
+			return fmt.Errorf("%s: conditions: path required", r.Name)
+		}
+		switch c.Op {
+		case "equals", "notEquals", "exists", "notExists", "lessThan", "greaterThan":
+		case "in", "notIn":
+			if _, ok := c.Value.([]interface{}); !ok {
+				return fmt.Errorf("%s: conditions: %s expects a list value", r.Name, c.Op)
+			}
+		case "matches":
+			s, ok := c.Value.(string)
+			if !ok {
+				return fmt.Errorf("%s: conditions: matches expects a string value", r.Name)
+			}
+			if _, err := regexp.Compile(s); err != nil {
+				return fmt.Errorf("%s: conditions: %w", r.Name, err)
+			}
+		default:
+			return fmt.Errorf("%s: conditions: unknown op %s", r.Name, c.Op)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the rules that are violated by the resource changes in a terraform JSON plan.
+// Resource changes without actions (no-op) are ignored.
+func (p *Policy) Evaluate(plan *gabs.Container) []Violation {
+	var r []Violation
+	for _, rule := range p.Rules {
+		var addrs []string
+		for _, chg := range plan.Path("resource_changes").Children() {
+			if rule.violatedBy(chg) {
+				addrs = append(addrs, chg.Path("address").Data().(string))
+			}
+		}
+		if len(addrs) > 0 {
+			r = append(r, Violation{
+				Rule:        rule.Name,
+				Description: rule.Description,
+				Addresses:   addrs,
+			})
+		}
+	}
+	return r
+}
+
+// Actions maps rule action names to the terraform plan actions (sorted).
+var actions = map[string]string{
+	"create":  "create",
+	"update":  "update",
+	"delete":  "delete",
+	"replace": "create,delete",
+}
+
+// ViolatedBy returns true when resource change chg matches the rule and meets all conditions.
+func (r Rule) violatedBy(chg *gabs.Container) bool {
+	var acts []string
+	for _, a := range chg.Path("change.actions").Children() {
+		if s, ok := a.Data().(string); ok && s != "no-op" && s != "read" {
+			acts = append(acts, s)
+		}
+	}
+	if len(acts) == 0 {
+		return false
+	}
+	sort.Strings(acts)
+	act := strings.Join(acts, ",")
+
+	if !globMatch(r.Match.Type, chg.Path("type").Data()) || !globMatch(r.Match.Address, chg.Path("address").Data()) {
+		return false
+	}
+
+	if len(r.Match.Actions) > 0 {
+		var ok bool
+		for _, a := range r.Match.Actions {
+			if actions[a] == act {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	for _, c := range r.Conditions {
+		if !c.meets(chg) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Meets returns true when the value at the condition path in chg passes the condition test.
+func (c Condition) meets(chg *gabs.Container) bool {
+	v := chg.Path(c.Path)
+	exists := v != nil && v.Data() != nil
+	var data interface{}
+	if exists {
+		data = v.Data()
+	}
+
+	switch c.Op {
+	case "exists":
+		return exists
+	case "notExists":
+		return !exists
+	case "equals":
+		return exists && equal(data, c.Value)
+	case "notEquals":
+		return !exists || !equal(data, c.Value)
+	case "in":
+		return exists && in(data, c.Value)
+	case "notIn":
+		return !exists || !in(data, c.Value)
+	case "matches":
+		s, ok := data.(string)
+		return ok && regexp.MustCompile(c.Value.(string)).MatchString(s)
+	case "lessThan", "greaterThan":
+		a, ok1 := data.(float64)
+		b, ok2 := c.Value.(float64)
+		if !ok1 || !ok2 {
+			return false
+		}
+		if c.Op == "lessThan" {
+			return a < b
+		}
+		return a > b
+	}
+	return false
+}
+
+// GlobMatch returns true when pattern is empty or matches value.
+func globMatch(pattern string, value interface{}) bool {
+	if pattern == "" {
+		return true
+	}
+	s, _ := value.(string)
+	ok, _ := filepath.Match(pattern, s)
+	return ok
+}
+
+// Equal returns true when the JSON values a and b are equal.
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// In returns true when a is equal to one of the values in list.
+func in(a, list interface{}) bool {
+	l, _ := list.([]interface{})
+	for _, v := range l {
+		if equal(a, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"github.com/Jeffail/gabs/v2"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	p, err := Load("testdata/policy")
+	if assert.NoError(t, err) {
+		var names []string
+		for _, r := range p.Rules {
+			names = append(names, r.Name)
+		}
+		assert.Equal(t, []string{"keep-clusters", "autoscaling-max", "keep-state-storage"}, names)
+	}
+}
+
+func TestLoad_noFiles(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Load(dir)
+	assert.EqualError(t, err, dir+": no policy files (*.yaml, *.yml, *.json)")
+
+	_, err = Load(dir + "/missing")
+	assert.Error(t, err)
+}
+
+func TestParse_errors(t *testing.T) {
+	tests := []struct {
+		it      string
+		in      string
+		wantErr string
+	}{
+		{
+			it:      "should require a name",
+			in:      `rules: [{match: {type: x}}]`,
+			wantErr: "rules[0]: name: required",
+		},
+		{
+			it:      "should reject unknown actions",
+			in:      `rules: [{name: r, match: {actions: [destroy]}}]`,
+			wantErr: "rules[0]: r: match: unknown action destroy",
+		},
+		{
+			it:      "should reject unknown ops",
+			in:      `rules: [{name: r, conditions: [{path: a, op: like}]}]`,
+			wantErr: "rules[0]: r: conditions: unknown op like",
+		},
+		{
+			it:      "should reject in without a list",
+			in:      `rules: [{name: r, conditions: [{path: a, op: in, value: x}]}]`,
+			wantErr: "rules[0]: r: conditions: in expects a list value",
+		},
+		{
+			it:      "should reject unknown fields",
+			in:      `rules: [{name: r, deny: true}]`,
+			wantErr: `error unmarshaling JSON: while decoding JSON: json: unknown field "deny"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			_, err := Parse([]byte(tt.in))
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestPolicy_Evaluate(t *testing.T) {
+	b, err := ioutil.ReadFile("../client/terraform/testdata/plan.json")
+	assert.NoError(t, err)
+	plan, err := gabs.ParseJSON(b)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		it     string
+		policy string
+		want   []Violation
+	}{
+		{
+			it:     "should report the resources that violate the testdata policies",
+			policy: "testdata/policy",
+			want: []Violation{
+				{Rule: "keep-clusters", Description: "AKS clusters must not be deleted", Addresses: []string{"module.aks1.azurerm_kubernetes_cluster.this"}},
+				{Rule: "autoscaling-max", Description: "node pools must not scale beyond 5 nodes", Addresses: []string{`module.aks1.azurerm_kubernetes_cluster_node_pool.this["extra"]`}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			p, err := Load(tt.policy)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, p.Evaluate(plan))
+			}
+		})
+	}
+}
+
+func TestCondition_meets(t *testing.T) {
+	chg, err := gabs.ParseJSON([]byte(`{"change": {"after": {"vm_size": "Standard_DS2_v2", "count": 3, "public": false, "tags": null}}}`))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		it   string
+		cond string
+		want bool
+	}{
+		{it: "equals string", cond: `{path: change.after.vm_size, op: equals, value: Standard_DS2_v2}`, want: true},
+		{it: "equals number", cond: `{path: change.after.count, op: equals, value: 3}`, want: true},
+		{it: "equals bool", cond: `{path: change.after.public, op: equals, value: false}`, want: true},
+		{it: "equals missing", cond: `{path: change.after.missing, op: equals, value: x}`, want: false},
+		{it: "notEquals", cond: `{path: change.after.vm_size, op: notEquals, value: Standard_DS3_v2}`, want: true},
+		{it: "notEquals missing", cond: `{path: change.after.missing, op: notEquals, value: x}`, want: true},
+		{it: "in", cond: `{path: change.after.vm_size, op: in, value: [Standard_DS2_v2, Standard_DS3_v2]}`, want: true},
+		{it: "notIn", cond: `{path: change.after.vm_size, op: notIn, value: [Standard_DS2_v2]}`, want: false},
+		{it: "exists", cond: `{path: change.after.vm_size, op: exists}`, want: true},
+		{it: "exists null", cond: `{path: change.after.tags, op: exists}`, want: false},
+		{it: "notExists", cond: `{path: change.after.missing, op: notExists}`, want: true},
+		{it: "matches", cond: `{path: change.after.vm_size, op: matches, value: "^Standard_DS[0-9]_v2$"}`, want: true},
+		{it: "lessThan", cond: `{path: change.after.count, op: lessThan, value: 3}`, want: false},
+		{it: "greaterThan", cond: `{path: change.after.count, op: greaterThan, value: 2}`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			p, err := Parse([]byte(`rules: [{name: r, conditions: [` + tt.cond + `]}]`))
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, p.Rules[0].Conditions[0].meets(chg))
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+)
+
+// Logger returns a logger that redacts messages, values and errors before passing them to l.
+func Logger(l logr.Logger) logr.Logger {
+	return logger{l: l, r: Default}
+}
+
+type logger struct {
+	l logr.Logger
+	r *Redactor
+}
+
+var _ logr.Logger = logger{}
+
+func (g logger) Enabled() bool {
+	return g.l.Enabled()
+}
+
+func (g logger) Info(msg string, keysAndValues ...interface{}) {
+	if !g.l.Enabled() {
+		return
+	}
+	g.l.Info(g.r.String(msg), g.values(keysAndValues)...)
+}
+
+func (g logger) Error(err error, msg string, keysAndValues ...interface{}) {
+	if err != nil {
+		if s := g.r.String(err.Error()); s != err.Error() {
+			err = errors.New(s)
+		}
+	}
+	g.l.Error(err, g.r.String(msg), g.values(keysAndValues)...)
+}
+
+func (g logger) V(level int) logr.Logger {
+	return logger{l: g.l.V(level), r: g.r}
+}
+
+func (g logger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	return logger{l: g.l.WithValues(g.values(keysAndValues)...), r: g.r}
+}
+
+func (g logger) WithName(name string) logr.Logger {
+	return logger{l: g.l.WithName(name), r: g.r}
+}
+
+// Values returns a copy of keysAndValues with secrets redacted.
+// Values that contain a secret are replaced by their redacted string representation.
+func (g logger) values(keysAndValues []interface{}) []interface{} {
+	if len(keysAndValues) == 0 {
+		return keysAndValues
+	}
+	r := make([]interface{}, len(keysAndValues))
+	for i, v := range keysAndValues {
+		switch x := v.(type) {
+		case nil:
+			r[i] = x
+		case string:
+			r[i] = g.r.String(x)
+		case []string:
+			r[i] = g.r.Strings(x)
+		case error:
+			r[i] = g.r.String(x.Error())
+		default:
+			s := fmt.Sprintf("%+v", x)
+			if rs := g.r.String(s); rs != s {
+				r[i] = rs
+			} else {
+				r[i] = x
+			}
+		}
+	}
+	return r
+}
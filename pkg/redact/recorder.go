@@ -0,0 +1,29 @@
+package redact
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// EventRecorder returns a recorder that redacts event messages before passing them to er.
+func EventRecorder(er record.EventRecorder) record.EventRecorder {
+	return recorder{er: er, r: Default}
+}
+
+type recorder struct {
+	er record.EventRecorder
+	r  *Redactor
+}
+
+func (e recorder) Event(object runtime.Object, eventtype, reason, message string) {
+	e.er.Event(object, eventtype, reason, e.r.String(message))
+}
+
+func (e recorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	e.er.Event(object, eventtype, reason, e.r.String(fmt.Sprintf(messageFmt, args...)))
+}
+
+func (e recorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	e.er.AnnotatedEventf(object, annotations, eventtype, reason, "%s", e.r.String(fmt.Sprintf(messageFmt, args...)))
+}
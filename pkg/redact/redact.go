@@ -0,0 +1,163 @@
+// Package redact removes secret values from text before it's logged, written to file or shown to the user.
+//
+// Secrets are registered with Add when they are resolved (for example from a vault or credentials file) and scrubbed
+// from strings with String. Secrets that belong to an owner (for example an Environment) are registered with Set so they
+// are replaced when the owner resolves its secrets again and forgotten when the owner is removed. Logger and EventRecorder wrap the log and event sinks so secrets can't leak through them.
+package redact
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces secret values.
+const Placeholder = "<redacted>"
+
+// MinLen is the minimal length of a secret.
+// Shorter values are ignored because replacing them would mangle unrelated text.
+const MinLen = 6
+
+// Redactor knows a set of secret values and removes them from text.
+type Redactor struct {
+	mu sync.RWMutex
+	// Owned are the secrets per owner, the secrets registered with Add have owner "".
+	owned map[string][]string
+	// Secrets are the secrets of all owners sorted longest first so a secret that contains another secret is replaced as
+	// a whole.
+	secrets []string
+}
+
+// Add registers secrets so they will be redacted.
+// Secrets shorter than MinLen are ignored.
+func (r *Redactor) Add(secrets ...string) {
+	r.Append("", secrets...)
+}
+
+// Append registers secrets of owner so they will be redacted.
+func (r *Redactor) Append(owner string, secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.owned == nil {
+		r.owned = make(map[string][]string)
+	}
+	r.owned[owner] = append(r.owned[owner], secrets...)
+	r.rebuild()
+}
+
+// Set replaces the secrets of owner.
+func (r *Redactor) Set(owner string, secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.owned == nil {
+		r.owned = make(map[string][]string)
+	}
+	r.owned[owner] = secrets
+	r.rebuild()
+}
+
+// Remove forgets the secrets of owner.
+func (r *Redactor) Remove(owner string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.owned, owner)
+	r.rebuild()
+}
+
+// Rebuild sets r.secrets to the secrets of all owners.
+// The caller must hold the lock.
+func (r *Redactor) rebuild() {
+	r.secrets = nil
+	for _, ss := range r.owned {
+		for _, s := range ss {
+			for _, v := range variants(s) {
+				if len(v) < MinLen || contains(r.secrets, v) {
+					continue
+				}
+				r.secrets = append(r.secrets, v)
+			}
+		}
+	}
+
+	sort.SliceStable(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+// String returns s with all secrets replaced by Placeholder.
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, sec := range r.secrets {
+		if strings.Contains(s, sec) {
+			s = strings.ReplaceAll(s, sec, Placeholder)
+		}
+	}
+	return s
+}
+
+// Strings returns a copy of ss with all secrets replaced by Placeholder.
+func (r *Redactor) Strings(ss []string) []string {
+	if ss == nil {
+		return nil
+	}
+	o := make([]string, len(ss))
+	for i, s := range ss {
+		o[i] = r.String(s)
+	}
+	return o
+}
+
+// Variants returns s and the forms in which s can appear in written artefacts.
+func variants(s string) []string {
+	r := []string{s}
+	// JSON encoded (values.json)
+	if q, err := json.Marshal(s); err == nil {
+		if e := string(q[1 : len(q)-1]); e != s {
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Default is the Redactor used by the package level functions.
+var Default = &Redactor{}
+
+// Add registers secrets with the Default Redactor.
+func Add(secrets ...string) {
+	Default.Add(secrets...)
+}
+
+// Set replaces the secrets of owner in the Default Redactor.
+func Set(owner string, secrets ...string) {
+	Default.Set(owner, secrets...)
+}
+
+// Append registers secrets of owner with the Default Redactor.
+func Append(owner string, secrets ...string) {
+	Default.Append(owner, secrets...)
+}
+
+// Remove forgets the secrets of owner in the Default Redactor.
+func Remove(owner string) {
+	Default.Remove(owner)
+}
+
+// String returns s with all secrets known to the Default Redactor replaced by Placeholder.
+func String(s string) string {
+	return Default.String(s)
+}
@@ -0,0 +1,123 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
+	"testing"
+)
+
+func TestRedactor_String(t *testing.T) {
+	r := &Redactor{}
+	r.Add("s3cr3t-value", "short", "", `pa"ss\word`, "s3cr3t-value-longer")
+
+	tests := []struct {
+		it   string
+		in   string
+		want string
+	}{
+		{
+			it:   "should redact a secret",
+			in:   "az login -p s3cr3t-value --tenant x",
+			want: "az login -p <redacted> --tenant x",
+		},
+		{
+			it:   "should redact all occurrences",
+			in:   "s3cr3t-value s3cr3t-value",
+			want: "<redacted> <redacted>",
+		},
+		{
+			it:   "should redact the longest secret first",
+			in:   "https://s3cr3t-value-longer@example.com",
+			want: "https://<redacted>@example.com",
+		},
+		{
+			it:   "should ignore short secrets",
+			in:   "short",
+			want: "short",
+		},
+		{
+			it:   "should redact JSON encoded secrets",
+			in:   `{"a": "pa\"ss\\word"}`,
+			want: `{"a": "<redacted>"}`,
+		},
+		{
+			it:   "should leave text without secrets alone",
+			in:   "nothing to see",
+			want: "nothing to see",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.String(tt.in))
+		})
+	}
+}
+
+func TestRedactor_Set(t *testing.T) {
+	r := &Redactor{}
+	r.Add("global-secret")
+	r.Set("ns/env1", "env1-secret-v1")
+	r.Set("ns/env2", "env2-secret")
+
+	r.Set("ns/env1", "env1-secret-v2")
+	assert.Equal(t, "env1-secret-v1 <redacted> <redacted>", r.String("env1-secret-v1 env1-secret-v2 global-secret"),
+		"should forget replaced secrets")
+
+	r.Append("ns/env1", "env1-notify-url")
+	assert.Equal(t, "<redacted> <redacted>", r.String("env1-secret-v2 env1-notify-url"))
+
+	r.Remove("ns/env2")
+	assert.Equal(t, "env2-secret <redacted>", r.String("env2-secret global-secret"), "should forget removed owners")
+}
+
+func TestLogger(t *testing.T) {
+	Add("logger-secret")
+	sink := &captureLogger{}
+	log := Logger(sink).WithName("test").V(1)
+
+	args := []string{"-p", "logger-secret"}
+	log.Info("msg logger-secret", "args", args, "n", 1, "m", map[string]string{"k": "logger-secret"})
+	log.Error(errors.New("failed logger-secret"), "oops", "err", fmt.Errorf("wrapped: logger-secret"))
+
+	assert.Equal(t, []string{
+		"msg <redacted> [args [-p <redacted>] n 1 m map[k:<redacted>]]",
+		"oops failed <redacted> [err wrapped: <redacted>]",
+	}, sink.lines)
+	assert.Equal(t, []string{"-p", "logger-secret"}, args, "should not modify the callers values")
+}
+
+func TestEventRecorder(t *testing.T) {
+	Add("recorder-secret")
+	fake := record.NewFakeRecorder(2)
+	rec := EventRecorder(fake)
+
+	rec.Event(nil, "Normal", "Infra", "git clone https://recorder-secret@example.com")
+	rec.Eventf(nil, "Warning", "Infra", "token %s", "recorder-secret")
+
+	assert.Equal(t, "Normal Infra git clone https://<redacted>@example.com", <-fake.Events)
+	assert.Equal(t, "Warning Infra token <redacted>", <-fake.Events)
+}
+
+// CaptureLogger is a logr.Logger that records lines.
+type captureLogger struct {
+	lines []string
+}
+
+func (c *captureLogger) Enabled() bool { return true }
+
+func (c *captureLogger) Info(msg string, keysAndValues ...interface{}) {
+	c.lines = append(c.lines, fmt.Sprintf("%s %v", msg, keysAndValues))
+}
+
+func (c *captureLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	c.lines = append(c.lines, fmt.Sprintf("%s %v %v", msg, err, keysAndValues))
+}
+
+func (c *captureLogger) V(int) logr.Logger { return c }
+
+func (c *captureLogger) WithValues(...interface{}) logr.Logger { return c }
+
+func (c *captureLogger) WithName(string) logr.Logger { return c }
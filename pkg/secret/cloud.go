@@ -0,0 +1,18 @@
+package secret
+
+import (
+	"context"
+	"github.com/mmlt/environment-operator/pkg/cloud"
+)
+
+// Cloud resolves references from the vault of the cloud provider (Azure Key Vault).
+type Cloud struct {
+	Cloud cloud.Cloud
+}
+
+var _ Resolver = Cloud{}
+
+// Get returns the value of secret name from the cloud vault.
+func (c Cloud) Get(_ context.Context, _, name, field string) (string, error) {
+	return c.Cloud.VaultGet(name, field)
+}
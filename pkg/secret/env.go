@@ -0,0 +1,28 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+)
+
+// Env resolves references from environment variables.
+type Env struct {
+	// Environ are the environment variables.
+	Environ map[string]string
+	// Prefix is prepended to the secret name to get the environment variable name.
+	// It limits the variables that can be referenced, for example 'ENVOP_SECRET_'.
+	Prefix string
+}
+
+var _ Resolver = Env{}
+
+// Get returns the value of environment variable Prefix+name.
+// When field is not empty the variable is expected to contain a JSON object.
+func (e Env) Get(_ context.Context, _, name, field string) (string, error) {
+	v, ok := e.Environ[e.Prefix+name]
+	if !ok {
+		return "", fmt.Errorf("no environment variable %s", e.Prefix+name)
+	}
+
+	return jsonField(v, field)
+}
@@ -0,0 +1,46 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File resolves references from files in a directory, typically used during development and testing.
+type File struct {
+	// RootPath is the directory that contains the secrets, names can't refer to files outside RootPath.
+	RootPath string
+}
+
+var _ Resolver = File{}
+
+// Get returns the value of secret name.
+// When name is a file field selects a field in the JSON content of the file.
+// When name is a directory field is the name of a file in the directory (like a mounted k8s Secret).
+// A trailing newline is removed from the value.
+func (f File) Get(_ context.Context, _, name, field string) (string, error) {
+	p := filepath.Join(f.RootPath, filepath.Clean("/"+name))
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+
+	if fi.IsDir() {
+		if field == "" {
+			return "", fmt.Errorf("secret %s is a directory, field expected", name)
+		}
+		p = filepath.Join(p, filepath.Clean("/"+field))
+		field = ""
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+
+	return jsonField(strings.TrimSuffix(string(b), "\n"), field)
+}
@@ -0,0 +1,73 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HCVault resolves references from a HashiCorp Vault KV version 2 secrets engine.
+// The secret name is the mount followed by the path of the secret, for example 'secret/env1/tfstate'.
+type HCVault struct {
+	// Address of the Vault server, for example https://vault.example.com:8200
+	Address string
+	// Token to authenticate with.
+	Token string
+	// Client is the HTTP client to use, nil uses http.DefaultClient.
+	Client *http.Client
+}
+
+var _ Resolver = HCVault{}
+
+// Get returns the value of field in secret name.
+// When field is empty the secret data is returned as a JSON object.
+func (h HCVault) Get(ctx context.Context, _, name, field string) (string, error) {
+	ss := strings.SplitN(strings.Trim(name, "/"), "/", 2)
+	if len(ss) != 2 {
+		return "", fmt.Errorf("secret %s: expected mount/path", name)
+	}
+	url := strings.TrimSuffix(h.Address, "/") + "/v1/" + ss[0] + "/data/" + ss[1]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", h.Token)
+
+	cl := h.Client
+	if cl == nil {
+		cl = http.DefaultClient
+	}
+	resp, err := cl.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secret %s: %s", name, resp.Status)
+	}
+
+	var kv struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&kv)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+
+	b, err := json.Marshal(kv.Data.Data)
+	if err != nil {
+		return "", err
+	}
+	v, err := jsonField(string(b), field)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+
+	return v, nil
+}
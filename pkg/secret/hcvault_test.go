@@ -0,0 +1,53 @@
+package secret
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHCVault_Get(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "t0k3n" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/env1/tfstate":
+			_, _ = w.Write([]byte(`{"data": {"data": {"access-key": "s3cr3t"}, "metadata": {"version": 3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		it      string
+		token   string
+		name    string
+		field   string
+		want    string
+		wantErr string
+	}{
+		{it: "should read a field", token: "t0k3n", name: "secret/env1/tfstate", field: "access-key", want: "s3cr3t"},
+		{it: "should read all data", token: "t0k3n", name: "secret/env1/tfstate", want: `{"access-key":"s3cr3t"}`},
+		{it: "should report an unknown field", token: "t0k3n", name: "secret/env1/tfstate", field: "nope", wantErr: "secret secret/env1/tfstate: no field 'nope' in secret"},
+		{it: "should report an unknown secret", token: "t0k3n", name: "secret/env1/nope", wantErr: "secret secret/env1/nope: 404 Not Found"},
+		{it: "should report a wrong token", token: "wrong", name: "secret/env1/tfstate", wantErr: "secret secret/env1/tfstate: 403 Forbidden"},
+		{it: "should need a mount and path", token: "t0k3n", name: "tfstate", wantErr: "secret tfstate: expected mount/path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			h := HCVault{Address: srv.URL, Token: tt.token, Client: srv.Client()}
+			got, err := h.Get(context.Background(), "", tt.name, tt.field)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
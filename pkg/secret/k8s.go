@@ -0,0 +1,43 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Kubernetes resolves references from Secrets in the namespace of the Environment.
+type Kubernetes struct {
+	// Reader reads Secrets, typically an uncached reader to prevent all Secrets in the cluster being cached.
+	Reader client.Reader
+}
+
+var _ Resolver = Kubernetes{}
+
+// Get returns the value of key field in Secret name.
+// Field can be omitted when the Secret has exactly one key.
+func (k Kubernetes) Get(ctx context.Context, namespace, name, field string) (string, error) {
+	sec := &corev1.Secret{}
+	err := k.Reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, sec)
+	if err != nil {
+		return "", fmt.Errorf("secret %s/%s: %w", namespace, name, err)
+	}
+
+	if field == "" {
+		if len(sec.Data) != 1 {
+			return "", fmt.Errorf("secret %s/%s: field expected, secret has %d keys", namespace, name, len(sec.Data))
+		}
+		for _, v := range sec.Data {
+			return string(v), nil
+		}
+	}
+
+	v, ok := sec.Data[field]
+	if !ok {
+		return "", fmt.Errorf("no field '%s' in secret %s/%s", field, namespace, name)
+	}
+
+	return string(v), nil
+}
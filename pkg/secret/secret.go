@@ -0,0 +1,136 @@
+// Package secret resolves references to secret values that are stored in a secret backend.
+//
+// A reference has the form "vault name [field]" where name is optionally prefixed with the name of a backend, for example:
+//
+//	vault tfstate access-key         Azure Key Vault secret 'tfstate' field 'access-key' (no prefix)
+//	vault k8s:tfstate access-key     Kubernetes Secret 'tfstate' key 'access-key' in the Environment namespace
+//	vault file:tfstate.json key      file 'tfstate.json' field 'key'
+//	vault env:TFSTATE                environment variable 'TFSTATE'
+//	vault hcvault:secret/tfstate key HashiCorp Vault KV secret 'tfstate' in mount 'secret' field 'key'
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Resolver reads secret values from a backend.
+type Resolver interface {
+	// Get returns the value of secret name.
+	// When field is not empty the value of that field in the secret is returned.
+	// Namespace is the namespace of the Environment that refers to the secret.
+	Get(ctx context.Context, namespace, name, field string) (string, error)
+}
+
+// Ref is a reference to a secret value.
+type Ref struct {
+	// Backend is the name of the backend that stores the secret, empty for the default backend.
+	Backend string
+	// Name of the secret.
+	Name string
+	// Field in the secret, empty for the whole secret.
+	Field string
+}
+
+// Backends are the backend names that can be used as a reference prefix.
+var Backends = []string{"k8s", "file", "env", "hcvault"}
+
+// ParseRef returns the reference in s.
+// Returns false when s isn't a reference (doesn't start with "vault ").
+func ParseRef(s string) (Ref, bool, error) {
+	if !strings.HasPrefix(s, "vault ") {
+		return Ref{}, false, nil
+	}
+
+	ss := strings.Fields(s)
+	var r Ref
+	switch len(ss) {
+	case 2:
+		r.Name = ss[1]
+	case 3:
+		r.Name = ss[1]
+		r.Field = ss[2]
+	default:
+		return Ref{}, true, fmt.Errorf("vault reference wrong, expected 'vault name [field]'")
+	}
+
+	if i := strings.Index(r.Name, ":"); i >= 0 {
+		r.Backend, r.Name = r.Name[:i], r.Name[i+1:]
+		if !contains(Backends, r.Backend) {
+			return Ref{}, true, fmt.Errorf("vault reference: unknown backend %s, expected one of %v", r.Backend, Backends)
+		}
+		if r.Name == "" {
+			return Ref{}, true, fmt.Errorf("vault reference: name expected after %s:", r.Backend)
+		}
+	}
+
+	return r, true, nil
+}
+
+// Mux is a Resolver that dispatches to a backend based on the reference prefix.
+type Mux struct {
+	// Default resolves references without a backend prefix.
+	Default Resolver
+	// Backends resolve references by backend prefix.
+	// Backends that are not in the map are disabled.
+	Backends map[string]Resolver
+}
+
+// Resolve returns the value s refers to or s itself when it isn't a reference.
+func (m *Mux) Resolve(ctx context.Context, namespace, s string) (string, error) {
+	ref, ok, err := ParseRef(s)
+	if err != nil || !ok {
+		return s, err
+	}
+
+	r := m.Default
+	if ref.Backend != "" {
+		r = m.Backends[ref.Backend]
+	}
+	if r == nil {
+		return "", fmt.Errorf("vault reference: backend %q not enabled", ref.Backend)
+	}
+
+	return r.Get(ctx, namespace, ref.Name, ref.Field)
+}
+
+// JSONField returns the value of field in JSON object v.
+// When field is empty or "." v is returned.
+func jsonField(v, field string) (string, error) {
+	if field == "" || field == "." {
+		return v, nil
+	}
+
+	m := map[string]interface{}{}
+	err := json.Unmarshal([]byte(v), &m)
+	if err != nil {
+		return "", fmt.Errorf("field '%s': %w", field, err)
+	}
+
+	switch x := m[field].(type) {
+	case string:
+		if x != "" {
+			return x, nil
+		}
+	case nil:
+	default:
+		b, err := json.Marshal(x)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	return "", fmt.Errorf("no field '%s' in secret", field)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package secret
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Ref
+		wantRef bool
+		wantErr string
+	}{
+		{in: "literal", wantRef: false},
+		{in: "vaulted", wantRef: false},
+		{in: "vault name", want: Ref{Name: "name"}, wantRef: true},
+		{in: "vault name field", want: Ref{Name: "name", Field: "field"}, wantRef: true},
+		{in: "vault k8s:name field", want: Ref{Backend: "k8s", Name: "name", Field: "field"}, wantRef: true},
+		{in: "vault hcvault:secret/env1/tf key", want: Ref{Backend: "hcvault", Name: "secret/env1/tf", Field: "key"}, wantRef: true},
+		{in: "vault a b c", wantRef: true, wantErr: "vault reference wrong, expected 'vault name [field]'"},
+		{in: "vault s3:name", wantRef: true, wantErr: "vault reference: unknown backend s3, expected one of [k8s file env hcvault]"},
+		{in: "vault env:", wantRef: true, wantErr: "vault reference: name expected after env:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok, err := ParseRef(tt.in)
+			assert.Equal(t, tt.wantRef, ok)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type fakeResolver string
+
+func (f fakeResolver) Get(_ context.Context, namespace, name, field string) (string, error) {
+	return string(f) + ":" + namespace + "/" + name + "/" + field, nil
+}
+
+func TestMux_Resolve(t *testing.T) {
+	m := &Mux{
+		Default:  fakeResolver("default"),
+		Backends: map[string]Resolver{"k8s": fakeResolver("k8s")},
+	}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "literal", want: "literal"},
+		{in: "vault name field", want: "default:ns/name/field"},
+		{in: "vault k8s:name", want: "k8s:ns/name/"},
+		{in: "vault env:name", wantErr: `vault reference: backend "env" not enabled`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := m.Resolve(context.Background(), "ns", tt.in)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestKubernetes_Get(t *testing.T) {
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "tfstate"},
+			Data:       map[string][]byte{"access-key": []byte("s3cr3t"), "other": []byte("x")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "token"},
+			Data:       map[string][]byte{"token": []byte("t0k3n")},
+		},
+	).Build()
+	k := Kubernetes{Reader: cl}
+
+	tests := []struct {
+		it        string
+		namespace string
+		name      string
+		field     string
+		want      string
+		wantErr   string
+	}{
+		{it: "should read a key", namespace: "ns", name: "tfstate", field: "access-key", want: "s3cr3t"},
+		{it: "should read the only key", namespace: "ns", name: "token", want: "t0k3n"},
+		{it: "should need a field when there are more keys", namespace: "ns", name: "tfstate", wantErr: "secret ns/tfstate: field expected, secret has 2 keys"},
+		{it: "should report an unknown key", namespace: "ns", name: "tfstate", field: "nope", wantErr: "no field 'nope' in secret ns/tfstate"},
+		{it: "should only read from the namespace", namespace: "other", name: "tfstate", field: "access-key", wantErr: `secret other/tfstate: secrets "tfstate" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := k.Get(context.Background(), tt.namespace, tt.name, tt.field)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFile_Get(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "plain"), []byte("value\n"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "obj.json"), []byte(`{"key": "value", "n": 1}`), 0600))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "mounted"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "mounted", "key"), []byte("value"), 0600))
+	f := File{RootPath: dir}
+
+	tests := []struct {
+		it      string
+		name    string
+		field   string
+		want    string
+		wantErr bool
+	}{
+		{it: "should read a file", name: "plain", want: "value"},
+		{it: "should read a JSON field", name: "obj.json", field: "key", want: "value"},
+		{it: "should read a non-string JSON field", name: "obj.json", field: "n", want: "1"},
+		{it: "should read a file in a directory", name: "mounted", field: "key", want: "value"},
+		{it: "should need a field for a directory", name: "mounted", wantErr: true},
+		{it: "should not read outside the root", name: "../../etc/passwd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := f.Get(context.Background(), "", tt.name, tt.field)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEnv_Get(t *testing.T) {
+	e := Env{
+		Environ: map[string]string{"ENVOP_SECRET_TOKEN": "t0k3n", "ENVOP_SECRET_OBJ": `{"key":"value"}`, "HOME": "/root"},
+		Prefix:  "ENVOP_SECRET_",
+	}
+
+	got, err := e.Get(context.Background(), "", "TOKEN", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "t0k3n", got)
+
+	got, err = e.Get(context.Background(), "", "OBJ", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", got)
+
+	_, err = e.Get(context.Background(), "", "HOME", "")
+	assert.EqualError(t, err, "no environment variable ENVOP_SECRET_HOME")
+}
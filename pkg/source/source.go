@@ -2,12 +2,14 @@
 package source
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
 	"github.com/go-logr/logr"
 	multierror "github.com/hashicorp/go-multierror"
 	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/metrics"
 	"github.com/mmlt/environment-operator/pkg/util/exe"
 	otia10copy "github.com/otiai10/copy"
 	"hash"
@@ -180,10 +182,10 @@ func (ss *Sources) Workspace(nsn types.NamespacedName, name string) (Workspace,
 
 // FetchAll fetches all remote repo's or filesystems into a local repo directory.
 // The fetch rate is limited to at most once per N minutes.
-func (ss *Sources) FetchAll() error {
+func (ss *Sources) FetchAll(ctx context.Context) error {
 	var errs error
 	for _, w := range ss.workspaces {
-		err := ss.fetch(w.Spec)
+		err := ss.fetch(ctx, w.Spec)
 		if err != nil {
 			errs = multierror.Append(errs, err)
 		}
@@ -196,23 +198,26 @@ var timeNow = time.Now
 
 // Fetch fetches a remote repo or filesystem specified by spec into a local repo directory.
 // The fetch rate is limited to at most once per N minutes.
-func (ss *Sources) fetch(spec v1.SourceSpec) error {
+func (ss *Sources) fetch(ctx context.Context, spec v1.SourceSpec) error {
 	if ss.repos == nil {
 		ss.repos = make(map[v1.SourceSpec]repo)
 	}
 
 	// fetch
+	start := time.Now()
 	var err error
 	var h string
 	switch spec.Type {
 	case v1.SourceTypeGIT:
-		h, err = ss.gitFetch(spec)
+		h, err = ss.gitFetch(ctx, spec)
 	case v1.SourceTypeLocal:
 		h, err = ss.localFetch(spec)
 	default:
 		err = fmt.Errorf("source: unknown type: %s", spec.Type)
 	}
+	metrics.SourceFetchDuration.WithLabelValues(spec.URL).Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.SourceFetchFailures.WithLabelValues(spec.URL).Inc()
 		return err
 	}
 
@@ -256,7 +261,7 @@ func (ss *Sources) localFetch(spec v1.SourceSpec) (string, error) {
 }
 
 // GITFetch fetches content of a GIT repo and returns its hash.
-func (ss *Sources) gitFetch(spec v1.SourceSpec) (string, error) {
+func (ss *Sources) gitFetch(ctx context.Context, spec v1.SourceSpec) (string, error) {
 	p := ss.repoPath(spec)
 	_, err := os.Stat(p)
 	if os.IsNotExist(err) {
@@ -267,19 +272,19 @@ func (ss *Sources) gitFetch(spec v1.SourceSpec) (string, error) {
 			return "", err
 		}
 
-		_, _, err = exe.Run(ss.Log, &exe.Opt{Dir: d}, "", "git", "clone", urlWithToken(spec.URL, spec.Token))
+		_, _, err = exe.RunContext(ctx, ss.Log, &exe.Opt{Dir: d}, "", "git", "clone", urlWithToken(spec.URL, spec.Token))
 		if err != nil {
 			return "", err
 		}
 
-		_, _, err = exe.Run(ss.Log, &exe.Opt{Dir: p}, "", "git", "checkout", spec.Ref)
+		_, _, err = exe.RunContext(ctx, ss.Log, &exe.Opt{Dir: p}, "", "git", "checkout", spec.Ref)
 		if err != nil {
 			return "", err
 		}
 		ss.Log.Info("GIT-clone", "url", spec.URL, "ref", spec.Ref)
 	} else {
 		// Pull existing repo content.
-		_, _, err = exe.Run(ss.Log, &exe.Opt{Dir: p}, "", "git", "pull", "origin", spec.Ref)
+		_, _, err = exe.RunContext(ctx, ss.Log, &exe.Opt{Dir: p}, "", "git", "pull", "origin", spec.Ref)
 		if err != nil {
 			return "", err
 		}
@@ -287,7 +292,7 @@ func (ss *Sources) gitFetch(spec v1.SourceSpec) (string, error) {
 	}
 
 	// Get hash.
-	h, _, err := exe.Run(ss.Log, &exe.Opt{Dir: p}, "", "git", "rev-parse", spec.Ref)
+	h, _, err := exe.RunContext(ctx, ss.Log, &exe.Opt{Dir: p}, "", "git", "rev-parse", spec.Ref)
 	if err != nil {
 		return "", err
 	}
@@ -1,8 +1,11 @@
 package source
 
 import (
+	"context"
 	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/metrics"
 	otia10copy "github.com/otiai10/copy"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	metav1 "k8s.io/apimachinery/pkg/types"
@@ -58,7 +61,7 @@ func TestSources_e2e_local_spec_change(t *testing.T) {
 			return
 		}
 
-		err = ss.FetchAll()
+		err = ss.FetchAll(context.Background())
 		if !assert.NoError(t, err, "FetchAll") {
 			return
 		}
@@ -133,7 +136,7 @@ func TestSources_e2e_local_content_change(t *testing.T) {
 			return
 		}
 
-		err = ss.FetchAll()
+		err = ss.FetchAll(context.Background())
 		if !assert.NoError(t, err, "FetchAll") {
 			return
 		}
@@ -151,3 +154,19 @@ func TestSources_e2e_local_content_change(t *testing.T) {
 	// currently the workspace directories aren't pruned, that's why file1.txt still exists.
 	assert.FileExists(t, filepath.Join(ss.RootPath, "workspace", nsn.Namespace, nsn.Name, name, "content", "file1.txt"))
 }
+
+func TestSources_fetch_metrics(t *testing.T) {
+	ss := testNewSources(t)
+	defer testRemoveSources(t, ss)
+
+	failures := func(repo string) float64 {
+		return testutil.ToFloat64(metrics.SourceFetchFailures.WithLabelValues(repo))
+	}
+	okBefore, failBefore := failures("testdata/step1"), failures("testdata/nonexisting")
+
+	assert.NoError(t, ss.fetch(context.Background(), v1.SourceSpec{Type: "local", URL: "testdata/step1"}))
+	assert.Error(t, ss.fetch(context.Background(), v1.SourceSpec{Type: "local", URL: "testdata/nonexisting"}))
+
+	assert.Equal(t, okBefore, failures("testdata/step1"))
+	assert.Equal(t, failBefore+1, failures("testdata/nonexisting"))
+}
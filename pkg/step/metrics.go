@@ -0,0 +1,27 @@
+package step
+
+import (
+	"github.com/mmlt/environment-operator/pkg/metrics"
+)
+
+// Plan rejection reasons.
+const (
+	// RejectLimits is used when a plan exceeds the add, change or delete limits of the budget.
+	rejectLimits = "limits"
+	// RejectRules is used when a plan violates a resource rule of the budget.
+	rejectRules = "rules"
+	// RejectPolicy is used when a plan violates a rule of the infra policy.
+	rejectPolicy = "policy"
+)
+
+// CountResources adds the number of resources that are added, changed and deleted by a terraform step of type t to the metrics.
+func countResources(t Type, added, changed, deleted int) {
+	metrics.TerraformResources.WithLabelValues(string(t), "add").Add(float64(added))
+	metrics.TerraformResources.WithLabelValues(string(t), "change").Add(float64(changed))
+	metrics.TerraformResources.WithLabelValues(string(t), "delete").Add(float64(deleted))
+}
+
+// CountRejection counts a plan of a step of type t that is rejected by the budget or policy for reason.
+func countRejection(t Type, reason string) {
+	metrics.BudgetRejections.WithLabelValues(string(t), reason).Inc()
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/redact"
 	"strings"
 	"sync"
 	"time"
 )
 
+// TimeNow for testing.
+var timeNow = time.Now
+
 // Step is an unit of execution.
 type Step interface {
 	Meta
@@ -16,14 +20,32 @@ type Step interface {
 	Execute(context.Context, []string)
 }
 
+// Counter is implemented by steps that report the number of objects they affected.
+type Counter interface {
+	// GetCounts returns the number of objects added, changed and deleted by the last execution.
+	GetCounts() (added, changed, deleted int)
+}
+
+// Artefacter is implemented by steps that write files (artefacts) that are worth keeping.
+type Artefacter interface {
+	// Artefacts returns the paths of the files the step writes.
+	Artefacts() []string
+}
+
 // Meta is behaviour that all steps have in common.
 type Meta interface {
 	GetID() ID
 	GetHash() string
+	GetHashInputs() map[string]string
 	GetState() v1.StepState
 	GetMsg() string
 	GetLastUpdate() time.Time
+	GetStartTime() time.Time
 	GetLastError() error
+	GetApproval() *v1.PlanApproval
+	GetDrift() *v1.DriftStatus
+	GetSecretVersions() []v1.SecretVersion
+	SetSecretVersions(versions []v1.SecretVersion)
 	SetOnUpdate(fn MetaUpdateFn)
 }
 
@@ -34,14 +56,24 @@ type Metaa struct {
 	ID ID
 	// Hash is unique for the config/parameters applied by a step.
 	Hash string
+	// HashInputs are the hashes of the named inputs (source, spec, values) that Hash is derived from.
+	HashInputs map[string]string
 	// State indicates if a step is running, ready or is in error.
 	State v1.StepState
 	// Msg helps explaining the state. Mandatory for StepStateError.
 	Msg string
 	// LastUpdate is the time of the last state change.
 	LastUpdate time.Time
+	// StartTime is the time the step started running.
+	StartTime time.Time
 	// LastError contains the last encountered error or nil.
 	lastError error
+	// Approval is the plan that needs approval (only set in StateAwaitingApproval).
+	approval *v1.PlanApproval
+	// Drift is the result of a drift check (only set by a Drift step in StateReady).
+	drift *v1.DriftStatus
+	// SecretVersions are the versions of the referenced secrets the step uses.
+	secretVersions []v1.SecretVersion
 	// OnUpdate (optional) is a function that is called after updating.
 	onUpdate MetaUpdateFn
 	// Mu is a mutex.
@@ -66,6 +98,13 @@ func (m *Metaa) GetHash() string {
 	return m.Hash
 }
 
+func (m *Metaa) GetHashInputs() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.HashInputs
+}
+
 func (m *Metaa) GetState() v1.StepState {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -87,6 +126,13 @@ func (m *Metaa) GetLastUpdate() time.Time {
 	return m.LastUpdate
 }
 
+func (m *Metaa) GetStartTime() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.StartTime
+}
+
 func (m *Metaa) GetLastError() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -94,6 +140,34 @@ func (m *Metaa) GetLastError() error {
 	return m.lastError
 }
 
+func (m *Metaa) GetApproval() *v1.PlanApproval {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.approval
+}
+
+func (m *Metaa) GetDrift() *v1.DriftStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.drift
+}
+
+func (m *Metaa) GetSecretVersions() []v1.SecretVersion {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.secretVersions
+}
+
+func (m *Metaa) SetSecretVersions(versions []v1.SecretVersion) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.secretVersions = versions
+}
+
 func (m *Metaa) SetOnUpdate(fn MetaUpdateFn) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -102,7 +176,10 @@ func (m *Metaa) SetOnUpdate(fn MetaUpdateFn) {
 }
 
 // Update updates Step meta and notifies on-update listeners.
+// Secret values are redacted from msg.
 func (m *Metaa) update(state v1.StepState, msg string) {
+	msg = redact.String(msg)
+
 	m.mu.Lock()
 	if !IsStateLE(m.State, state) {
 		m.mu.Unlock()
@@ -110,7 +187,10 @@ func (m *Metaa) update(state v1.StepState, msg string) {
 	}
 	m.State = state
 	m.Msg = msg
-	m.LastUpdate = time.Now()
+	m.LastUpdate = timeNow()
+	if state == v1.StateRunning && m.StartTime.IsZero() {
+		m.StartTime = m.LastUpdate
+	}
 	f := m.onUpdate
 	m.mu.Unlock()
 
@@ -132,6 +212,24 @@ func (m *Metaa) error2(err error, msg string) {
 	m.update(v1.StateError, msg)
 }
 
+// AwaitApproval updates Step meta, sets AwaitingApproval state and notifies on-update listeners.
+func (m *Metaa) awaitApproval(approval *v1.PlanApproval, msg string) {
+	m.mu.Lock()
+	m.approval = approval
+	m.mu.Unlock()
+
+	m.update(v1.StateAwaitingApproval, msg)
+}
+
+// ReportDrift updates Step meta, sets Ready state and notifies on-update listeners.
+func (m *Metaa) reportDrift(drift *v1.DriftStatus, msg string) {
+	m.mu.Lock()
+	m.drift = drift
+	m.mu.Unlock()
+
+	m.update(v1.StateReady, msg)
+}
+
 // ID uniquely identifies a Step.
 type ID struct {
 	// Type is the type of step, for example; Infra, Destroy, Addons.
@@ -153,13 +251,14 @@ type Type string
 const (
 	TypeInfra             Type = "Infra"
 	TypeDestroy           Type = "Destroy"
+	TypeDrift             Type = "Drift"
 	TypeAKSPool           Type = "AKSPool"
 	TypeAKSAddonPreflight Type = "AKSAddonPreflight"
 	TypeAddons            Type = "Addons"
 )
 
 // InfraTypes is an enumeration of types that apply to all clusters.
-var InfraTypes = []Type{TypeInfra, TypeDestroy}
+var InfraTypes = []Type{TypeInfra, TypeDestroy, TypeDrift}
 
 // ClusterTypes is an enumeration of cluster specific types.
 var ClusterTypes = []Type{TypeAKSPool, TypeAKSAddonPreflight, TypeAddons}
@@ -170,10 +269,10 @@ var Types = append(InfraTypes, ClusterTypes...)
 // IsStateFinal returns true is state is a final state.
 // A step in final state has stopped executing.
 func IsStateFinal(state v1.StepState) bool {
-	return state == v1.StateReady || state == v1.StateError
+	return state == v1.StateReady || state == v1.StateError || state == v1.StateAwaitingApproval
 }
 
-// IsStateLE returns true if lhs is less or equal to rhs assuming the ordering; "", Running, Ready | Error
+// IsStateLE returns true if lhs is less or equal to rhs assuming the ordering; "", Running, AwaitingApproval | Ready | Error
 func IsStateLE(lhs, rhs v1.StepState) bool {
 	toNum := func(s v1.StepState) int {
 		switch s {
@@ -181,7 +280,7 @@ func IsStateLE(lhs, rhs v1.StepState) bool {
 			return 0
 		case v1.StateRunning:
 			return 1
-		case v1.StateReady, v1.StateError:
+		case v1.StateAwaitingApproval, v1.StateReady, v1.StateError:
 			return 2
 		default:
 			panic("bug: state missing")
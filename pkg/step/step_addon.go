@@ -7,6 +7,7 @@ import (
 	"github.com/go-logr/logr"
 	v1 "github.com/mmlt/environment-operator/api/v1"
 	"github.com/mmlt/environment-operator/pkg/client/addon"
+	"github.com/mmlt/environment-operator/pkg/util/exe"
 	"io/ioutil"
 	"path/filepath"
 	"strings"
@@ -38,6 +39,11 @@ type AddonStep struct {
 	Added, Changed, Deleted int
 }
 
+// GetCounts returns the number of resources affected by kubectl-tmplt.
+func (st *AddonStep) GetCounts() (added, changed, deleted int) {
+	return st.Added, st.Changed, st.Deleted
+}
+
 // Execute performs a kubectl-tmplt apply.
 func (st *AddonStep) Execute(ctx context.Context, env []string) {
 	log := logr.FromContext(ctx).WithName("AddonStep")
@@ -72,7 +78,7 @@ func (st *AddonStep) Execute(ctx context.Context, env []string) {
 
 		if cmd != nil {
 			// real cmd (fakes are nil).
-			err := cmd.Wait()
+			err := exe.Wait(cmd)
 			if err != nil {
 				log.Error(err, "wait kubectl-tmplt")
 			}
@@ -102,9 +108,9 @@ func (st *AddonStep) Execute(ctx context.Context, env []string) {
 	var tA, tC, tD int
 	for _, t := range totals {
 		tE = append(tE, t.Errors...)
-		tA = +t.Added
-		tC = +t.Changed
-		tD = +t.Deleted
+		tA += t.Added
+		tC += t.Changed
+		tD += t.Deleted
 	}
 	if len(tE) > 0 {
 		st.error2(nil, strings.Join(tE, ", "))
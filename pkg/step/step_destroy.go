@@ -10,6 +10,7 @@ import (
 	"github.com/mmlt/environment-operator/pkg/cloud"
 	"github.com/mmlt/environment-operator/pkg/tmplt"
 	"github.com/mmlt/environment-operator/pkg/util"
+	"github.com/mmlt/environment-operator/pkg/util/exe"
 	"strings"
 )
 
@@ -37,6 +38,16 @@ type DestroyStep struct {
 	Added, Changed, Deleted int
 }
 
+// Artefacts returns the paths of the terraform output files.
+func (st *DestroyStep) Artefacts() []string {
+	return logPaths(st.SourcePath, "init.txt", "destroy.txt")
+}
+
+// GetCounts returns the number of objects affected by the terraform destroy.
+func (st *DestroyStep) GetCounts() (added, changed, deleted int) {
+	return st.Added, st.Changed, st.Deleted
+}
+
 // DeleteLimitForDestroy is the number the budget.deleteLimit must have for the Destroy to proceed.
 // Any other number will deny Destroy.
 const deleteLimitForDestroy = 99
@@ -46,6 +57,7 @@ func (st *DestroyStep) Execute(ctx context.Context, env []string) {
 	// Check budget.
 	b := st.Values.Infra.Budget
 	if b.DeleteLimit == nil || int(*b.DeleteLimit) != deleteLimitForDestroy {
+		countRejection(TypeDestroy, rejectLimits)
 		msg := fmt.Sprintf("destroy requires budget.deleteLimit=%d to proceed", deleteLimitForDestroy)
 		st.error2(nil, msg)
 		return
@@ -104,7 +116,7 @@ func (st *DestroyStep) Execute(ctx context.Context, env []string) {
 
 	if cmd != nil {
 		// real cmd (fakes are nil).
-		err := cmd.Wait()
+		err := exe.Wait(cmd)
 		if err != nil {
 			log.Error(err, "wait terraform destroy")
 		}
@@ -128,6 +140,7 @@ func (st *DestroyStep) Execute(ctx context.Context, env []string) {
 	st.Added = last.TotalAdded
 	st.Changed = last.TotalChanged
 	st.Deleted = last.TotalDestroyed
+	countResources(TypeDestroy, st.Added, st.Changed, st.Deleted)
 
 	st.update(v1.StateReady, fmt.Sprintf("terraform destroy errors=0 added=%d changed=%d deleted=%d",
 		last.TotalAdded, last.TotalChanged, last.TotalDestroyed))
@@ -0,0 +1,133 @@
+package step
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/client/terraform"
+	"github.com/mmlt/environment-operator/pkg/cloud"
+	"github.com/mmlt/environment-operator/pkg/tmplt"
+	"github.com/mmlt/environment-operator/pkg/util"
+	"strings"
+)
+
+// DriftStep performs a terraform init and plan to detect differences between the infrastructure and the terraform code.
+// The plan is never applied, when remediation is enabled the Infra step is expected to undo the drift.
+type DriftStep struct {
+	Metaa
+
+	/* Parameters */
+
+	// Values to use for terraform input variables.
+	Values InfraValues
+	// SourcePath is the path to the directory containing terraform code.
+	SourcePath string
+	// Cloud provides generic cloud functionality.
+	Cloud cloud.Cloud
+	// Terraform provides terraform functionality.
+	Terraform terraform.Terraformer
+
+	/* Results */
+
+	// Added, Changed, Deleted are then number of infrastructure objects that have drifted.
+	Added, Changed, Deleted int
+}
+
+// Artefacts returns the paths of the terraform drift check output files.
+func (st *DriftStep) Artefacts() []string {
+	return logPaths(st.SourcePath, "drift-init.txt", "drift-plan.txt")
+}
+
+// Execute performs the terraform commands.
+func (st *DriftStep) Execute(ctx context.Context, env []string) {
+	log := logr.FromContext(ctx).WithName("DriftStep")
+	ctx = logr.NewContext(ctx, log)
+	log.Info("start")
+
+	st.update(v1.StateRunning, "terraform init")
+
+	err := tmplt.ExpandAll(st.SourcePath, ".tmplt", st.Values)
+	if err != nil {
+		st.checkFailed(err, "tmplt")
+		return
+	}
+
+	sp, err := st.Cloud.Login()
+	if err != nil {
+		st.checkFailed(err, "login")
+		return
+	}
+	xenv := terraformEnviron(sp, st.Values.Infra.State.Access)
+	env = util.KVSliceMergeMap(env, xenv)
+
+	tfr := st.Terraform.Init(ctx, env, st.SourcePath)
+	writeText(tfr.Text, st.SourcePath, "drift-init.txt", log)
+	if len(tfr.Errors) > 0 {
+		st.checkFailed(nil, "terraform init "+tfr.Errors[0] /*first error only*/)
+		return
+	}
+
+	// Plan
+	st.update(v1.StateRunning, "terraform plan")
+
+	tfr = st.Terraform.Plan(ctx, env, st.SourcePath)
+	writeText(tfr.Text, st.SourcePath, "drift-plan.txt", log)
+	if len(tfr.Errors) > 0 {
+		st.checkFailed(nil, "terraform plan "+tfr.Errors[0] /*first error only*/)
+		return
+	}
+
+	st.Added = tfr.PlanAdded
+	st.Changed = tfr.PlanChanged
+	st.Deleted = tfr.PlanDeleted
+
+	d := &v1.DriftStatus{
+		Added:   int32(tfr.PlanAdded),
+		Changed: int32(tfr.PlanChanged),
+		Deleted: int32(tfr.PlanDeleted),
+	}
+	d.LastCheckTime.Time = timeNow()
+	if st.Added == 0 && st.Changed == 0 && st.Deleted == 0 {
+		st.reportDrift(d, "terraform plan: no drift")
+		return
+	}
+	d.Detected = true
+
+	plan, err := st.Terraform.GetPlan(ctx, env, st.SourcePath)
+	if err != nil {
+		st.checkFailed(err, "terraform get plan")
+		return
+	}
+	d.Resources = planResources(plan)
+
+	msg := fmt.Sprintf("terraform plan: drift detected adds=%d changes=%d deletes=%d", tfr.PlanAdded, tfr.PlanChanged, tfr.PlanDeleted)
+	if st.Values.Infra.Drift.Remediate {
+		msgs := budgetExceeded(st.Values.Infra.Budget, tfr)
+		msgs = append(msgs, budgetViolations(st.Values.Infra.Budget, terraform.ResourceChangesFromPlan(plan))...)
+		if len(msgs) > 0 {
+			msg += ", not remediated: " + strings.Join(msgs, ", ")
+		} else {
+			d.Remediated = true
+			msg += ", remediating"
+		}
+	}
+
+	st.reportDrift(d, msg)
+}
+
+// CheckFailed reports a drift check that could not be completed.
+// The step becomes Ready (instead of Error) so a failing check doesn't halt the environment and is tried again when
+// the next drift check is due.
+func (st *DriftStep) checkFailed(err error, msg string) {
+	st.mu.Lock()
+	st.lastError = err
+	st.mu.Unlock()
+
+	if err != nil {
+		msg = msg + " " + err.Error()
+	}
+	d := &v1.DriftStatus{Error: msg}
+	d.LastCheckTime.Time = timeNow()
+	st.reportDrift(d, "drift check failed: "+msg)
+}
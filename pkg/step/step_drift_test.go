@@ -0,0 +1,118 @@
+package step
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/stdr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/client/terraform"
+	"github.com/mmlt/environment-operator/pkg/cloud"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestDriftStep_Execute(t *testing.T) {
+	zero := int32(0)
+
+	tests := []struct {
+		it          string
+		noDrift     bool
+		planErr     bool
+		drift       v1.DriftSpec
+		budget      v1.InfraBudget
+		wantMsg     string
+		wantDetect  bool
+		wantRemed   bool
+		wantResults []v1.PlanResource
+		wantErr     string
+	}{
+		{
+			it:      "should report no drift when terraform plan has no changes",
+			noDrift: true,
+			wantMsg: "terraform plan: no drift",
+		},
+		{
+			it:          "should report drift without remediation",
+			wantMsg:     "terraform plan: drift detected adds=0 changes=0 deletes=1",
+			wantDetect:  true,
+			wantResults: []v1.PlanResource{{Address: "module.aks2.azurerm_kubernetes_cluster.this", Action: "delete"}},
+		},
+		{
+			it:          "should remediate drift within budget",
+			drift:       v1.DriftSpec{Remediate: true},
+			wantMsg:     "terraform plan: drift detected adds=0 changes=0 deletes=1, remediating",
+			wantDetect:  true,
+			wantRemed:   true,
+			wantResults: []v1.PlanResource{{Address: "module.aks2.azurerm_kubernetes_cluster.this", Action: "delete"}},
+		},
+		{
+			it:          "should not remediate drift that exceeds the budget",
+			drift:       v1.DriftSpec{Remediate: true},
+			budget:      v1.InfraBudget{DeleteLimit: &zero},
+			wantMsg:     "terraform plan: drift detected adds=0 changes=0 deletes=1, not remediated: deleted 1 exceeds deleteLimit 0",
+			wantDetect:  true,
+			wantResults: []v1.PlanResource{{Address: "module.aks2.azurerm_kubernetes_cluster.this", Action: "delete"}},
+		},
+		{
+			it:          "should not remediate drift that violates a budget rule",
+			drift:       v1.DriftSpec{Remediate: true},
+			budget:      v1.InfraBudget{DenyDelete: []string{"azurerm_kubernetes_cluster"}},
+			wantMsg:     "terraform plan: drift detected adds=0 changes=0 deletes=1, not remediated: delete denied [module.aks2.azurerm_kubernetes_cluster.this]",
+			wantDetect:  true,
+			wantResults: []v1.PlanResource{{Address: "module.aks2.azurerm_kubernetes_cluster.this", Action: "delete"}},
+		},
+		{
+			it:      "should report a failed check without going into error",
+			planErr: true,
+			wantMsg: "drift check failed: terraform plan boom",
+			wantErr: "terraform plan boom",
+		},
+	}
+
+	l := stdr.New(log.New(os.Stdout, "", log.Lshortfile|log.Ltime))
+	ctx := logr.NewContext(context.Background(), l)
+
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			tf := &terraform.TerraformFake{}
+			tf.SetupFakeResultsForDeleteCluster()
+			if tt.noDrift {
+				tf.PlanResult = terraform.TFResult{}
+			}
+			if tt.planErr {
+				tf.PlanResult = terraform.TFResult{Errors: []string{"boom"}}
+			}
+
+			st := &DriftStep{
+				Metaa: Metaa{
+					ID:   ID{Type: TypeDrift, Namespace: "default", Name: "env"},
+					Hash: "123",
+				},
+				Values: InfraValues{
+					Infra: v1.InfraSpec{
+						Budget: tt.budget,
+						Drift:  tt.drift,
+					},
+				},
+				SourcePath: t.TempDir(),
+				Cloud:      &cloud.Fake{},
+				Terraform:  tf,
+			}
+			st.Execute(ctx, nil)
+
+			assert.Equal(t, v1.StateReady, st.GetState())
+			assert.Equal(t, tt.wantMsg, st.GetMsg())
+			assert.Equal(t, 0, tf.ApplyTally, "terraform apply should never run")
+			d := st.GetDrift()
+			if assert.NotNil(t, d) {
+				assert.False(t, d.LastCheckTime.IsZero())
+				assert.Equal(t, tt.wantDetect, d.Detected)
+				assert.Equal(t, tt.wantRemed, d.Remediated)
+				assert.Equal(t, tt.wantResults, d.Resources)
+				assert.Equal(t, tt.wantErr, d.Error)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package step
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/Jeffail/gabs/v2"
@@ -12,8 +14,12 @@ import (
 	"github.com/mmlt/environment-operator/pkg/client/terraform"
 	"github.com/mmlt/environment-operator/pkg/cloud"
 	"github.com/mmlt/environment-operator/pkg/cluster"
+	"github.com/mmlt/environment-operator/pkg/policy"
+	"github.com/mmlt/environment-operator/pkg/redact"
 	"github.com/mmlt/environment-operator/pkg/tmplt"
 	"github.com/mmlt/environment-operator/pkg/util"
+	"github.com/mmlt/environment-operator/pkg/util/exe"
+	"io"
 	"io/ioutil"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api/v1"
 	"os"
@@ -33,6 +39,9 @@ type InfraStep struct {
 	Values InfraValues
 	// SourcePath is the path to the directory containing terraform code.
 	SourcePath string
+	// WorkspacePath is the root of the source workspace that contains SourcePath.
+	// The policy directory must be in the workspace, when empty it must be in SourcePath.
+	WorkspacePath string
 	// Cloud provides generic cloud functionality.
 	Cloud cloud.Cloud
 	// Azure provides Azure resource manager functionality.
@@ -46,6 +55,12 @@ type InfraStep struct {
 	Kubectl kubectl.Kubectrler
 	// KubeconfigPathFn is a function that takes a cluster name and returns the path to the cluster kubeconfig file.
 	KubeconfigPathFn func(string) (string, error)
+	// ApprovedPlanHash is the hash of the plan that is approved to be applied.
+	// Only used when Values.Infra.Approval is manual.
+	ApprovedPlanHash string
+	// Secrets are the secret values in Values (resolved from vault references or specified literally).
+	// They are redacted from values.json.
+	Secrets []string
 
 	/* Results */
 
@@ -53,6 +68,16 @@ type InfraStep struct {
 	Added, Changed, Deleted int
 }
 
+// Artefacts returns the paths of the terraform output and values files.
+func (st *InfraStep) Artefacts() []string {
+	return logPaths(st.SourcePath, "values.json", "init.txt", "plan.txt", "apply.txt")
+}
+
+// GetCounts returns the number of infrastructure objects affected by the terraform apply.
+func (st *InfraStep) GetCounts() (added, changed, deleted int) {
+	return st.Added, st.Changed, st.Deleted
+}
+
 // InfraValues hold the Specs that are needed during template expansion.
 type InfraValues struct {
 	Infra    v1.InfraSpec
@@ -67,7 +92,7 @@ func (st *InfraStep) Execute(ctx context.Context, env []string) {
 
 	st.update(v1.StateRunning, "terraform init")
 
-	writeJSON(st.Values, st.SourcePath, "values.json", log)
+	writeJSON(st.Values, st.Secrets, st.SourcePath, "values.json", log)
 
 	err := tmplt.ExpandAll(st.SourcePath, ".tmplt", st.Values)
 	if err != nil {
@@ -110,18 +135,9 @@ func (st *InfraStep) Execute(ctx context.Context, env []string) {
 	}
 
 	// Check budget.
-	var msgs []string
-	b := st.Values.Infra.Budget
-	if b.AddLimit != nil && tfr.PlanAdded > int(*b.AddLimit) {
-		msgs = append(msgs, fmt.Sprintf("added %d exceeds addLimit %d", tfr.PlanAdded, *b.AddLimit))
-	}
-	if b.UpdateLimit != nil && tfr.PlanChanged > int(*b.UpdateLimit) {
-		msgs = append(msgs, fmt.Sprintf("changed %d exceeds updateLimit %d", tfr.PlanChanged, *b.UpdateLimit))
-	}
-	if b.DeleteLimit != nil && tfr.PlanDeleted > int(*b.DeleteLimit) {
-		msgs = append(msgs, fmt.Sprintf("deleted %d exceeds deleteLimit %d", tfr.PlanDeleted, *b.DeleteLimit))
-	}
+	msgs := budgetExceeded(st.Values.Infra.Budget, tfr)
 	if len(msgs) > 0 {
+		countRejection(TypeInfra, rejectLimits)
 		st.error2(nil, "plan limits exceeded: "+strings.Join(msgs, ", "))
 		return
 	}
@@ -133,6 +149,48 @@ func (st *InfraStep) Execute(ctx context.Context, env []string) {
 		return
 	}
 
+	// Check budget rules per resource.
+	msgs = budgetViolations(st.Values.Infra.Budget, terraform.ResourceChangesFromPlan(plan))
+	if len(msgs) > 0 {
+		countRejection(TypeInfra, rejectRules)
+		st.error2(nil, "plan budget violated: "+strings.Join(msgs, ", "))
+		return
+	}
+
+	// Check policy rules from the source repo.
+	if st.Values.Infra.Policy != "" {
+		dir, err := policyDir(st.WorkspacePath, st.SourcePath, st.Values.Infra.Policy)
+		if err != nil {
+			st.error2(err, "load policy")
+			return
+		}
+		pol, err := policy.Load(dir)
+		if err != nil {
+			st.error2(err, "load policy")
+			return
+		}
+		var msgs []string
+		for _, v := range pol.Evaluate(plan) {
+			msgs = append(msgs, v.String())
+		}
+		if len(msgs) > 0 {
+			countRejection(TypeInfra, rejectPolicy)
+			st.error2(nil, "plan policy violated: "+strings.Join(msgs, ", "))
+			return
+		}
+	}
+
+	// Wait for a human to approve the plan.
+	if st.Values.Infra.Approval == v1.ApprovalManual {
+		a := planApproval(st.Hash, plan, tfr)
+		if a.Hash != st.ApprovedPlanHash {
+			st.awaitApproval(a, fmt.Sprintf("terraform plan adds=%d changes=%d deletes=%d awaits approval of plan %s",
+				tfr.PlanAdded, tfr.PlanChanged, tfr.PlanDeleted, a.Hash))
+			return
+		}
+		log.Info("plan approved", "hash", a.Hash)
+	}
+
 	err = st.wipeDeletedClusters(plan)
 	if err != nil {
 		st.error2(err, "wipe deleted cluster(s)")
@@ -186,7 +244,7 @@ func (st *InfraStep) Execute(ctx context.Context, env []string) {
 
 	if cmd != nil {
 		// real cmd (fakes are nil).
-		err := cmd.Wait()
+		err := exe.Wait(cmd)
 		if err != nil {
 			log.Error(err, "wait terraform apply")
 		}
@@ -237,11 +295,126 @@ func (st *InfraStep) Execute(ctx context.Context, env []string) {
 	st.Added = last.TotalAdded
 	st.Changed = last.TotalChanged
 	st.Deleted = last.TotalDestroyed
+	countResources(TypeInfra, st.Added, st.Changed, st.Deleted)
 
 	st.update(v1.StateReady, fmt.Sprintf("terraform apply errors=0 added=%d changed=%d deleted=%d",
 		last.TotalAdded, last.TotalChanged, last.TotalDestroyed))
 }
 
+// PolicyDir returns the directory policy that is relative to sourcePath.
+// An error is returned when the directory is outside workspace (sourcePath when workspace is empty), symbolic links
+// are followed.
+func policyDir(workspace, sourcePath, policy string) (string, error) {
+	if workspace == "" {
+		workspace = sourcePath
+	}
+	if filepath.IsAbs(policy) {
+		return "", fmt.Errorf("policy %s: must be a relative path", policy)
+	}
+	dir := filepath.Join(sourcePath, policy)
+
+	resolve := func(p string) string {
+		if r, err := filepath.EvalSymlinks(p); err == nil {
+			return r
+		}
+		return filepath.Clean(p)
+	}
+	rel, err := filepath.Rel(resolve(workspace), resolve(dir))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("policy %s: outside the source workspace", policy)
+	}
+	return dir, nil
+}
+
+// BudgetExceeded returns a message for each limit in b that is exceeded by the terraform plan result tfr.
+func budgetExceeded(b v1.InfraBudget, tfr *terraform.TFResult) []string {
+	var msgs []string
+	if b.AddLimit != nil && tfr.PlanAdded > int(*b.AddLimit) {
+		msgs = append(msgs, fmt.Sprintf("added %d exceeds addLimit %d", tfr.PlanAdded, *b.AddLimit))
+	}
+	if b.UpdateLimit != nil && tfr.PlanChanged > int(*b.UpdateLimit) {
+		msgs = append(msgs, fmt.Sprintf("changed %d exceeds updateLimit %d", tfr.PlanChanged, *b.UpdateLimit))
+	}
+	if b.DeleteLimit != nil && tfr.PlanDeleted > int(*b.DeleteLimit) {
+		msgs = append(msgs, fmt.Sprintf("deleted %d exceeds deleteLimit %d", tfr.PlanDeleted, *b.DeleteLimit))
+	}
+	return msgs
+}
+
+// BudgetViolations returns a message for each resource rule in b that is violated by the resource changes of a plan.
+// The messages list the addresses of the offending resources.
+func budgetViolations(b v1.InfraBudget, changes []terraform.ResourceChange) []string {
+	denyDelete := make(map[string]bool, len(b.DenyDelete))
+	for _, t := range b.DenyDelete {
+		denyDelete[t] = true
+	}
+
+	var deleted, replaced []string
+	perType := make(map[string][]string)
+	for _, c := range changes {
+		if c.Action&terraform.ActionDelete != 0 && denyDelete[c.Type] {
+			deleted = append(deleted, c.Address)
+		}
+		if b.DenyReplace && c.Action == terraform.ActionCreate|terraform.ActionDelete {
+			replaced = append(replaced, c.Address)
+		}
+		if _, ok := b.TypeLimits[c.Type]; ok {
+			perType[c.Type] = append(perType[c.Type], c.Address)
+		}
+	}
+
+	var msgs []string
+	if len(deleted) > 0 {
+		msgs = append(msgs, fmt.Sprintf("delete denied %v", deleted))
+	}
+	if len(replaced) > 0 {
+		msgs = append(msgs, fmt.Sprintf("replace denied %v", replaced))
+	}
+	types := make([]string, 0, len(perType))
+	for t := range perType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if l := b.TypeLimits[t]; len(perType[t]) > int(l) {
+			msgs = append(msgs, fmt.Sprintf("%s changes %d exceed typeLimit %d %v", t, len(perType[t]), l, perType[t]))
+		}
+	}
+
+	return msgs
+}
+
+// PlanApproval returns a summary of plan for a human to approve.
+// The summary hash changes when either the plan or the step hash (sources, values) changes.
+func planApproval(stepHash string, plan *gabs.Container, tfr *terraform.TFResult) *v1.PlanApproval {
+	h := sha1.New()
+	_, _ = io.WriteString(h, stepHash)
+	_, _ = h.Write(plan.Path("resource_changes").Bytes())
+
+	r := &v1.PlanApproval{
+		Hash:      hex.EncodeToString(h.Sum(nil)),
+		StepHash:  stepHash,
+		Added:     int32(tfr.PlanAdded),
+		Changed:   int32(tfr.PlanChanged),
+		Deleted:   int32(tfr.PlanDeleted),
+		Resources: planResources(plan),
+	}
+
+	return r
+}
+
+// PlanResources returns the resources that are changed by plan.
+func planResources(plan *gabs.Container) []v1.PlanResource {
+	var r []v1.PlanResource
+	for _, rc := range terraform.ResourceChangesFromPlan(plan) {
+		r = append(r, v1.PlanResource{
+			Address: rc.Address,
+			Action:  rc.Action.String(),
+		})
+	}
+	return r
+}
+
 // WipeDeletedClusters prevents node drain errors on cluster delete.
 // https://github.com/hashicorp/terraform-provider-azurerm/issues/10411
 func (st *InfraStep) wipeDeletedClusters(plan *gabs.Container) error {
@@ -432,9 +605,19 @@ func terraformEnviron(sp *cloud.ServicePrincipal, access string) map[string]stri
 	return r
 }
 
-// WriteText writes text to dir/log/name.
+// LogPaths returns the paths of the files with names that are written to dir/log by writeText.
+func logPaths(dir string, names ...string) []string {
+	r := make([]string, 0, len(names))
+	for _, n := range names {
+		r = append(r, filepath.Join(dir, "log", n))
+	}
+	return r
+}
+
+// WriteText writes text with secrets redacted to dir/log/name.
 // Errors are logged.
 func writeText(text, dir, name string, log logr.Logger) {
+	text = redact.String(text)
 	p := filepath.Join(dir, "log")
 	err := os.MkdirAll(p, os.ModePerm)
 	if err != nil {
@@ -457,13 +640,16 @@ func writeEnv(env map[string]string, dir, name string, log logr.Logger) {
 	writeText(s, dir, name, log)
 }
 
-// WriteJSON writes json to dir/log/name.
+// WriteJSON writes json with secrets redacted to dir/log/name.
+// Secrets shorter than redact.MinLen are not redacted.
 // Errors are logged.
-func writeJSON(js interface{}, dir, name string, log logr.Logger) {
+func writeJSON(js interface{}, secrets []string, dir, name string, log logr.Logger) {
 	b, err := json.MarshalIndent(js, "", "  ")
 	if err != nil {
 		log.Info("writeJSON", "error", err)
 		return
 	}
-	writeText(string(b), dir, name, log)
+	r := &redact.Redactor{}
+	r.Add(secrets...)
+	writeText(r.String(string(b)), dir, name, log)
 }
@@ -1,12 +1,323 @@
 package step
 
 import (
+	"context"
 	"encoding/json"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/stdr"
+	v1 "github.com/mmlt/environment-operator/api/v1"
+	"github.com/mmlt/environment-operator/pkg/client/azure"
+	"github.com/mmlt/environment-operator/pkg/client/kubectl"
+	"github.com/mmlt/environment-operator/pkg/client/terraform"
+	"github.com/mmlt/environment-operator/pkg/cloud"
 	"github.com/mmlt/environment-operator/pkg/cluster"
+	"github.com/mmlt/environment-operator/pkg/metrics"
+	"github.com/mmlt/environment-operator/pkg/redact"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"testing"
 )
 
+func TestInfraStep_Execute_approval(t *testing.T) {
+	tf := &terraform.TerraformFake{}
+	tf.SetupFakeResultsForDeleteCluster()
+	tf.ApplyResult = tf.ApplyResult[len(tf.ApplyResult)-1:] // just the final result to keep the test fast
+
+	newStep := func(approvedPlanHash string) *InfraStep {
+		dir := t.TempDir()
+		return &InfraStep{
+			Metaa: Metaa{
+				ID:   ID{Type: TypeInfra, Namespace: "default", Name: "env"},
+				Hash: "123",
+			},
+			Values: InfraValues{
+				Infra: v1.InfraSpec{
+					EnvName:  "local",
+					Approval: v1.ApprovalManual,
+				},
+			},
+			SourcePath: dir,
+			Cloud:      &cloud.Fake{},
+			Azure:      &azure.AZFake{},
+			Terraform:  tf,
+			Client:     cluster.Client{Client: fake.NewClientBuilder().Build()},
+			Kubectl:    &kubectl.KubectlFake{},
+			KubeconfigPathFn: func(n string) (string, error) {
+				return filepath.Join(dir, n), nil
+			},
+			ApprovedPlanHash: approvedPlanHash,
+		}
+	}
+
+	l := stdr.New(log.New(os.Stdout, "", log.Lshortfile|log.Ltime))
+	ctx := logr.NewContext(context.Background(), l)
+
+	// plan is not approved yet.
+	st := newStep("")
+	st.Execute(ctx, nil)
+	assert.Equal(t, v1.StateAwaitingApproval, st.GetState())
+	assert.Equal(t, 0, tf.ApplyTally, "terraform apply should not run without approval")
+	approval := st.GetApproval()
+	if assert.NotNil(t, approval) {
+		assert.Equal(t, "123", approval.StepHash)
+		assert.Equal(t, int32(1), approval.Deleted)
+		assert.Equal(t, []v1.PlanResource{
+			{Address: "module.aks2.azurerm_kubernetes_cluster.this", Action: "delete"},
+		}, approval.Resources)
+	}
+
+	// plan is approved.
+	st = newStep(approval.Hash)
+	st.Execute(ctx, nil)
+	assert.Equal(t, v1.StateReady, st.GetState(), st.GetMsg())
+	assert.Equal(t, 1, tf.ApplyTally)
+	assert.Nil(t, st.GetApproval())
+}
+
+func TestInfraStep_Execute_budgetViolation(t *testing.T) {
+	tf := &terraform.TerraformFake{}
+	tf.SetupFakeResultsForDeleteCluster()
+
+	st := &InfraStep{
+		Metaa: Metaa{
+			ID:   ID{Type: TypeInfra, Namespace: "default", Name: "env"},
+			Hash: "123",
+		},
+		Values: InfraValues{
+			Infra: v1.InfraSpec{
+				EnvName: "local",
+				Budget: v1.InfraBudget{
+					DenyDelete: []string{"azurerm_kubernetes_cluster"},
+				},
+			},
+		},
+		SourcePath: t.TempDir(),
+		Cloud:      &cloud.Fake{},
+		Azure:      &azure.AZFake{},
+		Terraform:  tf,
+		Kubectl:    &kubectl.KubectlFake{},
+	}
+
+	l := stdr.New(log.New(os.Stdout, "", log.Lshortfile|log.Ltime))
+	st.Execute(logr.NewContext(context.Background(), l), nil)
+
+	assert.Equal(t, v1.StateError, st.GetState())
+	assert.Equal(t, "plan budget violated: delete denied [module.aks2.azurerm_kubernetes_cluster.this]", st.GetMsg())
+	assert.Equal(t, 0, tf.ApplyTally, "terraform apply should not run when the budget is violated")
+}
+
+func TestInfraStep_Execute_policyViolation(t *testing.T) {
+	tf := &terraform.TerraformFake{}
+	tf.SetupFakeResultsForDeleteCluster()
+
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "policy"), 0755)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "policy", "aks.yaml"), []byte(`
+rules:
+- name: keep-clusters
+  match:
+    type: azurerm_kubernetes_cluster
+    actions: [delete]
+`), 0644)
+	assert.NoError(t, err)
+
+	st := &InfraStep{
+		Metaa: Metaa{
+			ID:   ID{Type: TypeInfra, Namespace: "default", Name: "env"},
+			Hash: "123",
+		},
+		Values: InfraValues{
+			Infra: v1.InfraSpec{
+				EnvName: "local",
+				Policy:  "policy",
+			},
+		},
+		SourcePath: dir,
+		Cloud:      &cloud.Fake{},
+		Azure:      &azure.AZFake{},
+		Terraform:  tf,
+		Kubectl:    &kubectl.KubectlFake{},
+	}
+
+	rejections := metrics.BudgetRejections.WithLabelValues(string(TypeInfra), rejectPolicy)
+	before := testutil.ToFloat64(rejections)
+
+	l := stdr.New(log.New(os.Stdout, "", log.Lshortfile|log.Ltime))
+	st.Execute(logr.NewContext(context.Background(), l), nil)
+
+	assert.Equal(t, v1.StateError, st.GetState())
+	assert.Equal(t, "plan policy violated: keep-clusters [module.aks2.azurerm_kubernetes_cluster.this]", st.GetMsg())
+	assert.Equal(t, before+1, testutil.ToFloat64(rejections), "should count the rejection")
+	assert.Equal(t, 0, tf.ApplyTally, "terraform apply should not run when the policy is violated")
+}
+
+func TestInfraStep_Execute_policyMissing(t *testing.T) {
+	tf := &terraform.TerraformFake{}
+	tf.SetupFakeResultsForDeleteCluster()
+
+	st := &InfraStep{
+		Metaa: Metaa{
+			ID:   ID{Type: TypeInfra, Namespace: "default", Name: "env"},
+			Hash: "123",
+		},
+		Values: InfraValues{
+			Infra: v1.InfraSpec{
+				EnvName: "local",
+				Policy:  "policy",
+			},
+		},
+		SourcePath: t.TempDir(),
+		Cloud:      &cloud.Fake{},
+		Azure:      &azure.AZFake{},
+		Terraform:  tf,
+		Kubectl:    &kubectl.KubectlFake{},
+	}
+
+	l := stdr.New(log.New(os.Stdout, "", log.Lshortfile|log.Ltime))
+	st.Execute(logr.NewContext(context.Background(), l), nil)
+
+	assert.Equal(t, v1.StateError, st.GetState())
+	assert.Contains(t, st.GetMsg(), "load policy")
+	assert.Equal(t, 0, tf.ApplyTally, "terraform apply should not run when the policy can't be loaded")
+}
+
+func Test_policyDir(t *testing.T) {
+	ws := t.TempDir()
+	main := filepath.Join(ws, "terraform", "main")
+	assert.NoError(t, os.MkdirAll(main, 0755))
+	assert.NoError(t, os.Symlink("/etc", filepath.Join(main, "escape")))
+
+	tests := []struct {
+		it        string
+		workspace string
+		policy    string
+		want      string
+		wantErr   string
+	}{
+		{
+			it:        "should return a directory in main",
+			workspace: ws,
+			policy:    "policy",
+			want:      filepath.Join(main, "policy"),
+		},
+		{
+			it:        "should return a directory in the workspace outside main",
+			workspace: ws,
+			policy:    "../../policy",
+			want:      filepath.Join(ws, "policy"),
+		},
+		{
+			it:        "should reject a directory outside the workspace",
+			workspace: ws,
+			policy:    "../../..",
+			wantErr:   "policy ../../..: outside the source workspace",
+		},
+		{
+			it:      "should reject a directory outside main when the workspace is unknown",
+			policy:  "../policy",
+			wantErr: "policy ../policy: outside the source workspace",
+		},
+		{
+			it:        "should reject a symbolic link to outside the workspace",
+			workspace: ws,
+			policy:    "escape",
+			wantErr:   "policy escape: outside the source workspace",
+		},
+		{
+			it:        "should reject an absolute path",
+			workspace: ws,
+			policy:    "/etc",
+			wantErr:   "policy /etc: must be a relative path",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got, err := policyDir(tt.workspace, main, tt.policy)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_budgetViolations(t *testing.T) {
+	changes := []terraform.ResourceChange{
+		{Address: "module.aks1.azurerm_kubernetes_cluster.this", Type: "azurerm_kubernetes_cluster", Action: terraform.ActionDelete},
+		{Address: "module.aks2.azurerm_kubernetes_cluster.this", Type: "azurerm_kubernetes_cluster", Action: terraform.ActionUpdate},
+		{Address: "module.aks1.azurerm_subnet.this", Type: "azurerm_subnet", Action: terraform.ActionCreate | terraform.ActionDelete},
+		{Address: "module.aks2.azurerm_subnet.this", Type: "azurerm_subnet", Action: terraform.ActionUpdate},
+		{Address: "azurerm_key_vault.env", Type: "azurerm_key_vault", Action: terraform.ActionCreate},
+	}
+
+	tests := []struct {
+		it     string
+		budget v1.InfraBudget
+		want   []string
+	}{
+		{
+			it:   "should allow all changes when no rules are specified",
+			want: nil,
+		},
+		{
+			it:     "should deny deletes and replaces of a resource type",
+			budget: v1.InfraBudget{DenyDelete: []string{"azurerm_kubernetes_cluster", "azurerm_subnet"}},
+			want:   []string{"delete denied [module.aks1.azurerm_kubernetes_cluster.this module.aks1.azurerm_subnet.this]"},
+		},
+		{
+			it:     "should allow creates of a resource type that can't be deleted",
+			budget: v1.InfraBudget{DenyDelete: []string{"azurerm_key_vault"}},
+			want:   nil,
+		},
+		{
+			it:     "should deny replaces",
+			budget: v1.InfraBudget{DenyReplace: true},
+			want:   []string{"replace denied [module.aks1.azurerm_subnet.this]"},
+		},
+		{
+			it: "should deny changes exceeding a type limit",
+			budget: v1.InfraBudget{TypeLimits: map[string]int32{
+				"azurerm_subnet":             1,
+				"azurerm_kubernetes_cluster": 2,
+				"azurerm_key_vault":          0,
+			}},
+			want: []string{
+				"azurerm_key_vault changes 1 exceed typeLimit 0 [azurerm_key_vault.env]",
+				"azurerm_subnet changes 2 exceed typeLimit 1 [module.aks1.azurerm_subnet.this module.aks2.azurerm_subnet.this]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.it, func(t *testing.T) {
+			got := budgetViolations(tt.budget, changes)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_planApproval(t *testing.T) {
+	tf := &terraform.TerraformFake{}
+	tf.SetupFakeResultsForDeleteCluster()
+	plan, err := tf.GetPlan(context.Background(), nil, "")
+	assert.NoError(t, err)
+	tfr := &terraform.TFResult{PlanDeleted: 1}
+
+	a1 := planApproval("123", plan, tfr)
+	a2 := planApproval("123", plan, tfr)
+	assert.Equal(t, a1.Hash, a2.Hash, "same input should result in the same hash")
+
+	a3 := planApproval("456", plan, tfr)
+	assert.NotEqual(t, a1.Hash, a3.Hash, "a step hash change should result in a different hash")
+}
+
 func Test_kubeconfig(t *testing.T) {
 	tests := []struct {
 		it      string
@@ -211,3 +522,41 @@ func testUnmarshall(t *testing.T, in string) map[string]interface{} {
 	}
 	return out
 }
+
+func Test_writeJSON_redactsSecrets(t *testing.T) {
+	dir := t.TempDir()
+	values := InfraValues{
+		Infra: v1.InfraSpec{
+			EnvName: "local",
+			AAD:     v1.AADSpec{ServerAppSecret: `s3"cr3t`},
+			X:       map[string]string{"token": "t0k3n-value"},
+		},
+	}
+
+	l := stdr.New(log.New(os.Stdout, "", log.Lshortfile|log.Ltime))
+	writeJSON(values, []string{`s3"cr3t`, "t0k3n-value", "local", ""}, dir, "values.json", l)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "log", "values.json"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "cr3t")
+	assert.NotContains(t, string(b), "t0k3n")
+	assert.Contains(t, string(b), `"serverAppSecret": "<redacted>"`)
+	// secrets shorter than redact.MinLen are ignored.
+	assert.Contains(t, string(b), `"envName": "local"`)
+}
+
+func Test_writeEnv_redactsSecrets(t *testing.T) {
+	dir := t.TempDir()
+	redact.Add("client-s3cr3t", "access-k3y")
+	env := terraformEnviron(&cloud.ServicePrincipal{ClientID: "id", ClientSecret: "client-s3cr3t", Tenant: "tenant"}, "access-k3y")
+
+	l := stdr.New(log.New(os.Stdout, "", log.Lshortfile|log.Ltime))
+	writeEnv(env, dir, "infra.env", l)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "log", "infra.env"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "s3cr3t")
+	assert.NotContains(t, string(b), "k3y")
+	assert.Contains(t, string(b), "ARM_CLIENT_SECRET=<redacted>")
+	assert.Contains(t, string(b), "ARM_CLIENT_ID=id")
+}
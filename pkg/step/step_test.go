@@ -2,6 +2,7 @@ package step
 
 import (
 	"errors"
+	"github.com/mmlt/environment-operator/pkg/redact"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -46,3 +47,17 @@ func TestTypesFromString(t *testing.T) {
 		})
 	}
 }
+
+func TestMetaa_error2_redactsSecrets(t *testing.T) {
+	redact.Add("g1t-t0k3n")
+	m := &Metaa{}
+	var got string
+	m.SetOnUpdate(func(meta Meta) {
+		got = meta.GetMsg()
+	})
+
+	m.error2(errors.New("git [clone https://g1t-t0k3n@example.com/repo.git]: exit status 128"), "source")
+
+	assert.Equal(t, "source git [clone https://<redacted>@example.com/repo.git]: exit status 128", m.GetMsg())
+	assert.Equal(t, m.GetMsg(), got)
+}
@@ -0,0 +1,44 @@
+// Package tracing sets up OpenTelemetry tracing of reconciles, steps and external commands.
+// Until Setup is called spans are created by a no-op provider.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the instrumentation name of the envop tracer.
+const name = "github.com/mmlt/environment-operator"
+
+// Tracer returns the envop tracer.
+// The tracer delegates to the global provider so it can be obtained before Setup is called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Setup exports spans via OTLP/HTTP to endpoint (host:port) and returns a function to flush and stop the exporter.
+// Insecure disables TLS.
+func Setup(ctx context.Context, endpoint string, insecure bool) (func(context.Context) error, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exp, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("envop"))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
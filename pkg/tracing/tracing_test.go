@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+
+	ctx := context.Background()
+	shutdown, err := Setup(ctx, strings.TrimPrefix(srv.URL, "http://"), true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, span := Tracer().Start(ctx, "test")
+	span.End()
+
+	assert.NoError(t, shutdown(ctx), "shutdown should flush spans")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/v1/traces"}, paths)
+}
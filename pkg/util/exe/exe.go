@@ -3,10 +3,20 @@ package exe
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/mmlt/environment-operator/pkg/metrics"
+	"github.com/mmlt/environment-operator/pkg/redact"
+	"github.com/mmlt/environment-operator/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
 )
 
 // Opt are the exec options, see https://godoc.org/os/exec#Cmd for details.
@@ -20,8 +30,17 @@ type Opt struct {
 // Run executes 'cmd' with 'stdin', 'args' and (optional) 'options'.
 // Return stdout and stderr upon completion.
 func Run(log logr.Logger, options *Opt, stdin string, cmd string, args ...string) (stdout, stderr string, err error) {
+	return RunContext(context.Background(), log, options, stdin, cmd, args...)
+}
+
+// RunContext is like Run but the command is traced as a child of the span in ctx.
+// Ctx is only used for tracing, the command isn't killed when ctx is done so terraform can't be interrupted halfway.
+func RunContext(ctx context.Context, log logr.Logger, options *Opt, stdin string, cmd string, args ...string) (stdout, stderr string, err error) {
 	log.V(2).Info("Run", "cmd", cmd, "args", args)
 
+	_, span := startSpan(ctx, "exe.Run", cmd, args)
+	defer span.End()
+
 	c := exec.Command(cmd, args...)
 
 	if options != nil {
@@ -51,6 +70,8 @@ func Run(log logr.Logger, options *Opt, stdin string, cmd string, args ...string
 	var sout, serr bytes.Buffer
 	c.Stdout, c.Stderr = &sout, &serr
 	err = c.Run()
+	observe(cmd, err)
+	endSpan(span, err)
 	stdout, stderr = string(sout.Bytes()), string(serr.Bytes())
 	log.V(3).Info("Run-result", "stderr", stderr, "stdout", stdout)
 	if err != nil {
@@ -73,3 +94,80 @@ func RunAsync(ctx context.Context, log logr.Logger, options *Opt, _ /*stdin*/ st
 
 	return c
 }
+
+// Start starts a command returned by RunAsync.
+// The command is traced as a child of the span in ctx, when Start returns nil Wait must be called to end the span.
+func Start(ctx context.Context, c *exec.Cmd) error {
+	_, span := startSpan(ctx, "exe.RunAsync", c.Args[0], c.Args[1:])
+	err := c.Start()
+	if err != nil {
+		observe(c.Args[0], err)
+		endSpan(span, err)
+		span.End()
+		return err
+	}
+
+	asyncSpans.Lock()
+	asyncSpans.m[c] = span
+	asyncSpans.Unlock()
+
+	return nil
+}
+
+// Wait waits for a command started by Start to complete.
+func Wait(c *exec.Cmd) error {
+	err := c.Wait()
+	observe(c.Path, err)
+
+	asyncSpans.Lock()
+	span, ok := asyncSpans.m[c]
+	delete(asyncSpans.m, c)
+	asyncSpans.Unlock()
+	if ok {
+		endSpan(span, err)
+		span.End()
+	}
+
+	return err
+}
+
+// AsyncSpans are the spans of the commands started by Start that are ended by Wait.
+var asyncSpans = struct {
+	sync.Mutex
+	m map[*exec.Cmd]trace.Span
+}{m: make(map[*exec.Cmd]trace.Span)}
+
+// StartSpan starts a span for the invocation of binary cmd.
+// Args are redacted because they might contain secrets like a git token.
+func startSpan(ctx context.Context, name, cmd string, args []string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name, trace.WithAttributes(
+		attribute.String("cmd", cmd),
+		attribute.StringSlice("args", redact.Default.Strings(args)),
+	))
+}
+
+// EndSpan records the exit code of the invocation that returned err with span.
+func endSpan(span trace.Span, err error) {
+	span.SetAttributes(attribute.Int("exit_code", exitCode(err)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Observe counts the invocation of binary cmd that returned err.
+func observe(cmd string, err error) {
+	metrics.ExecInvocations.WithLabelValues(filepath.Base(cmd), strconv.Itoa(exitCode(err))).Inc()
+}
+
+// ExitCode returns the exit code of a command that returned err or -1 when the command didn't start.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode()
+	}
+	return -1
+}
@@ -1,8 +1,15 @@
 package exe
 
 import (
+	"context"
 	"github.com/go-logr/stdr"
+	"github.com/mmlt/environment-operator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"testing"
 )
 
@@ -66,3 +73,66 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRun_countsInvocations(t *testing.T) {
+	log := stdr.New(nil)
+	counter := func(bin, code string) float64 {
+		return testutil.ToFloat64(metrics.ExecInvocations.WithLabelValues(bin, code))
+	}
+	okBefore, failBefore, missingBefore := counter("true", "0"), counter("false", "1"), counter("nonexisting-binary", "-1")
+
+	_, _, _ = Run(log, nil, "", "true")
+	_, _, _ = Run(log, nil, "", "false")
+	_, _, _ = Run(log, nil, "", "nonexisting-binary")
+	c := RunAsync(context.Background(), log, nil, "", "false")
+	assert.NoError(t, Start(context.Background(), c))
+	assert.Error(t, Wait(c))
+	c = RunAsync(context.Background(), log, nil, "", "nonexisting-binary")
+	assert.Error(t, Start(context.Background(), c))
+
+	assert.Equal(t, okBefore+1, counter("true", "0"))
+	assert.Equal(t, failBefore+2, counter("false", "1"))
+	assert.Equal(t, missingBefore+2, counter("nonexisting-binary", "-1"))
+}
+
+func TestRun_traces(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	log := stdr.New(nil)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	_, _, _ = RunContext(ctx, log, nil, "", "ls", "nonexisting")
+	c := RunAsync(ctx, log, nil, "", "true")
+	assert.NoError(t, Start(ctx, c))
+	assert.NoError(t, Wait(c))
+	c = RunAsync(ctx, log, nil, "", "nonexisting-binary")
+	assert.Error(t, Start(ctx, c))
+	parent.End()
+
+	spans := sr.Ended()
+	if !assert.Len(t, spans, 4) {
+		return
+	}
+	for _, s := range spans[:3] {
+		assert.Equal(t, parent.SpanContext().SpanID(), s.Parent().SpanID(), "should be a child of the span in ctx")
+	}
+
+	assert.Equal(t, "exe.Run", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("cmd", "ls"))
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("exit_code", 2))
+	assert.Equal(t, "exe.RunAsync", spans[1].Name())
+	assert.Contains(t, spans[1].Attributes(), attribute.Int("exit_code", 0))
+	assert.Equal(t, "exe.RunAsync", spans[2].Name())
+	assert.Contains(t, spans[2].Attributes(), attribute.Int("exit_code", -1), "should end the span of a command that didn't start")
+	assert.Len(t, asyncSpans.m, 0)
+}
+
+func TestRunContext_notCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	stdout, _, err := RunContext(ctx, stdr.New(nil), nil, "", "echo", "done")
+	assert.NoError(t, err, "should not kill the command when ctx is done")
+	assert.Equal(t, "done\n", stdout)
+}